@@ -0,0 +1,180 @@
+package cache2go
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// adminHandler 缓存表注册中心的HTTP管理接口
+type adminHandler struct {
+	token string
+}
+
+// NewAdminHandler 创建缓存表的HTTP管理接口，token不为空时请求需要携带Authorization: Bearer <token>请求头，
+// 可以通过http.StripPrefix挂载到任意路径下，支持的接口如下，键只支持字符串：
+//
+//	GET    /tables                      列出所有缓存表
+//	GET    /tables/{table}/stats        获取缓存表的统计信息
+//	GET    /tables/{table}/keys         列出缓存表中所有的键，非字符串的键以fmt.Sprint格式化
+//	POST   /tables/{table}/flush        清空缓存表
+//	GET    /tables/{table}/keys/{key}   获取缓存项
+//	PUT    /tables/{table}/keys/{key}   设置缓存项，请求体为字符串数据，可以通过?ttl=30s设置存活时间
+//	DELETE /tables/{table}/keys/{key}   删除缓存项
+func NewAdminHandler(token string) http.Handler {
+	return &adminHandler{token: token}
+}
+
+// 管理接口返回的缓存项
+type adminItem struct {
+	Key          string      `json:"key"`
+	Value        interface{} `json:"value"`
+	LifeSpanMs   int64       `json:"lifeSpanMs"`
+	TTLMs        int64       `json:"ttlMs"`
+	CreateTime   time.Time   `json:"createTime"`
+	AccessedTime time.Time   `json:"accessedTime"`
+	AccessCount  int64       `json:"accessCount"`
+}
+
+// 管理接口返回的统计信息
+type adminStats struct {
+	Stats
+	Items    int     `json:"items"`
+	HitRatio float64 `json:"hitRatio"`
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.token != "" {
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(h.token)) != 1 {
+			h.error(w, http.StatusUnauthorized, "未授权")
+			return
+		}
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for i, p := range parts {
+		unescaped, err := url.PathUnescape(p)
+		if err != nil {
+			h.error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		parts[i] = unescaped
+	}
+	if len(parts) == 0 || parts[0] != "tables" {
+		h.error(w, http.StatusNotFound, "接口不存在")
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			h.error(w, http.StatusMethodNotAllowed, "不支持的请求方法")
+			return
+		}
+		h.json(w, http.StatusOK, Tables())
+		return
+	}
+
+	table, ok := lookupTable(parts[1])
+	if !ok {
+		h.error(w, http.StatusNotFound, "缓存表不存在")
+		return
+	}
+	switch {
+	case len(parts) == 3 && parts[2] == "stats" && r.Method == http.MethodGet:
+		s := table.Stats()
+		h.json(w, http.StatusOK, adminStats{Stats: s, Items: table.Count(), HitRatio: s.HitRatio()})
+	case len(parts) == 3 && parts[2] == "flush" && r.Method == http.MethodPost:
+		table.Flush()
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 3 && parts[2] == "keys" && r.Method == http.MethodGet:
+		all := table.Keys()
+		keys := make([]string, 0, len(all))
+		for _, key := range all {
+			keys = append(keys, fmt.Sprint(key))
+		}
+		sort.Strings(keys)
+		h.json(w, http.StatusOK, keys)
+	case len(parts) == 4 && parts[2] == "keys":
+		h.serveKey(w, r, table, parts[3])
+	default:
+		h.error(w, http.StatusNotFound, "接口不存在")
+	}
+}
+
+// 处理单个缓存项的请求
+func (h *adminHandler) serveKey(w http.ResponseWriter, r *http.Request, table *CacheTable, key string) {
+	switch r.Method {
+	case http.MethodGet:
+		// 使用Peek，不影响访问次数和存活时间
+		item, err := table.Peek(key)
+		if err != nil {
+			h.error(w, http.StatusNotFound, ErrCacheNotFound.Error())
+			return
+		}
+		ttl := item.TTL()
+		if ttl > 0 {
+			ttl /= time.Millisecond
+		}
+		item.RLock()
+		resp := adminItem{
+			Key:          key,
+			Value:        item.dataLocked(),
+			LifeSpanMs:   int64(item.lifeSpan / time.Millisecond),
+			TTLMs:        int64(ttl),
+			CreateTime:   item.createTime,
+			AccessedTime: item.accessedTime,
+			AccessCount:  item.accessCountLocked(),
+		}
+		item.RUnlock()
+		h.json(w, http.StatusOK, resp)
+	case http.MethodPut:
+		var lifeSpan time.Duration
+		if ttl := r.URL.Query().Get("ttl"); ttl != "" {
+			d, err := time.ParseDuration(ttl)
+			if err != nil || d < 0 {
+				h.error(w, http.StatusBadRequest, "ttl格式错误")
+				return
+			}
+			lifeSpan = d
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			h.error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		table.Add(key, string(body), lifeSpan)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if _, err := table.Delete(key); err != nil {
+			h.error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		h.error(w, http.StatusMethodNotAllowed, "不支持的请求方法")
+	}
+}
+
+func (h *adminHandler) json(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func (h *adminHandler) error(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,95 @@
+package cache2go
+
+import "sync"
+
+// WithTinyLFU 开启TinyLFU准入策略，需要同时通过WithMaxItems限制缓存项的个数，
+// 缓存表已满时新的键只有在估计的访问频率高于将被淘汰的缓存项时才会被加入，
+// 避免只访问一次的键挤掉经常访问的缓存项，被拒绝的缓存项不会加入缓存表，Add仍然返回该缓存项
+func WithTinyLFU() Option {
+	return func(ct *CacheTable) {
+		ct.admission = true
+	}
+}
+
+// 判断新的键是否可以加入已满的缓存表，调用者需要持有缓存表的锁，并且不能持有分片的锁
+func (ct *CacheTable) admit(key interface{}) bool {
+	if ct.sketch == nil || ct.count() < ct.maxItems {
+		return true
+	}
+	if _, ok := ct.lookup(key); ok {
+		return true
+	}
+	victimKey, victim := ct.lruVictim()
+	if victim == nil {
+		return true
+	}
+	return ct.sketch.estimate(hashKey(key)) > ct.sketch.estimate(hashKey(victimKey))
+}
+
+// 记录一次对键的访问
+func (ct *CacheTable) recordFrequency(key interface{}) {
+	if ct.sketch != nil {
+		ct.sketch.increment(hashKey(key))
+	}
+}
+
+// 估计访问频率的Count-Min Sketch，每个计数器最大为15，
+// 计数达到一定次数后全部减半，使频率能够反映近期的访问
+type frequencySketch struct {
+	sync.Mutex
+	rows      [4][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+// 每一行使用不同的种子计算下标
+var sketchSeeds = [4]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+func newFrequencySketch(capacity int) *frequencySketch {
+	width := 64
+	for width < capacity*4 {
+		width <<= 1
+	}
+	s := &frequencySketch{mask: uint64(width - 1), resetAt: width * 10}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *frequencySketch) index(h uint64, row int) uint64 {
+	h = (h ^ sketchSeeds[row]) * 0x9e3779b97f4a7c15
+	return (h >> 32) & s.mask
+}
+
+func (s *frequencySketch) increment(h uint64) {
+	s.Lock()
+	defer s.Unlock()
+	for i := range s.rows {
+		if c := &s.rows[i][s.index(h, i)]; *c < 15 {
+			*c++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *frequencySketch) estimate(h uint64) uint8 {
+	s.Lock()
+	defer s.Unlock()
+	min := uint8(15)
+	for i := range s.rows {
+		if c := s.rows[i][s.index(h, i)]; c < min {
+			min = c
+		}
+	}
+	return min
+}
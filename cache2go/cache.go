@@ -1,24 +1,155 @@
 package cache2go
 
-import "sync"
+import (
+	"context"
+	"sort"
+	"sync"
+)
 
 var (
 	cache = make(map[string]*CacheTable)
 	mutex sync.RWMutex
 )
 
-// Cache 创建新的缓存表，如果存在就返回已存在的缓存表
-func Cache(table string) *CacheTable {
-	mutex.Lock()
-	defer mutex.Unlock()
-	t, ok := cache[table]
+// Cache 创建新的缓存表，如果存在就返回已存在的缓存表，
+// opts只在创建缓存表时生效，对已存在的缓存表会被忽略。
+// 设置了SetRegistryQuota时只有QuotaEvictLRU策略生效，QuotaReject不会拒绝创建，只记录一条警告日志，需要拒绝时使用TryCache
+func Cache(table string, opts ...Option) *CacheTable {
+	t, _ := cacheTable(table, opts, false)
+	return t
+}
+
+// 创建缓存表并应用配置项，不会注册
+func newTable(table string, opts []Option) *CacheTable {
+	t := &CacheTable{shards: newShards(DefaultShards)}
+	t.name.Store(table)
+	for _, opt := range opts {
+		opt(t)
+	}
+	if n := registryQuota().MaxItemsPerTable; n > 0 && (t.maxItems == 0 || t.maxItems > n) {
+		t.maxItems = n
+	}
+	// sketch的大小依赖于WithMaxItems，需要在所有配置项生效之后创建
+	if t.admission && t.maxItems > 0 {
+		t.sketch = newFrequencySketch(t.maxItems)
+	}
+	t.markUsed()
+	return t
+}
 
+// RegisteredTables 获取所有已创建的缓存表
+func RegisteredTables() []*CacheTable {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	tables := make([]*CacheTable, 0, len(cache))
+	for _, t := range cache {
+		tables = append(tables, t)
+	}
+	return tables
+}
+
+// DeleteCache 关闭并从注册中心移除缓存表，返回缓存表是否存在
+func DeleteCache(table string) bool {
+	t, ok := lookupTable(table)
 	if !ok {
-		t = &CacheTable{
-			name:  table,
-			items: make(map[interface{}]*CacheItem),
+		return false
+	}
+	t.Close()
+	return true
+}
+
+// Tables 获取所有已创建缓存表的名字，按字典序排列
+func Tables() []string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	names := make([]string, 0, len(cache))
+	for name := range cache {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Shutdown 关闭所有已注册的缓存表，通过WithPersistFile设置了文件的缓存表会在关闭前保存到文件，
+// 然后等待正在进行的加载以及异步回调函数执行完成，ctx结束时不再等待并返回ctx的错误，
+// 保存失败时继续关闭其余缓存表，最后返回遇到的第一个错误
+func Shutdown(ctx context.Context) error {
+	tables := RegisteredTables()
+	var first error
+	for _, t := range tables {
+		t.RLock()
+		path := t.persistPath
+		t.RUnlock()
+		if path != "" {
+			if err := t.SaveFile(path); err != nil && first == nil {
+				first = err
+			}
 		}
-		cache[table] = t
+		t.Close()
+	}
+	for _, t := range tables {
+		if err := t.loading.wait(ctx); err != nil {
+			return err
+		}
+		if t.callbackPool == nil {
+			continue
+		}
+		done := make(chan struct{})
+		go func(t *CacheTable) {
+			t.WaitCallbacks()
+			close(done)
+		}(t)
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return first
+}
+
+// RenameCache 将缓存表在注册中心中原子地改名为newName，缓存项保持不变，之后的日志、错误和追踪都使用新的名字，
+// 已经通过PublishExpvar注册的名字不会改变。oldName不存在时返回ErrTableNotFound，newName已存在时返回ErrTableExists
+func RenameCache(oldName, newName string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	t, ok := cache[oldName]
+	if !ok {
+		return ErrTableNotFound
+	}
+	if oldName == newName {
+		return nil
+	}
+	if _, ok := cache[newName]; ok {
+		return ErrTableExists
+	}
+	delete(cache, oldName)
+	t.name.Store(newName)
+	cache[newName] = t
+	return nil
+}
+
+// FlushAll 清空所有已创建的缓存表
+func FlushAll() {
+	for _, t := range RegisteredTables() {
+		t.Flush()
+	}
+}
+
+// 查找已存在的缓存表，不存在时不会创建
+func lookupTable(name string) (*CacheTable, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	t, ok := cache[name]
+	return t, ok
+}
+
+// 将缓存表从注册中心移除，只有注册的是同一个缓存表时才会移除
+func unregister(t *CacheTable) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	name := t.Name()
+	if cur, ok := cache[name]; ok && cur == t {
+		delete(cache, name)
 	}
-	return t
 }
@@ -9,8 +9,20 @@ package cache2go
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
 	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -83,6 +95,124 @@ func TestCacheExpire(t *testing.T) {
 	}
 }
 
+func TestDefaultLifeSpan(t *testing.T) {
+	table := Cache("testDefaultLifeSpan")
+	table.SetDefaultLifeSpan(100 * time.Millisecond)
+
+	p := table.AddDefault(k+"_1", v)
+	table.NotFoundAdd(k+"_2", DefaultLifeSpan, v)
+	table.Add(k+"_3", v, 0)
+	if p.LifeSpan() != 100*time.Millisecond {
+		t.Error("Error applying default life-span")
+	}
+
+	// items using the default expire, explicit zero still means forever
+	time.Sleep(150 * time.Millisecond)
+	if table.Exists(k+"_1") || table.Exists(k+"_2") || !table.Exists(k+"_3") {
+		t.Error("Error expiring items with default life-span")
+	}
+}
+
+func TestDefaultLifeSpanOnUpdate(t *testing.T) {
+	table := Cache("testDefaultLifeSpanOnUpdate")
+	table.SetDefaultLifeSpan(time.Minute)
+
+	table.Add(k, v, 0)
+	table.Replace(k, v, DefaultLifeSpan)
+	item, _ := table.Value(k)
+	if item.LifeSpan() != time.Minute {
+		t.Error("Replace should resolve DefaultLifeSpan", item.LifeSpan())
+	}
+	item.SetLifeSpan(0)
+	table.Touch(k, DefaultLifeSpan)
+	if item.LifeSpan() != time.Minute {
+		t.Error("Touch should resolve DefaultLifeSpan", item.LifeSpan())
+	}
+	item.SetLifeSpan(0)
+	item.SetLifeSpan(DefaultLifeSpan)
+	if item.LifeSpan() != time.Minute {
+		t.Error("SetLifeSpan should resolve DefaultLifeSpan", item.LifeSpan())
+	}
+
+	// detached items have no default and never expire
+	detached := NewCacheItem(k, v, 0)
+	detached.Touch(DefaultLifeSpan)
+	if detached.LifeSpan() != 0 {
+		t.Error("Negative life-span should be treated as zero", detached.LifeSpan())
+	}
+}
+
+func TestExpirationJitter(t *testing.T) {
+	table := Cache("testExpirationJitter")
+	table.SetExpirationJitter(0.5)
+
+	entries := map[interface{}]interface{}{}
+	for i := 0; i < 100; i++ {
+		entries[i] = v
+	}
+	items := table.AddAll(entries, time.Second)
+
+	// life spans should be spread out within the configured bounds
+	distinct := map[time.Duration]bool{}
+	for _, item := range items {
+		ls := item.LifeSpan()
+		if ls < 500*time.Millisecond || ls > 1500*time.Millisecond {
+			t.Error("Jittered life-span out of bounds", ls)
+		}
+		distinct[ls] = true
+	}
+	if len(distinct) < 2 {
+		t.Error("Expected jittered life-spans to differ")
+	}
+
+	// non-expiring items are not affected
+	if p := table.Add(k, v, 0); p.LifeSpan() != 0 {
+		t.Error("Jitter should not apply to non expiring items")
+	}
+	table.Flush()
+}
+
+func TestPauseExpiration(t *testing.T) {
+	table := Cache("testPauseExpiration")
+	p := table.Add(k, v, 150*time.Millisecond)
+
+	// items must survive while expiration is paused
+	time.Sleep(50 * time.Millisecond)
+	table.PauseExpiration()
+	time.Sleep(200 * time.Millisecond)
+	if !table.Exists(k) {
+		t.Error("Item expired while expiration was paused")
+	}
+
+	// the countdown resumes where it stopped
+	table.ResumeExpiration()
+	if ttl := p.TTL(); ttl < 50*time.Millisecond || ttl > 100*time.Millisecond {
+		t.Error("Error freezing TTL countdown", ttl)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if table.Exists(k) {
+		t.Error("Error expiring item after resuming expiration")
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	table := Cache("testDeleteExpired")
+	// pause the timer so only the manual purge removes items
+	table.PauseExpiration()
+	table.Add(k+"_1", v, 50*time.Millisecond)
+	table.Add(k+"_2", v, 50*time.Millisecond)
+	table.Add(k+"_3", v, 0)
+
+	if n := table.DeleteExpired(); n != 0 {
+		t.Error("DeleteExpired removed items before they expired", n)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := table.DeleteExpired(); n != 2 || table.Count() != 1 {
+		t.Error("Error purging expired items", n)
+	}
+	table.ResumeExpiration()
+}
+
 func TestExists(t *testing.T) {
 	// add an expiring item
 	table := Cache("testExists")
@@ -105,6 +235,82 @@ func TestNotFoundAdd(t *testing.T) {
 	}
 }
 
+func TestReplace(t *testing.T) {
+	table := Cache("testReplace")
+
+	if err := table.Replace(k, v, 0); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("Expected error replacing missing item")
+	}
+
+	p := table.Add(k, v, 0)
+	table.Value(k)
+	createTime := p.CreateTime()
+	if err := table.Replace(k, v+"_2", time.Second); err != nil {
+		t.Error("Error replacing item", err)
+	}
+
+	p, _ = table.Value(k)
+	if p.Data().(string) != v+"_2" || p.LifeSpan() != time.Second {
+		t.Error("Error updating replaced item")
+	}
+	if p.AccessedCount() != 2 || !p.CreateTime().Equal(createTime) {
+		t.Error("Replace should keep access count and creation time")
+	}
+}
+
+func TestRename(t *testing.T) {
+	table := Cache("testRename")
+	p := table.Add(k, v, time.Second)
+	table.Value(k)
+	table.Add(k+"_other", v, 0)
+
+	if err := table.Rename(k, k+"_other"); !errors.Is(err, ErrCacheExists) {
+		t.Error("Expected error renaming to an existing key")
+	}
+	if err := table.Rename(k+"_missing", k+"_new"); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("Expected error renaming a missing key")
+	}
+
+	if err := table.Rename(k, k+"_new"); err != nil {
+		t.Error("Error renaming item", err)
+	}
+	if table.Exists(k) || !table.Exists(k+"_new") {
+		t.Error("Error rebinding item to new key")
+	}
+	r, _ := table.Value(k + "_new")
+	if r != p || r.Key() != k+"_new" || r.AccessedCount() != 2 || r.LifeSpan() != time.Second {
+		t.Error("Rename should keep the item and its metadata")
+	}
+}
+
+func TestRenameNotifiesWatchersAndStore(t *testing.T) {
+	store := &mapStore{data: map[interface{}]interface{}{}}
+	table := Cache("testRenameNotifies", WithStore(store))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := table.Watch(ctx)
+
+	p := table.Add(k, v, 0)
+	<-events
+	version := p.Version()
+	if err := table.Rename(k, k+"_new"); err != nil {
+		t.Fatal("Error renaming item", err)
+	}
+	del, add := <-events, <-events
+	if del.Type != WatchDelete || del.Key != k || del.OldData != v || add.Type != WatchAdd || add.Key != k+"_new" || add.NewData != v {
+		t.Error("Rename should emit a delete for the old key and an add for the new key", del, add)
+	}
+	if p.Version() == version {
+		t.Error("Rename should assign a new version")
+	}
+	if _, ok := store.data[k]; ok || store.data[k+"_new"] != v {
+		t.Error("Rename should move the key in the store", store.data)
+	}
+	if _, err := table.Value(k); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("The old key should not be read back from the store", err)
+	}
+}
+
 func TestNotFoundAddConcurrency(t *testing.T) {
 	table := Cache("testNotFoundAdd")
 
@@ -168,6 +374,203 @@ func TestCacheKeepAlive(t *testing.T) {
 	}
 }
 
+func TestTouch(t *testing.T) {
+	// add an expiring item and access it once
+	table := Cache("testTouch")
+	p := table.Add(k, v, 150*time.Millisecond)
+	table.Value(k)
+	createTime := p.CreateTime()
+
+	// extend its life span before it expires
+	time.Sleep(100 * time.Millisecond)
+	if err := table.Touch(k, 300*time.Millisecond); err != nil {
+		t.Error("Error touching item", err)
+	}
+	if p.LifeSpan() != 300*time.Millisecond {
+		t.Error("Error updating life-span")
+	}
+	if p.AccessedCount() != 1 || !p.CreateTime().Equal(createTime) {
+		t.Error("Touch should keep access count and creation time")
+	}
+
+	// check it's still alive after it was initially supposed to expire
+	time.Sleep(150 * time.Millisecond)
+	if !table.Exists(k) {
+		t.Error("Error extending item life-span")
+	}
+
+	// shrinking the life span should take effect immediately
+	p.Touch(50 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if table.Exists(k) {
+		t.Error("Error expiring item after shrinking life-span")
+	}
+
+	if err := table.Touch(k, time.Second); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("Expected error touching missing item")
+	}
+}
+
+func TestSetLifeSpan(t *testing.T) {
+	// add an item which won't expire for a long time
+	table := Cache("testSetLifeSpan")
+	p := table.Add(k, v, 10*time.Second)
+
+	time.Sleep(100 * time.Millisecond)
+	accessedTime := p.AccessedTime()
+
+	// shrinking the life span below the elapsed time should expire it right away
+	p.SetLifeSpan(50 * time.Millisecond)
+	if !p.AccessedTime().Equal(accessedTime) {
+		t.Error("SetLifeSpan should not refresh the access time")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if table.Exists(k) {
+		t.Error("Error expiring item after shrinking life-span")
+	}
+}
+
+func TestTTL(t *testing.T) {
+	table := Cache("testTTL")
+	table.Add(k+"_1", v, 0)
+	p := table.Add(k+"_2", v, time.Second)
+
+	// non-expiring items report -1
+	if ttl, err := table.TTL(k + "_1"); err != nil || ttl != -1 {
+		t.Error("Error getting TTL of non expiring item", ttl, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	ttl, err := table.TTL(k + "_2")
+	if err != nil || ttl <= 0 || ttl > 900*time.Millisecond {
+		t.Error("Error getting remaining TTL", ttl, err)
+	}
+
+	// accessing the item resets its remaining TTL
+	p.KeepAlive()
+	if p.TTL() <= 900*time.Millisecond {
+		t.Error("Error resetting TTL after access")
+	}
+
+	if _, err := table.TTL(k); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("Expected error getting TTL of missing item")
+	}
+}
+
+func TestAddAll(t *testing.T) {
+	table := Cache("testAddAll")
+	var added int32
+	table.SetAddedItemCallback(func(item *CacheItem) {
+		atomic.AddInt32(&added, 1)
+	})
+
+	entries := map[interface{}]interface{}{}
+	for i := 0; i < 100; i++ {
+		entries[k+strconv.Itoa(i)] = v
+	}
+	items := table.AddAll(entries, 100*time.Millisecond)
+	if len(items) != 100 || table.Count() != 100 {
+		t.Error("Error adding items in batch")
+	}
+	if atomic.LoadInt32(&added) != 100 {
+		t.Error("AddedItem callback not called for every item")
+	}
+
+	// all items should expire together
+	time.Sleep(150 * time.Millisecond)
+	if table.Count() != 0 {
+		t.Error("Error expiring items added in batch")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	table := Cache("testKeys")
+	table.Add("user:1", v, 0)
+	table.Add("user:2", v, 0)
+	table.Add("order:1", v, 0)
+	table.Add(42, v, 0)
+
+	if len(table.Keys()) != 4 {
+		t.Error("Error listing keys")
+	}
+
+	keys, err := table.KeysMatching("user:*")
+	sort.Strings(keys)
+	if err != nil || len(keys) != 2 || keys[0] != "user:1" || keys[1] != "user:2" {
+		t.Error("Error listing keys matching pattern", keys, err)
+	}
+
+	if _, err := table.KeysMatching("["); err == nil {
+		t.Error("Expected error for malformed pattern")
+	}
+}
+
+func TestIterator(t *testing.T) {
+	table := Cache("testIterator")
+	for i := 0; i < 10; i++ {
+		table.Add(i, v, 0)
+	}
+
+	// writers must not be blocked while iterating a snapshot
+	it := table.Iterator(false)
+	count := 0
+	for it.Next() {
+		table.Delete(it.Key())
+		if it.Item().Data().(string) != v {
+			t.Error("Error retrieving item from iterator")
+		}
+		count++
+	}
+	if count != 10 || table.Count() != 0 {
+		t.Error("Error iterating snapshot", count)
+	}
+
+	// live iteration skips items removed after the iterator was created
+	for i := 0; i < 10; i++ {
+		table.Add(i, v, 0)
+	}
+	it = table.Iterator(true)
+	table.DeleteFunc(func(key interface{}, item *CacheItem) bool {
+		return key.(int)%2 == 0
+	})
+	count = 0
+	for it.Next() {
+		if it.Key().(int)%2 == 0 {
+			t.Error("Live iterator returned a deleted item")
+		}
+		count++
+	}
+	if count != 5 || it.Len() != 10 {
+		t.Error("Error iterating live items", count)
+	}
+}
+
+func TestPin(t *testing.T) {
+	table := Cache("testPin")
+	p := table.Add(k, v, 50*time.Millisecond)
+	p.Pin()
+
+	// pinned items never expire but still track access stats
+	time.Sleep(100 * time.Millisecond)
+	if !table.Exists(k) || !p.Pinned() {
+		t.Error("Pinned item expired")
+	}
+	if table.DeleteExpired() != 0 {
+		t.Error("DeleteExpired removed a pinned item")
+	}
+	table.Value(k)
+	if p.AccessedCount() != 1 {
+		t.Error("Error tracking access of pinned item")
+	}
+
+	// once unpinned the item expires normally
+	p.Unpin()
+	time.Sleep(100 * time.Millisecond)
+	if table.Exists(k) {
+		t.Error("Error expiring item after unpinning")
+	}
+}
+
 func TestDelete(t *testing.T) {
 	// add an item to the cache
 	table := Cache("testDelete")
@@ -192,6 +595,176 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestDeleteAll(t *testing.T) {
+	table := Cache("testDeleteAll")
+	var removed int32
+	table.SetDeleteItemCallback(func(item *CacheItem) {
+		atomic.AddInt32(&removed, 1)
+	})
+	table.Add(k+"_1", v, 0)
+	table.Add(k+"_2", v, 0)
+	table.Add(k+"_3", v, 0)
+
+	// delete two existing keys and one missing key
+	deleted := table.DeleteAll(k+"_1", k+"_2", k+"_4")
+	if len(deleted) != 2 || deleted[0] != k+"_1" || deleted[1] != k+"_2" {
+		t.Error("Error reporting deleted keys", deleted)
+	}
+	if table.Count() != 1 || !table.Exists(k+"_3") {
+		t.Error("Error deleting items in batch")
+	}
+	if atomic.LoadInt32(&removed) != 2 {
+		t.Error("DeleteItem callback not called for every item")
+	}
+}
+
+func TestDeleteFunc(t *testing.T) {
+	table := Cache("testDeleteFunc")
+	for i := 0; i < 10; i++ {
+		table.Add("tenantA_"+strconv.Itoa(i), v, 0)
+		table.Add("tenantB_"+strconv.Itoa(i), v, 0)
+	}
+
+	// remove everything belonging to tenantA
+	n := table.DeleteFunc(func(key interface{}, item *CacheItem) bool {
+		return strings.HasPrefix(key.(string), "tenantA_")
+	})
+	if n != 10 || table.Count() != 10 {
+		t.Error("Error deleting items by predicate")
+	}
+	if table.Exists("tenantA_0") || !table.Exists("tenantB_0") {
+		t.Error("DeleteFunc removed the wrong items")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	table := Cache("testUpdate")
+	table.Add(k, 0, 0)
+
+	// concurrent increments must not lose updates
+	var finish sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		finish.Add(1)
+		go func() {
+			defer finish.Done()
+			for j := 0; j < 100; j++ {
+				table.Update(k, func(old interface{}) (interface{}, bool) {
+					return old.(int) + 1, true
+				})
+			}
+		}()
+	}
+	finish.Wait()
+	p, _ := table.Value(k)
+	if p.Data().(int) != 1000 {
+		t.Error("Error updating item atomically", p.Data())
+	}
+
+	// compare and swap only succeeds with the current data
+	if ok, err := table.CompareAndSwap(k, 1, 2); ok || err != nil {
+		t.Error("CompareAndSwap should fail on mismatch")
+	}
+	if ok, err := table.CompareAndSwap(k, 1000, 2); !ok || err != nil || p.Data().(int) != 2 {
+		t.Error("Error swapping item data")
+	}
+
+	// returning keep=false removes the item
+	table.Update(k, func(old interface{}) (interface{}, bool) {
+		return nil, false
+	})
+	if table.Exists(k) {
+		t.Error("Error removing item in Update")
+	}
+	if err := table.Update(k, func(old interface{}) (interface{}, bool) { return old, true }); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("Expected error updating missing item")
+	}
+}
+
+func TestPop(t *testing.T) {
+	table := Cache("testPop")
+	table.Add(k, v, 0)
+
+	// only one of the concurrent callers may get the item
+	var finish sync.WaitGroup
+	var popped int32
+	for i := 0; i < 10; i++ {
+		finish.Add(1)
+		go func() {
+			defer finish.Done()
+			if data, err := table.Pop(k); err == nil && data.(string) == v {
+				atomic.AddInt32(&popped, 1)
+			}
+		}()
+	}
+	finish.Wait()
+	if popped != 1 || table.Exists(k) {
+		t.Error("Error popping item", popped)
+	}
+	if _, err := table.Pop(k); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("Expected error popping missing item")
+	}
+}
+
+func TestClose(t *testing.T) {
+	table := Cache("testClose")
+	var removed int32
+	table.SetDeleteItemReasonCallback(func(item *CacheItem, reason DeleteReason) {
+		if reason == ReasonFlushed {
+			atomic.AddInt32(&removed, 1)
+		}
+	})
+	table.Add(k+"_1", v, 50*time.Millisecond)
+	table.Add(k+"_2", v, 0)
+	table.CloseWithCallbacks()
+
+	if !table.Closed() || table.Count() != 0 || atomic.LoadInt32(&removed) != 2 {
+		t.Error("Error closing table")
+	}
+
+	// the closed table rejects further use
+	table.Add(k, v, 0)
+	if table.Exists(k) {
+		t.Error("Closed table accepted a new item")
+	}
+	if _, err := table.Value(k); !errors.Is(err, ErrTableClosed) {
+		t.Error("Expected error reading from closed table", err)
+	}
+
+	// the registry hands out a fresh table under the same name
+	if Cache("testClose") == table {
+		t.Error("Closed table still registered")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	a := Cache("testRegistryA")
+	b := Cache("testRegistryB")
+	a.Add(k, v, 0)
+	b.Add(k, v, 0)
+
+	names := Tables()
+	if sort.SearchStrings(names, "testRegistryA") == len(names) || !sort.StringsAreSorted(names) {
+		t.Error("Error listing tables", names)
+	}
+
+	FlushAll()
+	if a.Count() != 0 || b.Count() != 0 {
+		t.Error("Error flushing all tables")
+	}
+
+	if !DeleteCache("testRegistryA") || DeleteCache("testRegistryA") {
+		t.Error("Error deleting table from registry")
+	}
+	for _, name := range Tables() {
+		if name == "testRegistryA" {
+			t.Error("Deleted table still listed")
+		}
+	}
+	if !a.Closed() {
+		t.Error("Deleted table should be closed")
+	}
+}
+
 func TestFlush(t *testing.T) {
 	// add an item to the cache
 	table := Cache("testFlush")
@@ -263,43 +836,261 @@ func TestDataLoader(t *testing.T) {
 	}
 }
 
-func TestAccessCount(t *testing.T) {
-	// add 100 items to the cache
-	count := 100
-	table := Cache("testAccessCount")
-	for i := 0; i < count; i++ {
-		table.Add(i, v, 10*time.Second)
+func TestValues(t *testing.T) {
+	table := Cache("testValues")
+	table.Add(k+"_1", v, 0)
+	table.Add(k+"_2", v, 0)
+
+	// retrieve existing and missing keys in one call
+	found, missing := table.Values(k+"_1", k+"_2", k+"_3")
+	if len(found) != 2 || found[k+"_1"].Data().(string) != v {
+		t.Error("Error retrieving items in batch")
 	}
-	// never access the first item, access the second item once, the third
-	// twice and so on...
-	for i := 0; i < count; i++ {
-		for j := 0; j < i; j++ {
-			table.Value(i)
-		}
+	if len(missing) != 1 || missing[0] != k+"_3" {
+		t.Error("Error reporting missing keys")
+	}
+	if found[k+"_2"].AccessedCount() != 1 {
+		t.Error("Error updating access count in batch retrieval")
 	}
 
-	// check MostAccessed returns the items in correct order
-	ma := table.MostAccessed(int64(count))
-	for i, item := range ma {
-		if item.Key() != count-1-i {
-			t.Error("Most accessed items seem to be sorted incorrectly")
+	// misses should go through the data-loader
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		if key.(string) == "nil" {
+			return nil
 		}
+		return NewCacheItem(key, v, 0)
+	})
+	found, missing = table.Values(k+"_3", "nil")
+	if len(found) != 1 || !table.Exists(k+"_3") {
+		t.Error("Error loading missing keys in batch retrieval")
 	}
-
-	// check MostAccessed returns the correct amount of items
-	ma = table.MostAccessed(int64(count - 1))
-	if len(ma) != count-1 {
-		t.Error("MostAccessed returns incorrect amount of items")
+	if len(missing) != 1 || missing[0] != "nil" {
+		t.Error("Error reporting unloadable keys")
 	}
 }
 
-func TestCallbacks(t *testing.T) {
-	var m sync.Mutex
-	addedKey := ""
-	removedKey := ""
-	calledAddedItem := false
-	calledRemoveItem := false
-	expired := false
+func TestGetOrCompute(t *testing.T) {
+	table := Cache("testGetOrCompute")
+	defer table.Close()
+	var computed int32
+
+	// concurrent callers for the same key share one computation
+	var finish sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		finish.Add(1)
+		go func() {
+			defer finish.Done()
+			p, err := table.GetOrCompute(k, 0, func() (interface{}, error) {
+				atomic.AddInt32(&computed, 1)
+				time.Sleep(50 * time.Millisecond)
+				return v, nil
+			})
+			if err != nil || p.Data().(string) != v {
+				t.Error("Error computing item", err)
+			}
+		}()
+	}
+	finish.Wait()
+	if atomic.LoadInt32(&computed) != 1 || !table.Exists(k) {
+		t.Error("Expected exactly one computation", computed)
+	}
+
+	// failed computations are not cached
+	loadErr := errors.New("backend down")
+	_, err := table.GetOrCompute(k+"_err", 0, func() (interface{}, error) {
+		return nil, loadErr
+	})
+	if err != loadErr || table.Exists(k+"_err") {
+		t.Error("Error handling failed computation")
+	}
+
+	// a miss must not need the table-wide write lock while a reader holds it
+	table.RLock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		table.GetOrCompute(k+"_locked", 0, func() (interface{}, error) {
+			return v, nil
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("GetOrCompute blocked on the table lock")
+	}
+	table.RUnlock()
+	<-done
+	if !table.Exists(k + "_locked") {
+		t.Error("Error caching computed item")
+	}
+}
+
+func TestStats(t *testing.T) {
+	table := Cache("testStats")
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		if key.(string) == "nil" {
+			return nil
+		}
+		return NewCacheItem(key, v, 0)
+	})
+
+	table.Add(k+"_1", v, 0)
+	table.Add(k+"_2", v, 50*time.Millisecond)
+	table.Value(k + "_1")
+	table.Value(k + "_3")
+	table.Value("nil")
+	table.Delete(k + "_1")
+	time.Sleep(100 * time.Millisecond)
+
+	s := table.Stats()
+	if s.Hits != 1 || s.Misses != 2 || s.Loads != 1 || s.LoadFailures != 1 {
+		t.Error("Error counting lookups", s)
+	}
+	if s.Adds != 3 || s.Deletes != 1 || s.Expirations != 1 {
+		t.Error("Error counting adds and removals", s)
+	}
+	if ratio := s.HitRatio(); ratio < 0.33 || ratio > 0.34 {
+		t.Error("Error computing hit ratio", ratio)
+	}
+
+	// both loader invocations are recorded in the latency histogram
+	if h := table.LoadLatency(); h.Count != 2 || len(h.Counts) != len(h.Bounds)+1 {
+		t.Error("Error recording load latency", h)
+	}
+
+	table.ResetStats()
+	if table.Stats() != (Stats{}) {
+		t.Error("Error resetting stats")
+	}
+}
+
+func TestPublishExpvar(t *testing.T) {
+	table := Cache("testPublishExpvar")
+	table.Add(k, v, 0)
+	table.Value(k)
+
+	if err := table.PublishExpvar("cache2go."); err != nil {
+		t.Error("Error publishing expvar", err)
+	}
+	if err := table.PublishExpvar("cache2go."); err != ErrExpvarExists {
+		t.Error("Expected error publishing expvar twice")
+	}
+
+	// the published value reflects the table counters
+	var vars map[string]interface{}
+	if err := json.Unmarshal([]byte(expvar.Get("cache2go.testPublishExpvar").String()), &vars); err != nil {
+		t.Fatal("Error decoding expvar", err)
+	}
+	if vars["items"].(float64) != 1 || vars["hits"].(float64) != 1 {
+		t.Error("Error publishing table metrics", vars)
+	}
+
+	// concurrent publishing under the same name must not panic
+	var wg sync.WaitGroup
+	var published atomic.Int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if table.PublishExpvar("cache2go.concurrent.") == nil {
+				published.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if published.Load() != 1 {
+		t.Error("Expected exactly one concurrent publish to succeed", published.Load())
+	}
+}
+
+type testTracer struct {
+	sync.Mutex
+	events []string
+}
+
+type testSpan struct {
+	tracer *testTracer
+	name   string
+}
+
+func (tr *testTracer) Start(ctx context.Context, name string, table string, key interface{}) (context.Context, Span) {
+	tr.Lock()
+	tr.events = append(tr.events, "start "+name)
+	tr.Unlock()
+	return ctx, &testSpan{tr, name}
+}
+
+func (s *testSpan) Event(name string) {
+	s.tracer.Lock()
+	s.tracer.events = append(s.tracer.events, name)
+	s.tracer.Unlock()
+}
+
+func (s *testSpan) End(err error) {
+	s.tracer.Lock()
+	s.tracer.events = append(s.tracer.events, "end "+s.name)
+	s.tracer.Unlock()
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &testTracer{}
+	table := Cache("testTracer")
+	table.SetTracer(tracer)
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		return NewCacheItem(key, v, 0)
+	})
+
+	// a miss traces the loader inside the Value span, a hit only records an event
+	table.Value(k)
+	table.Value(k)
+	expected := []string{
+		"start " + SpanValue, EventMiss, "start " + SpanLoad, "end " + SpanLoad, "end " + SpanValue,
+		"start " + SpanValue, EventHit, "end " + SpanValue,
+	}
+	tracer.Lock()
+	if !reflect.DeepEqual(tracer.events, expected) {
+		t.Error("Error tracing Value calls", tracer.events)
+	}
+	tracer.Unlock()
+}
+
+func TestAccessCount(t *testing.T) {
+	// add 100 items to the cache
+	count := 100
+	table := Cache("testAccessCount")
+	for i := 0; i < count; i++ {
+		table.Add(i, v, 10*time.Second)
+	}
+	// never access the first item, access the second item once, the third
+	// twice and so on...
+	for i := 0; i < count; i++ {
+		for j := 0; j < i; j++ {
+			table.Value(i)
+		}
+	}
+
+	// check MostAccessed returns the items in correct order
+	ma := table.MostAccessed(int64(count))
+	for i, item := range ma {
+		if item.Key() != count-1-i {
+			t.Error("Most accessed items seem to be sorted incorrectly")
+		}
+	}
+
+	// check MostAccessed returns the correct amount of items
+	ma = table.MostAccessed(int64(count - 1))
+	if len(ma) != count-1 {
+		t.Error("MostAccessed returns incorrect amount of items")
+	}
+}
+
+func TestCallbacks(t *testing.T) {
+	var m sync.Mutex
+	addedKey := ""
+	removedKey := ""
+	calledAddedItem := false
+	calledRemoveItem := false
+	expired := false
 	calledExpired := false
 
 	// setup a cache with AddedItem & SetAboutToDelete handlers configured
@@ -360,6 +1151,33 @@ func TestCallbacks(t *testing.T) {
 
 }
 
+func TestDeleteReason(t *testing.T) {
+	var m sync.Mutex
+	reasons := map[interface{}]DeleteReason{}
+
+	table := Cache("testDeleteReason")
+	table.SetDeleteItemReasonCallback(func(item *CacheItem, reason DeleteReason) {
+		m.Lock()
+		reasons[item.Key()] = reason
+		m.Unlock()
+	})
+	table.Add(k+"_1", v, 0)
+	table.Add(k+"_2", v, 50*time.Millisecond)
+
+	// one manual deletion and one expiration
+	table.Delete(k + "_1")
+	time.Sleep(100 * time.Millisecond)
+
+	m.Lock()
+	if reasons[k+"_1"] != ReasonDeleted || reasons[k+"_2"] != ReasonExpired {
+		t.Error("Error passing delete reason to callbacks", reasons)
+	}
+	m.Unlock()
+	if ReasonExpired.String() != "expired" {
+		t.Error("Error formatting delete reason")
+	}
+}
+
 func TestCallbackQueue(t *testing.T) {
 	var m sync.Mutex
 	addedKey := ""
@@ -472,3 +1290,3008 @@ func TestLogger(t *testing.T) {
 		t.Error("Logger is empty")
 	}
 }
+
+type testLogger struct {
+	sync.Mutex
+	records [][]interface{}
+}
+
+func (l *testLogger) Debug(msg string, args ...interface{}) { l.record(msg, args) }
+func (l *testLogger) Info(msg string, args ...interface{})  { l.record(msg, args) }
+func (l *testLogger) Warn(msg string, args ...interface{})  { l.record(msg, args) }
+func (l *testLogger) Error(msg string, args ...interface{}) { l.record(msg, args) }
+
+func (l *testLogger) record(msg string, args []interface{}) {
+	l.Lock()
+	l.records = append(l.records, append([]interface{}{msg}, args...))
+	l.Unlock()
+}
+
+func TestStructuredLogger(t *testing.T) {
+	l := &testLogger{}
+	table := Cache("testStructuredLogger")
+	table.SetStructuredLogger(l)
+	table.Add(k, v, 0)
+
+	// every record carries the table name plus event specific fields
+	l.Lock()
+	if len(l.records) == 0 {
+		t.Fatal("Structured logger is empty")
+	}
+	r := l.records[0]
+	if len(r) < 5 || r[1] != "table" || r[2] != "testStructuredLogger" || r[3] != "event" || r[4] != "add" {
+		t.Error("Unexpected log fields", r)
+	}
+	l.Unlock()
+
+	// the legacy adapter renders key=value pairs
+	out := new(bytes.Buffer)
+	NewStdLogger(log.New(out, "", 0)).Info("msg", "key", 1, "dangling")
+	if out.String() != "level=INFO msg=\"msg\" key=1 !BADKEY=dangling\n" {
+		t.Error("Unexpected legacy log output", out.String())
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	out := new(bytes.Buffer)
+	table := Cache("testLogLevel")
+	table.SetLogger(log.New(out, "", 0))
+	table.SetLogLevel(LevelInfo)
+
+	// debug records such as Add are filtered out
+	table.Add(k, v, 0)
+	if out.Len() != 0 {
+		t.Error("Debug log should be filtered", out.String())
+	}
+
+	table.Flush()
+	if !strings.HasPrefix(out.String(), "level=INFO") {
+		t.Error("Expected info log for Flush", out.String())
+	}
+}
+
+func TestWatch(t *testing.T) {
+	table := Cache("testWatch")
+	ctx, cancel := context.WithCancel(context.Background())
+	events := table.Watch(ctx)
+
+	table.Add(k, v, 0)
+	table.Add(k, v+"_2", 0)
+	table.Replace(k, v+"_3", 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	expected := []struct {
+		typ     EventType
+		oldData interface{}
+		newData interface{}
+	}{
+		{WatchAdd, nil, v},
+		{WatchUpdate, v, v + "_2"},
+		{WatchUpdate, v + "_2", v + "_3"},
+		{WatchExpire, v + "_3", nil},
+	}
+	for _, exp := range expected {
+		select {
+		case e := <-events:
+			if e.Type != exp.typ || e.Key != k || e.OldData != exp.oldData || e.NewData != exp.newData || e.Time.IsZero() {
+				t.Error("Unexpected event", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for event", exp.typ)
+		}
+	}
+
+	// cancelling the context closes the channel
+	cancel()
+	for range events {
+	}
+}
+
+func TestWatchFlush(t *testing.T) {
+	table := Cache("testWatchFlush")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := table.Watch(ctx)
+
+	expectFlushed := func(op string) {
+		e := <-events
+		if e.Type != WatchDelete || e.Key != k || e.OldData != v || e.Reason != ReasonFlushed {
+			t.Error("Expected a flushed delete event", op, e)
+		}
+	}
+	table.Add(k, v, 0)
+	<-events
+	table.Flush()
+	expectFlushed("Flush")
+
+	table.Add(k, v, 0)
+	<-events
+	table.FlushWithOptions(context.Background(), FlushOptions{Callbacks: true})
+	expectFlushed("FlushWithOptions")
+
+	table.Add(k, v, 0)
+	<-events
+	table.Close()
+	expectFlushed("Close")
+}
+
+func TestWatchSlowConsumer(t *testing.T) {
+	table := Cache("testWatchSlowConsumer")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := table.WatchWithOptions(ctx, WatchOptions{Buffer: 1})
+
+	// with the default policy a full buffer drops events instead of blocking
+	table.Add(k+"_1", v, 0)
+	table.Add(k+"_2", v, 0)
+	if e := <-events; e.Key != k+"_1" {
+		t.Error("Unexpected event", e)
+	}
+	select {
+	case e := <-events:
+		t.Error("Expected event to be dropped", e)
+	default:
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	table := Cache("testSaveLoad")
+	table.Add(k+"_1", v, 0)
+	table.Add(k+"_2", v, time.Second)
+	table.Add(k+"_3", v, 50*time.Millisecond)
+	table.Value(k + "_1")
+
+	path := filepath.Join(t.TempDir(), "snapshot.gob")
+	time.Sleep(20 * time.Millisecond)
+	if err := table.SaveFile(path); err != nil {
+		t.Fatal("Error saving table", err)
+	}
+
+	// restore into a fresh table after the short lived item expired
+	time.Sleep(50 * time.Millisecond)
+	restored := Cache("testSaveLoadRestored")
+	if err := restored.LoadFile(path); err != nil {
+		t.Fatal("Error loading table", err)
+	}
+	if restored.Count() != 3 {
+		t.Error("Error restoring items", restored.Count())
+	}
+	p, err := restored.Value(k + "_1")
+	if err != nil || p.Data().(string) != v || p.AccessedCount() != 2 || p.LifeSpan() != 0 {
+		t.Error("Error restoring item metadata", err)
+	}
+	if ttl, _ := restored.TTL(k + "_2"); ttl > 980*time.Millisecond {
+		t.Error("Restored item should keep its remaining life-span", ttl)
+	}
+
+	// the item that was about to expire is removed once its remaining time is up
+	time.Sleep(50 * time.Millisecond)
+	if restored.Exists(k + "_3") {
+		t.Error("Error expiring restored item")
+	}
+
+	if err := restored.LoadFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected error loading missing file")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	table := Cache("testJSON")
+	table.Add("user:1", map[string]interface{}{"name": "alice"}, 0)
+	table.Add("user:2", v, time.Minute)
+
+	b, err := json.Marshal(table)
+	if err != nil {
+		t.Fatal("Error exporting table", err)
+	}
+	var doc map[string]interface{}
+	json.Unmarshal(b, &doc)
+	if doc["table"] != "testJSON" || len(doc["items"].([]interface{})) != 2 {
+		t.Error("Unexpected JSON document", string(b))
+	}
+
+	// seed another table from the exported document
+	seeded := Cache("testJSONSeeded")
+	if err := json.Unmarshal(b, seeded); err != nil {
+		t.Fatal("Error importing table", err)
+	}
+	p, err := seeded.Value("user:1")
+	if err != nil || p.Data().(map[string]interface{})["name"] != "alice" || p.LifeSpan() != 0 {
+		t.Error("Error importing item", err)
+	}
+	if ttl, _ := seeded.TTL("user:2"); ttl <= 59*time.Second || ttl > time.Minute {
+		t.Error("Imported item should keep its remaining life-span", ttl)
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	table := Cache("testAdminHandler")
+	srv := httptest.NewServer(NewAdminHandler("secret"))
+	defer srv.Close()
+
+	do := func(method, path, body string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal("Error calling admin API", err)
+		}
+		return resp
+	}
+
+	// requests without the token are rejected
+	resp, _ := http.Get(srv.URL + "/tables")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Error("Expected unauthorized response", resp.StatusCode)
+	}
+
+	if resp := do("PUT", "/tables/testAdminHandler/keys/"+k+"?ttl=1m", v); resp.StatusCode != http.StatusNoContent {
+		t.Error("Error setting key", resp.StatusCode)
+	}
+	if ttl, _ := table.TTL(k); ttl <= 0 {
+		t.Error("Error applying ttl from admin API")
+	}
+
+	var item map[string]interface{}
+	resp = do("GET", "/tables/testAdminHandler/keys/"+k, "")
+	json.NewDecoder(resp.Body).Decode(&item)
+	if resp.StatusCode != http.StatusOK || item["value"] != v || resp.Header.Get("Content-Type") != "application/json" {
+		t.Error("Error getting key", resp.StatusCode, item)
+	}
+
+	var keys []string
+	json.NewDecoder(do("GET", "/tables/testAdminHandler/keys", "").Body).Decode(&keys)
+	if len(keys) != 1 || keys[0] != k {
+		t.Error("Error listing keys", keys)
+	}
+	// keys containing slashes and non string keys are listed as well
+	table.Add("a/b", v, 0)
+	table.Add(7, v, 0)
+	keys = nil
+	json.NewDecoder(do("GET", "/tables/testAdminHandler/keys", "").Body).Decode(&keys)
+	if !reflect.DeepEqual(keys, []string{"7", "a/b", k}) {
+		t.Error("Error listing all keys", keys)
+	}
+	table.Delete("a/b")
+	table.Delete(7)
+
+	var stats map[string]interface{}
+	json.NewDecoder(do("GET", "/tables/testAdminHandler/stats", "").Body).Decode(&stats)
+	if stats["items"].(float64) != 1 {
+		t.Error("Error getting stats", stats)
+	}
+
+	if resp := do("DELETE", "/tables/testAdminHandler/keys/"+k, ""); resp.StatusCode != http.StatusNoContent || table.Exists(k) {
+		t.Error("Error deleting key", resp.StatusCode)
+	}
+	if resp := do("DELETE", "/tables/testAdminHandler/keys/"+k, ""); resp.StatusCode != http.StatusNotFound {
+		t.Error("Expected not found deleting missing key", resp.StatusCode)
+	}
+
+	table.Add(k, v, 0)
+	if resp := do("POST", "/tables/testAdminHandler/flush", ""); resp.StatusCode != http.StatusNoContent || table.Count() != 0 {
+		t.Error("Error flushing table", resp.StatusCode)
+	}
+	if resp := do("GET", "/tables/missingTable/keys", ""); resp.StatusCode != http.StatusNotFound {
+		t.Error("Expected not found for missing table", resp.StatusCode)
+	}
+}
+
+type fakeClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.Lock()
+	c.now = c.now.Add(d)
+	c.Unlock()
+}
+
+func TestOptions(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	l := &testLogger{}
+	table := Cache("testOptions",
+		WithDefaultLifeSpan(time.Hour),
+		WithClock(clock),
+		WithLogger(l),
+		WithStats(false),
+	)
+
+	p := table.AddDefault(k, v)
+	if p.LifeSpan() != time.Hour || !p.CreateTime().Equal(time.Unix(1000, 0)) {
+		t.Error("Error applying creation options")
+	}
+
+	// expiration follows the injected clock
+	clock.Advance(2 * time.Hour)
+	if p.TTL() != 0 || table.DeleteExpired() != 1 {
+		t.Error("Error expiring item with fake clock")
+	}
+
+	table.Value(k)
+	if table.Stats() != (Stats{}) {
+		t.Error("Stats should be disabled")
+	}
+	l.Lock()
+	if len(l.records) == 0 {
+		t.Error("Logger option not applied")
+	}
+	l.Unlock()
+
+	// options are ignored for existing tables
+	if Cache("testOptions", WithDefaultLifeSpan(time.Second)).AddDefault(k, v).LifeSpan() != time.Hour {
+		t.Error("Options should only apply at creation time")
+	}
+}
+
+func TestMaxItems(t *testing.T) {
+	var evicted []interface{}
+	table := Cache("testMaxItems", WithMaxItems(2))
+	table.SetDeleteItemReasonCallback(func(item *CacheItem, reason DeleteReason) {
+		if reason == ReasonEvicted {
+			evicted = append(evicted, item.Key())
+		}
+	})
+
+	table.Add(k+"_1", v, 0).Pin()
+	table.Add(k+"_2", v, 0)
+	time.Sleep(time.Millisecond)
+	table.Add(k+"_3", v, 0)
+	time.Sleep(time.Millisecond)
+	table.Value(k + "_3")
+	table.Add(k+"_4", v, 0)
+
+	// pinned items survive, the least recently accessed unpinned item goes first
+	if table.Count() != 2 || !table.Exists(k+"_1") || !table.Exists(k+"_4") {
+		t.Error("Error evicting items", table.Keys())
+	}
+	if !reflect.DeepEqual(evicted, []interface{}{k + "_2", k + "_3"}) || table.Stats().Evictions != 2 {
+		t.Error("Unexpected evictions", evicted)
+	}
+}
+
+func TestShards(t *testing.T) {
+	table := Cache("testShards", WithShards(8))
+	if len(table.shards) != 8 {
+		t.Fatal("Shards option not applied")
+	}
+	if Cache("testShardsMin", WithShards(0)).shards == nil {
+		t.Fatal("Expected at least one shard")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := strconv.Itoa(i*100 + j)
+				table.Add(key, v, 0)
+				table.Value(key)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if table.Count() != 800 || len(table.Keys()) != 800 {
+		t.Error("Unexpected item count", table.Count())
+	}
+
+	// keys moving between shards keep their item
+	for i := 0; i < 800; i++ {
+		if err := table.Rename(strconv.Itoa(i), i); err != nil {
+			t.Fatal("Error renaming item", err)
+		}
+	}
+	if item, err := table.Value(42); err != nil || item.Key() != 42 || table.Count() != 800 {
+		t.Error("Error finding renamed item")
+	}
+
+	// equal keys have to land in the same shard
+	table.Add(0.0, v, 0)
+	if negZero := math.Copysign(0, -1); !table.Exists(negZero) {
+		t.Error("Expected -0 and 0 to be the same key")
+	}
+	type pair struct{ a, b int }
+	table.Add(pair{1, 2}, v, 0)
+	if !table.Exists(pair{1, 2}) {
+		t.Error("Error finding struct key")
+	}
+}
+
+func TestMostAccessedTopK(t *testing.T) {
+	table := Cache("testMostAccessedTopK", WithShards(4))
+	for i := 0; i < 50; i++ {
+		table.Add(i, v, 0)
+		for j := 0; j < i%10; j++ {
+			table.Value(i)
+		}
+	}
+
+	ma := table.MostAccessed(5)
+	if len(ma) != 5 {
+		t.Fatal("MostAccessed returns incorrect amount of items", len(ma))
+	}
+	for _, item := range ma {
+		if item.AccessedCount() != 9 {
+			t.Error("Expected only the most accessed items", item.Key())
+		}
+	}
+	ma = table.MostAccessed(100)
+	if len(ma) != 50 {
+		t.Error("MostAccessed returns incorrect amount of items", len(ma))
+	}
+	for i := 1; i < len(ma); i++ {
+		if ma[i].AccessedCount() > ma[i-1].AccessedCount() {
+			t.Error("Most accessed items seem to be sorted incorrectly")
+		}
+	}
+	if len(table.MostAccessed(0)) != 0 {
+		t.Error("Expected no items for count 0")
+	}
+}
+
+func TestLeastAccessed(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	table := Cache("testLeastAccessed", WithClock(clock))
+	for i := 0; i < 10; i++ {
+		table.Add(i, v, 0)
+		clock.Advance(time.Second)
+	}
+	// access in reverse order so access counts and times disagree
+	for i := 9; i >= 0; i-- {
+		for j := 0; j < i; j++ {
+			table.Value(i)
+		}
+		clock.Advance(time.Second)
+	}
+
+	la := table.LeastAccessed(3)
+	if len(la) != 3 || la[0].Key() != 0 || la[1].Key() != 1 || la[2].Key() != 2 {
+		t.Error("Least accessed items seem to be sorted incorrectly", la)
+	}
+	// item 0 was never accessed, after that the highest keys were accessed first
+	lr := table.LeastRecentlyAccessed(3)
+	if len(lr) != 3 || lr[0].Key() != 0 || lr[1].Key() != 9 || lr[2].Key() != 8 {
+		t.Error("Least recently accessed items seem to be sorted incorrectly", lr)
+	}
+	if len(table.LeastAccessed(0)) != 0 || len(table.LeastAccessed(20)) != 10 {
+		t.Error("LeastAccessed returns incorrect amount of items")
+	}
+}
+
+func TestOldestItems(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	table := Cache("testOldestItems", WithClock(clock))
+	for i := 0; i < 10; i++ {
+		table.Add(i, v, 0)
+		clock.Advance(time.Second)
+	}
+	// accessing or replacing an item does not change its age
+	table.Value(0)
+	table.Replace(1, v, 0)
+
+	oldest := table.OldestItems(3)
+	if len(oldest) != 3 || oldest[0].Key() != 0 || oldest[1].Key() != 1 || oldest[2].Key() != 2 {
+		t.Error("Oldest items seem to be sorted incorrectly", oldest)
+	}
+
+	older := table.ItemsOlderThan(7 * time.Second)
+	keys := make([]int, 0, len(older))
+	for _, item := range older {
+		keys = append(keys, item.Key().(int))
+	}
+	sort.Ints(keys)
+	if !reflect.DeepEqual(keys, []int{0, 1, 2}) {
+		t.Error("Unexpected items older than 7s", keys)
+	}
+	if len(table.ItemsOlderThan(time.Hour)) != 0 {
+		t.Error("Expected no items older than an hour")
+	}
+}
+
+func TestMostAccessedSince(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	table := Cache("testMostAccessedSince", WithClock(clock), WithAccessRateWindow(time.Minute))
+	table.Add("old", v, 0)
+	table.Add("new", v, 0)
+	for i := 0; i < 10; i++ {
+		table.Value("old")
+	}
+	clock.Advance(30 * time.Second)
+	for i := 0; i < 3; i++ {
+		table.Value("new")
+	}
+
+	item, _ := table.Value("old")
+	if c := item.AccessCountSince(time.Minute); c != 11 {
+		t.Error("Unexpected access count in the last minute", c)
+	}
+	if c := item.AccessCountSince(10 * time.Second); c != 1 {
+		t.Error("Unexpected access count in the last 10s", c)
+	}
+	// "old" has the higher total but "new" is hotter in the recent window
+	ma := table.MostAccessedSince(10*time.Second, 1)
+	if len(ma) != 1 || ma[0].Key() != "new" {
+		t.Error("Expected the recently accessed item first", ma)
+	}
+
+	// accesses older than the window are forgotten
+	clock.Advance(2 * time.Minute)
+	if c := item.AccessCountSince(time.Hour); c != 0 {
+		t.Error("Expected accesses to expire from the window", c)
+	}
+	table.Value("old")
+	if c := item.AccessCountSince(time.Minute); c != 1 || item.AccessedCount() != 12 {
+		t.Error("Unexpected access counts", c, item.AccessedCount())
+	}
+
+	if Cache("testMostAccessedSinceOff").MostAccessedSince(time.Minute, 1) != nil {
+		t.Error("Expected nil without access rate tracking")
+	}
+}
+
+func TestAccessedCallback(t *testing.T) {
+	table := Cache("testAccessedCallback")
+	item := table.Add(k, v, 0)
+
+	var counts []int64
+	item.AddAccessedCallback(func(key interface{}, count int64) {
+		if key != k {
+			t.Error("Unexpected key in accessed callback", key)
+		}
+		// the item must not be locked while the callback runs
+		item.Data()
+		counts = append(counts, count)
+	})
+	table.Value(k)
+	table.Value(k)
+	if !reflect.DeepEqual(counts, []int64{1, 2}) {
+		t.Error("Unexpected accessed callback calls", counts)
+	}
+
+	calls := 0
+	item.SetAccessedCallback(func(interface{}, int64) { calls++ })
+	table.Value(k)
+	item.RemoveAccessedCallback()
+	table.Value(k)
+	if calls != 1 || len(counts) != 2 {
+		t.Error("Error replacing or removing accessed callbacks")
+	}
+}
+
+func TestRenewCallback(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	table := Cache("testRenewCallback", WithClock(clock))
+	deleted := 0
+	table.SetDeleteItemCallback(func(*CacheItem) { deleted++ })
+
+	renewals := 0
+	item := table.Add(k, v, time.Second)
+	item.SetRenewCallback(func(key interface{}) time.Duration {
+		if key != k {
+			t.Error("Unexpected key in renew callback", key)
+		}
+		renewals++
+		if renewals > 2 {
+			return 0
+		}
+		return time.Minute
+	})
+
+	clock.Advance(2 * time.Second)
+	if table.DeleteExpired() != 0 || !table.Exists(k) || item.LifeSpan() != time.Minute || item.TTL() != time.Minute {
+		t.Error("Expected the item to be renewed")
+	}
+	clock.Advance(2 * time.Minute)
+	table.DeleteExpired()
+	if !table.Exists(k) || renewals != 2 || deleted != 0 {
+		t.Error("Expected the item to be renewed twice")
+	}
+	clock.Advance(2 * time.Minute)
+	if table.DeleteExpired() != 1 || table.Exists(k) || deleted != 1 {
+		t.Error("Expected the item to expire once the callback declines")
+	}
+
+	// the timer driven expiration check renews as well
+	renewed := make(chan struct{}, 1)
+	item = Cache("testRenewCallbackTimer").Add(k, v, 50*time.Millisecond)
+	item.SetRenewCallback(func(interface{}) time.Duration {
+		select {
+		case renewed <- struct{}{}:
+		default:
+		}
+		return time.Hour
+	})
+	select {
+	case <-renewed:
+	case <-time.After(time.Second):
+		t.Fatal("Renew callback not called")
+	}
+	if !Cache("testRenewCallbackTimer").Exists(k) {
+		t.Error("Expected the item to survive expiration")
+	}
+}
+
+func TestRefreshAhead(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	table := Cache("testRefreshAhead", WithClock(clock), WithRefreshAhead(10*time.Second))
+	var loads int32
+	loaded := make(chan struct{}, 1)
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		n := atomic.AddInt32(&loads, 1)
+		defer func() { loaded <- struct{}{} }()
+		return NewCacheItem(key, "value"+strconv.Itoa(int(n)), time.Minute)
+	})
+	table.Add(k, "value0", time.Minute)
+
+	// outside of the refresh window the loader is not used
+	table.Value(k)
+	if atomic.LoadInt32(&loads) != 0 {
+		t.Error("Unexpected refresh outside of the window")
+	}
+
+	clock.Advance(55 * time.Second)
+	item, err := table.Value(k)
+	if err != nil || item.Data() != "value0" {
+		t.Error("Expected the current value while refreshing", err)
+	}
+	select {
+	case <-loaded:
+	case <-time.After(time.Second):
+		t.Fatal("Loader not called for refresh")
+	}
+	// wait for the refresh goroutine to finish updating the item
+	for i := 0; i < 100 && item.Data() != "value1"; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if item.Data() != "value1" || item.TTL() != time.Minute {
+		t.Error("Expected the item to be refreshed", item.Data(), item.TTL())
+	}
+	if s := table.Stats(); s.Loads != 1 || s.Misses != 0 {
+		t.Error("Unexpected stats after refresh", s)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	table := Cache("testStaleWhileRevalidate", WithClock(clock), WithStaleWhileRevalidate(time.Minute))
+	var loads int32
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		n := atomic.AddInt32(&loads, 1)
+		return NewCacheItem(key, "value"+strconv.Itoa(int(n)), time.Second)
+	})
+	item := table.Add(k, "value0", time.Second)
+
+	// expired items are kept for the stale period
+	clock.Advance(30 * time.Second)
+	if table.DeleteExpired() != 0 {
+		t.Error("Expected stale item to be kept")
+	}
+	r, err := table.Value(k)
+	if err != nil || r != item || r.Data() != "value0" {
+		t.Error("Expected stale data to be returned", err)
+	}
+	for i := 0; i < 100 && item.Data() == "value0"; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if item.Data() != "value1" || item.TTL() != time.Second {
+		t.Error("Expected stale item to be refreshed in the background", item.Data())
+	}
+
+	// past the staleness cap callers block on the loader
+	clock.Advance(2 * time.Minute)
+	r, err = table.Value(k)
+	if err != nil || r.Data() != "value2" || atomic.LoadInt32(&loads) != 2 {
+		t.Error("Expected a synchronous load past the staleness cap", err)
+	}
+	if cur, _ := table.Value(k); cur == item || cur.Data() != "value2" {
+		t.Error("Expected the stale item to be replaced")
+	}
+	clock.Advance(2 * time.Minute)
+	if table.DeleteExpired() != 1 {
+		t.Error("Expected items to expire past the staleness cap")
+	}
+}
+
+func TestValueAsync(t *testing.T) {
+	table := Cache("testValueAsync", WithAsyncLoaders(2, 3))
+	if _, err := table.ValueAsync(k).Wait(context.Background()); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("Expected ErrCacheNotFound without a loader", err)
+	}
+
+	release := make(chan struct{})
+	var running, maxRunning int32
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		return NewCacheItem(key, v, 0)
+	})
+
+	futures := make([]*Future, 5)
+	for i := range futures {
+		futures[i] = table.ValueAsync(i)
+	}
+	// callers are not blocked by the loader
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	if _, err := futures[0].Wait(ctx); err != context.DeadlineExceeded {
+		t.Error("Expected the wait to time out", err)
+	}
+	cancel()
+	// the queue is full, further misses fail fast
+	if _, err := table.ValueAsync(5).Wait(context.Background()); !errors.Is(err, ErrLoaderBusy) {
+		t.Error("Expected ErrLoaderBusy with a full queue", err)
+	}
+
+	close(release)
+	for i, f := range futures {
+		item, err := f.Wait(context.Background())
+		if err != nil || item.Key() != i {
+			t.Error("Error loading item asynchronously", err)
+		}
+	}
+	if atomic.LoadInt32(&maxRunning) > 2 {
+		t.Error("Too many concurrent loaders", maxRunning)
+	}
+
+	// hits resolve immediately
+	f := table.ValueAsync(0)
+	select {
+	case <-f.Done():
+	default:
+		t.Error("Expected a resolved future for a hit")
+	}
+}
+
+func TestLoaderLimits(t *testing.T) {
+	table := Cache("testLoaderTimeout", WithLoaderTimeout(10*time.Millisecond))
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		time.Sleep(100 * time.Millisecond)
+		return NewCacheItem(key, v, 0)
+	})
+	if _, err := table.Value(k); !errors.Is(err, ErrLoaderTimeout) {
+		t.Error("Expected ErrLoaderTimeout", err)
+	}
+	if table.Stats().LoadFailures != 1 {
+		t.Error("Expected the timeout to count as a load failure")
+	}
+
+	release := make(chan struct{})
+	loader := func(key interface{}, args ...interface{}) *CacheItem {
+		<-release
+		return NewCacheItem(key, v, 0)
+	}
+	busy := Cache("testLoaderFailFast", WithLoaderLimit(1, true))
+	busy.SetDataLoader(loader)
+	queued := Cache("testLoaderQueued", WithLoaderLimit(1, false))
+	queued.SetDataLoader(loader)
+
+	busyFuture := busy.ValueAsync(1)
+	queuedFuture := queued.ValueAsync(1)
+	// wait until both loaders hold their slot
+	for len(busy.loaderSlots) == 0 || len(queued.loaderSlots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := busy.Value(2); !errors.Is(err, ErrLoaderBusy) {
+		t.Error("Expected ErrLoaderBusy", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	if _, err := queued.ValueContext(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Expected queued load to honour the context", err)
+	}
+	cancel()
+
+	queuedFuture2 := queued.ValueAsync(3)
+	close(release)
+	for _, f := range []*Future{busyFuture, queuedFuture, queuedFuture2} {
+		if _, err := f.Wait(context.Background()); err != nil {
+			t.Error("Error loading item", err)
+		}
+	}
+}
+
+func TestTypedAccessors(t *testing.T) {
+	table := Cache("testTypedAccessors")
+	table.Add("s", "str", 0)
+	table.Add("i", 42, 0)
+	table.Add("b", []byte("bytes"), 0)
+
+	if s, err := table.GetString("s"); err != nil || s != "str" {
+		t.Error("Error getting string", err)
+	}
+	if i, err := table.GetInt("i"); err != nil || i != 42 {
+		t.Error("Error getting int", err)
+	}
+	if b, err := table.GetBytes("b"); err != nil || string(b) != "bytes" {
+		t.Error("Error getting bytes", err)
+	}
+	if _, err := table.GetInt("missing"); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("Expected ErrCacheNotFound", err)
+	}
+
+	_, err := table.GetInt("s")
+	var typeErr *TypeError
+	if !errors.As(err, &typeErr) || typeErr.Key != "s" || typeErr.Got != reflect.TypeOf("") || typeErr.Want != reflect.TypeOf(0) {
+		t.Error("Expected a TypeError", err)
+	}
+
+	item, _ := table.Value("i")
+	if _, err := DataAs[fmt.Stringer](item); !errors.As(err, &typeErr) || typeErr.Want.Kind() != reflect.Interface {
+		t.Error("Expected a TypeError for interface types", err)
+	}
+	if n, err := DataAs[int](item); err != nil || n != 42 {
+		t.Error("Error converting item data", err)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	table := Cache("testNamespace")
+	users := table.Namespace("user:")
+	orders := table.Namespace("order:")
+	table.Add(1, v, 0)
+
+	users.Add("1", "alice", 0)
+	users.Add("2", "bob", 0)
+	orders.Add("1", "book", 0)
+
+	if item, err := users.Value("1"); err != nil || item.Data() != "alice" || item.Key() != "user:1" {
+		t.Error("Error reading namespaced item", err)
+	}
+	if !table.Exists("order:1") || orders.Exists("2") {
+		t.Error("Namespaced keys should be prefixed")
+	}
+	keys := users.Keys()
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"1", "2"}) || orders.Count() != 1 {
+		t.Error("Unexpected namespaced keys", keys)
+	}
+	visited := 0
+	orders.Foreach(func(key string, item *CacheItem) {
+		visited++
+		if key != "1" {
+			t.Error("Unexpected key in namespace", key)
+		}
+	})
+	if visited != 1 {
+		t.Error("Error iterating namespace")
+	}
+
+	var reasons []DeleteReason
+	table.SetDeleteItemReasonCallback(func(item *CacheItem, reason DeleteReason) {
+		reasons = append(reasons, reason)
+	})
+	if users.Flush() != 2 || users.Count() != 0 || table.Count() != 2 {
+		t.Error("Flush should only remove items in the namespace")
+	}
+	if !reflect.DeepEqual(reasons, []DeleteReason{ReasonFlushed, ReasonFlushed}) {
+		t.Error("Unexpected delete reasons", reasons)
+	}
+
+	nested := orders.Namespace("eu:")
+	nested.Add("1", v, 0)
+	if nested.Prefix() != "order:eu:" || !table.Exists("order:eu:1") || orders.Count() != 2 {
+		t.Error("Error creating nested namespace")
+	}
+
+	// overlapping prefixes are kept apart by the separator
+	single, plural := table.Namespace("user"), table.Namespace("users")
+	single.Add("1", v, 0)
+	plural.Add("1", v, 0)
+	if single.Prefix() != "user:" || single.Count() != 1 || plural.Count() != 1 || !table.Exists("users:1") {
+		t.Error("Overlapping namespaces should not share items", single.Count(), plural.Count())
+	}
+	if single.Flush() != 1 || !plural.Exists("1") {
+		t.Error("Flush should not remove items of an overlapping namespace")
+	}
+}
+
+func TestTx(t *testing.T) {
+	table := Cache("testTx")
+	table.Add("user:1", "alice", 0)
+	table.Add("index:alice", "user:1", 0)
+
+	var added []interface{}
+	table.SetAddedItemCallback(func(item *CacheItem) {
+		added = append(added, item.Key())
+	})
+
+	// a failing transaction leaves the table untouched
+	errAbort := errors.New("abort")
+	err := table.Tx(func(tx *Txn) error {
+		tx.Set("user:1", "bob", 0)
+		tx.Delete("index:alice")
+		if data, ok := tx.Get("user:1"); !ok || data != "bob" {
+			t.Error("Expected to read uncommitted writes")
+		}
+		if tx.Exists("index:alice") {
+			t.Error("Expected uncommitted delete to be visible")
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Error("Expected the transaction error", err)
+	}
+	if item, _ := table.Value("user:1"); item.Data() != "alice" || !table.Exists("index:alice") || len(added) != 0 {
+		t.Error("Aborted transaction should not change the table")
+	}
+
+	err = table.Tx(func(tx *Txn) error {
+		old, _ := tx.Get("user:1")
+		tx.Set("user:1", "bob", 0)
+		tx.Delete("index:" + old.(string))
+		tx.Set("index:bob", "user:1", 0)
+		// callbacks are deferred until commit
+		if len(added) != 0 {
+			t.Error("Callbacks should not run before commit")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error("Error committing transaction", err)
+	}
+	if item, _ := table.Value("user:1"); item.Data() != "bob" || table.Exists("index:alice") || !table.Exists("index:bob") {
+		t.Error("Transaction was not applied")
+	}
+	if !reflect.DeepEqual(added, []interface{}{"user:1", "index:bob"}) {
+		t.Error("Unexpected added callbacks", added)
+	}
+
+	// a panic releases the table lock
+	func() {
+		defer func() { recover() }()
+		table.Tx(func(tx *Txn) error {
+			tx.Set("user:1", "carol", 0)
+			panic("boom")
+		})
+	}()
+	if item, _ := table.Value("user:1"); item.Data() != "bob" {
+		t.Error("Panicking transaction should not change the table")
+	}
+}
+
+func TestAddIfVersion(t *testing.T) {
+	table := Cache("testAddIfVersion")
+	item, err := table.AddIfVersion(k, "v1", 0)
+	if err != nil || item.Version() == 0 {
+		t.Fatal("Error adding missing item with version 0", err)
+	}
+	if _, err := table.AddIfVersion(k, "v1", 0); !errors.Is(err, ErrVersionMismatch) {
+		t.Error("Expected ErrVersionMismatch for an existing item", err)
+	}
+
+	version := item.Version()
+	updated, err := table.AddIfVersion(k, "v2", version)
+	if err != nil || updated != item || item.Data() != "v2" || item.Version() <= version {
+		t.Error("Error updating item with matching version", err)
+	}
+	// the old version is stale now
+	if _, err := table.AddIfVersion(k, "v3", version); !errors.Is(err, ErrVersionMismatch) || item.Data() != "v2" {
+		t.Error("Expected ErrVersionMismatch for a stale version", err)
+	}
+
+	// every modification increases the version
+	version = item.Version()
+	table.Update(k, func(old interface{}) (interface{}, bool) { return "v4", true })
+	if item.Version() <= version {
+		t.Error("Update should increase the version")
+	}
+	version = item.Version()
+	if replaced := table.Add(k, "v5", 0); replaced.Version() <= version {
+		t.Error("Replacing an item should increase the version")
+	}
+	if _, err := table.AddIfVersion("missing", v, 1); !errors.Is(err, ErrVersionMismatch) {
+		t.Error("Expected ErrVersionMismatch for a missing item", err)
+	}
+}
+
+func TestTags(t *testing.T) {
+	table := Cache("testTags")
+	table.AddWithTags("profile:1", v, 0, "user:1")
+	table.AddWithTags("avatar:1", v, 0, "user:1", "images")
+	table.AddWithTags("avatar:2", v, 0, "user:2", "images")
+	table.Add("other", v, 0)
+
+	item, _ := table.Value("avatar:1")
+	if !reflect.DeepEqual(item.Tags(), []string{"user:1", "images"}) || !item.HasTag("images") || item.HasTag("user:2") {
+		t.Error("Unexpected item tags", item.Tags())
+	}
+	if len(table.ItemsByTag("images")) != 2 || len(table.ItemsByTag("missing")) != 0 {
+		t.Error("Unexpected items by tag")
+	}
+
+	deleted := 0
+	table.SetDeleteItemCallback(func(*CacheItem) { deleted++ })
+	if table.DeleteByTag("user:1") != 2 || deleted != 2 {
+		t.Error("Error deleting items by tag")
+	}
+	if table.Exists("profile:1") || table.Exists("avatar:1") || !table.Exists("avatar:2") || !table.Exists("other") {
+		t.Error("DeleteByTag removed the wrong items")
+	}
+}
+
+func TestTinyLFU(t *testing.T) {
+	table := Cache("testTinyLFU", WithMaxItems(3), WithTinyLFU())
+	for i := 0; i < 3; i++ {
+		table.Add(i, v, 0)
+		for j := 0; j < 5; j++ {
+			table.Value(i)
+		}
+	}
+
+	// a scan of one-hit keys must not push out the hot items
+	for i := 100; i < 200; i++ {
+		table.Add(i, v, 0)
+	}
+	for i := 0; i < 3; i++ {
+		if !table.Exists(i) {
+			t.Error("Hot item was evicted by a scan", i)
+		}
+	}
+	if s := table.Stats(); s.Rejections != 100 || s.Evictions != 0 {
+		t.Error("Unexpected admission stats", s.Rejections, s.Evictions)
+	}
+
+	// a key that is requested often enough is admitted
+	for j := 0; j < 10; j++ {
+		table.Value("popular")
+	}
+	table.Add("popular", v, 0)
+	if !table.Exists("popular") || table.Count() != 3 {
+		t.Error("Frequent key should be admitted")
+	}
+	// replacing an existing key is always allowed
+	table.Add("popular", "new", 0)
+	if item, _ := table.Value("popular"); item.Data() != "new" {
+		t.Error("Existing keys should bypass admission")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	type user struct {
+		name string
+		city string
+	}
+	table := Cache("testIndex")
+	table.Add(1, user{"alice", "paris"}, 0)
+	table.AddIndex("city", func(item *CacheItem) []string {
+		return []string{item.Data().(user).city}
+	})
+	table.Add(2, user{"bob", "paris"}, 0)
+	table.Add(3, user{"carol", "berlin"}, 0)
+
+	keysOf := func(items []*CacheItem) []int {
+		keys := make([]int, 0, len(items))
+		for _, item := range items {
+			keys = append(keys, item.Key().(int))
+		}
+		sort.Ints(keys)
+		return keys
+	}
+	if keys := keysOf(table.ByIndex("city", "paris")); !reflect.DeepEqual(keys, []int{1, 2}) {
+		t.Error("Unexpected index lookup", keys)
+	}
+
+	// the index follows deletes, replacements, updates and renames
+	table.Delete(1)
+	table.Add(2, user{"bob", "berlin"}, 0)
+	table.Replace(3, user{"carol", "rome"}, 0)
+	if keys := keysOf(table.ByIndex("city", "berlin")); !reflect.DeepEqual(keys, []int{2}) {
+		t.Error("Index not maintained", keys)
+	}
+	if len(table.ByIndex("city", "paris")) != 0 {
+		t.Error("Expected deleted items to leave the index")
+	}
+	table.Rename(3, 4)
+	if keys := keysOf(table.ByIndex("city", "rome")); !reflect.DeepEqual(keys, []int{4}) {
+		t.Error("Index not maintained on rename", keys)
+	}
+
+	table.Flush()
+	if len(table.ByIndex("city", "berlin")) != 0 || table.ByIndex("missing", "x") != nil {
+		t.Error("Unexpected index entries after flush")
+	}
+	table.RemoveIndex("city")
+	if table.ByIndex("city", "rome") != nil {
+		t.Error("Expected removed index to return nil")
+	}
+}
+
+func TestExpiryHeap(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	table := Cache("testExpiryHeap", WithClock(clock))
+	heapLen := func() int {
+		table.expiry.Lock()
+		defer table.expiry.Unlock()
+		return len(table.expiry.heap)
+	}
+
+	for i := 0; i < 100; i++ {
+		table.Add(i, v, time.Duration(i+1)*time.Second)
+	}
+	table.Add("forever", v, 0)
+	// replacing or deleting items keeps a single heap entry per item
+	for i := 0; i < 10; i++ {
+		table.Add(0, v, time.Second)
+	}
+	table.Delete(99)
+	if n := heapLen(); n != 99 {
+		t.Error("Unexpected expiry heap size", n)
+	}
+
+	// accessing an item moves its real deadline without touching the heap
+	clock.Advance(1500 * time.Millisecond)
+	table.Value(1)
+	if n := table.DeleteExpired(); n != 1 || table.Exists(0) || !table.Exists(1) {
+		t.Error("Expected only the due item to expire", n)
+	}
+	clock.Advance(1900 * time.Millisecond)
+	if n := table.DeleteExpired(); n != 1 || !table.Exists(1) || table.Exists(2) {
+		t.Error("Expected the accessed item to be kept", n)
+	}
+
+	// shrinking a lifespan moves the item to the front
+	item, _ := table.Value(50)
+	item.SetLifeSpan(time.Millisecond)
+	clock.Advance(time.Millisecond)
+	if table.DeleteExpired() != 1 || table.Exists(50) {
+		t.Error("Expected the shrunk item to expire")
+	}
+
+	table.Flush()
+	if n := heapLen(); n != 0 {
+		t.Error("Expected flush to clear the expiry heap", n)
+	}
+}
+
+func TestForeachUntil(t *testing.T) {
+	table := Cache("testForeachUntil", WithShards(4))
+	for i := 0; i < 100; i++ {
+		table.Add(i, v, 0)
+	}
+	visited := 0
+	table.ForeachUntil(func(key interface{}, item *CacheItem) bool {
+		visited++
+		return visited < 10
+	})
+	if visited != 10 {
+		t.Error("Expected iteration to stop early", visited)
+	}
+	visited = 0
+	table.ForeachUntil(func(interface{}, *CacheItem) bool {
+		visited++
+		return true
+	})
+	if visited != 100 {
+		t.Error("Expected a full iteration", visited)
+	}
+	// the shard lock is released after stopping
+	table.ForeachUntil(func(interface{}, *CacheItem) bool { return false })
+	table.Add(100, v, 0)
+}
+
+func TestForeachParallel(t *testing.T) {
+	table := Cache("testForeachParallel", WithShards(8))
+	for i := 0; i < 1000; i++ {
+		table.Add(i, i, 0)
+	}
+	for _, workers := range []int{0, 1, 4, 100} {
+		var sum, visited int64
+		table.ForeachParallel(workers, func(key interface{}, item *CacheItem) {
+			atomic.AddInt64(&sum, int64(item.Data().(int)))
+			atomic.AddInt64(&visited, 1)
+		})
+		if visited != 1000 || sum != 999*1000/2 {
+			t.Error("Unexpected parallel iteration result", workers, visited, sum)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	table := Cache("testSnapshot")
+	table.Add(1, "one", time.Minute)
+	table.Add(2, "two", 0)
+	table.Value(1)
+
+	s := table.Snapshot()
+	table.Add(3, "three", 0)
+	table.Delete(2)
+	table.Replace(1, "uno", 0)
+
+	if s.Len() != 2 || len(s.Keys()) != 2 {
+		t.Error("Snapshot should not see later writes", s.Len())
+	}
+	item, ok := s.Get(1)
+	if !ok || item.Data != "one" || item.LifeSpan != time.Minute || item.AccessCount != 1 || item.Version == 0 {
+		t.Error("Unexpected snapshot item", item)
+	}
+	if _, ok := s.Get(2); !ok {
+		t.Error("Deleted item should still be in the snapshot")
+	}
+	visited := 0
+	s.Foreach(func(item SnapshotItem) {
+		// the table can be used while iterating a snapshot
+		table.Exists(item.Key)
+		visited++
+	})
+	if visited != 2 || s.Time().IsZero() {
+		t.Error("Error iterating snapshot")
+	}
+}
+
+func TestCompression(t *testing.T) {
+	table := Cache("testCompression", WithCompression(GzipCodec{}, 64))
+	large := strings.Repeat("cache2go", 100)
+	table.Add("large", large, 0)
+	table.Add("bytes", []byte(large), 0)
+	table.Add("small", "tiny", 0)
+	table.Add("int", 42, 0)
+
+	item, err := table.Value("large")
+	if err != nil || item.Data() != large {
+		t.Error("Compressed string should be returned unchanged", err)
+	}
+	item, _ = table.Value("bytes")
+	if b, ok := item.Data().([]byte); !ok || string(b) != large {
+		t.Error("Compressed bytes should be returned unchanged")
+	}
+	item, _ = table.Value("small")
+	if _, ok := item.data.(string); !ok {
+		t.Error("Values below the threshold should not be compressed")
+	}
+
+	stats := table.CompressionStats()
+	if stats.Values != 2 || stats.OriginalBytes != int64(2*len(large)) || stats.Ratio() <= 0 || stats.Ratio() >= 1 {
+		t.Error("Unexpected compression stats", stats)
+	}
+
+	table.Replace("small", large, 0)
+	item, _ = table.Value("small")
+	if _, ok := item.data.(*encodedValue); !ok || item.Data() != large {
+		t.Error("Replaced value should be compressed")
+	}
+	if table.CompressionStats().Values != 3 {
+		t.Error("Replace should count towards compression stats")
+	}
+}
+
+type sizedValue struct{}
+
+func (sizedValue) Size() int { return 1000 }
+
+func TestMemoryUsage(t *testing.T) {
+	table := Cache("testMemoryUsage")
+	if table.MemoryUsage() != 0 {
+		t.Error("Empty table should use no memory")
+	}
+	table.Add("sized", sizedValue{}, 0)
+	base := table.MemoryUsage()
+	if base != itemOverhead+int64(len("sized"))+1000 {
+		t.Error("Sizer should be used for the value size", base)
+	}
+
+	type node struct {
+		Name string
+		Next *node
+	}
+	n := &node{Name: strings.Repeat("x", 100)}
+	n.Next = n
+	table.Add("cycle", n, 0)
+	table.Add("map", map[string][]int{"a": make([]int, 10)}, 0)
+	usage := table.MemoryUsage()
+	if usage <= base+200 {
+		t.Error("Reflection fallback should account for referenced memory", usage)
+	}
+	table.Delete("cycle")
+	table.Delete("map")
+	if table.MemoryUsage() != base {
+		t.Error("Deleted items should no longer be counted")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	table := Cache("testRateLimit", WithClock(clock), WithRateLimit(1, 2, true))
+	table.Add(k, v, 0)
+	table.Add("other", v, 0)
+	for i := 0; i < 2; i++ {
+		if _, err := table.Value(k); err != nil {
+			t.Error("Requests within the burst should be allowed", err)
+		}
+	}
+	if _, err := table.Value(k); !errors.Is(err, ErrRateLimited) {
+		t.Error("Expected ErrRateLimited, got", err)
+	}
+	if _, err := table.Value("other"); err != nil {
+		t.Error("Other keys should have their own bucket", err)
+	}
+	clock.Advance(time.Second)
+	if _, err := table.Value(k); err != nil {
+		t.Error("A token should be refilled after a second", err)
+	}
+
+	shared := Cache("testRateLimitShared", WithClock(clock), WithRateLimit(1, 1, false))
+	shared.Add(k, v, 0)
+	shared.Add("other", v, 0)
+	shared.Value(k)
+	if _, err := shared.Value("other"); !errors.Is(err, ErrRateLimited) {
+		t.Error("Table wide limit should apply across keys", err)
+	}
+}
+
+func TestRateLimitBucketsBounded(t *testing.T) {
+	// buckets never refill within the test, so pruning alone cannot free any
+	l := &rateLimiter{rate: 0.001, burst: 1, perKey: true, buckets: make(map[interface{}]*tokenBucket)}
+	now := time.Unix(1000, 0)
+	for i := 0; i < maxRateLimitBuckets+100; i++ {
+		l.allow(i, now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if len(l.buckets) > maxRateLimitBuckets {
+		t.Error("Expected the number of buckets to stay bounded", len(l.buckets))
+	}
+	if _, ok := l.buckets[0]; ok {
+		t.Error("Expected the least recently used bucket to be evicted")
+	}
+	if _, ok := l.buckets[maxRateLimitBuckets+99]; !ok {
+		t.Error("Expected the newest bucket to be kept")
+	}
+}
+
+type mapStore struct {
+	mu   sync.Mutex
+	data map[interface{}]interface{}
+	gets int
+}
+
+func (s *mapStore) Get(key interface{}) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gets++
+	if v, ok := s.data[key]; ok {
+		return v, nil
+	}
+	return nil, ErrCacheNotFound
+}
+
+func (s *mapStore) Set(key, data interface{}, lifeSpan time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = data
+	return nil
+}
+
+func (s *mapStore) Delete(key interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	store := &mapStore{data: map[interface{}]interface{}{"backed": "from store"}}
+	table := Cache("testStore", WithStore(store))
+
+	item, err := table.Value("backed")
+	if err != nil || item.Data() != "from store" || !table.Exists("backed") {
+		t.Error("Miss should fall through to the store", err)
+	}
+	table.Value("backed")
+	if store.gets != 1 {
+		t.Error("Hit should not access the store", store.gets)
+	}
+	if _, err := table.Value("missing"); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("Expected ErrCacheNotFound, got", err)
+	}
+
+	table.Add(k, v, 0)
+	table.Replace("backed", "replaced", 0)
+	table.Update(k, func(old interface{}) (interface{}, bool) { return old.(string) + "!", true })
+	if store.data[k] != v+"!" || store.data["backed"] != "replaced" {
+		t.Error("Writes should propagate to the store", store.data)
+	}
+
+	table.Flush()
+	if len(store.data) != 2 {
+		t.Error("Flush should only clear the table")
+	}
+	if _, err := table.Delete("backed"); err != nil || store.data["backed"] != nil {
+		t.Error("Delete should remove the key from the store", err)
+	}
+	table.DeleteAll(k)
+	if len(store.data) != 0 {
+		t.Error("DeleteAll should remove keys from the store", store.data)
+	}
+}
+
+func TestStoreBulkAndPop(t *testing.T) {
+	store := &mapStore{data: map[interface{}]interface{}{}}
+	table := Cache("testStoreBulkAndPop", WithStore(store))
+
+	table.AddAll(map[interface{}]interface{}{"a": 1, "b": 2}, 0)
+	if store.data["a"] != 1 || store.data["b"] != 2 {
+		t.Error("AddAll should propagate to the store", store.data)
+	}
+	table.AddWithTags("tagged", 3, 0, "t")
+	table.Tx(func(tx *Txn) error {
+		tx.Set("tx", 4, 0)
+		tx.Delete("b")
+		return nil
+	})
+	if store.data["tagged"] != 3 || store.data["tx"] != 4 || store.data["b"] != nil {
+		t.Error("Tagged and transactional writes should propagate to the store", store.data)
+	}
+
+	if d, err := table.Pop("a"); err != nil || d != 1 {
+		t.Error("Pop should return the removed data", d, err)
+	}
+	if _, ok := store.data["a"]; ok {
+		t.Error("Pop should remove the key from the store")
+	}
+	if _, err := table.Value("a"); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("Popped key should not be read back from the store", err)
+	}
+	if table.DeleteByTag("t") != 1 || store.data["tagged"] != nil {
+		t.Error("DeleteByTag should remove keys from the store", store.data)
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	codec, err := NewAESGCMCodec(1, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewAESGCMCodec(1, []byte("short")); err == nil {
+		t.Error("Invalid key length should be rejected")
+	}
+	table := Cache("testEncryption", WithEncryption(codec), WithCompression(GzipCodec{}, 64))
+	secret := strings.Repeat("secret", 50)
+	table.Add("secret", secret, 0)
+	table.Add("bytes", []byte("token"), 0)
+	table.Add("int", 7, 0)
+
+	item, _ := table.Value("secret")
+	stored, ok := item.data.(*encodedValue)
+	if !ok || stored.compress == nil || bytes.Contains(stored.data, []byte("secret")) {
+		t.Error("Value should be compressed and encrypted in memory")
+	}
+	if item.Data() != secret {
+		t.Error("Encrypted value should be decrypted on read")
+	}
+	if d, _ := table.Value("int"); d.Data() != 7 {
+		t.Error("Non byte values should be stored as is")
+	}
+
+	// rotated keys keep old values readable
+	if err := codec.Rotate(2, bytes.Repeat([]byte{2}, 16)); err != nil {
+		t.Fatal(err)
+	}
+	table.Add("new", "rotated", 0)
+	if item, _ := table.Value("secret"); item.Data() != secret {
+		t.Error("Values encrypted with the old key should still be readable")
+	}
+	if err := codec.RemoveKey(2); !errors.Is(err, ErrCurrentKey) {
+		t.Error("The current key must not be removable", err)
+	}
+
+	var buf bytes.Buffer
+	if err := table.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("token")) {
+		t.Error("Saved data should not contain plaintext")
+	}
+	restored := Cache("testEncryptionRestored", WithEncryption(codec))
+	if err := restored.Load(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := restored.Value("bytes"); string(item.Data().([]byte)) != "token" {
+		t.Error("Loaded data should be decrypted")
+	}
+	if err := Cache("testEncryptionPlain").Load(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrNotEncrypted) {
+		t.Error("Loading encrypted data without a cipher should fail")
+	}
+
+	codec.RemoveKey(1)
+	if _, err := codec.Decode(stored.data); !errors.Is(err, ErrUnknownKey) {
+		t.Error("Expected ErrUnknownKey, got", err)
+	}
+	if _, err := codec.Decode([]byte{0, 0, 0, 2}); !errors.Is(err, ErrInvalidCiphertext) {
+		t.Error("Expected ErrInvalidCiphertext, got", err)
+	}
+
+	// encryption failures are reported and the write is refused
+	var failed []interface{}
+	flaky := &flakyCodec{}
+	broken := Cache("testEncryptionFailure", WithEncryption(flaky), WithErrorHandler(func(err error, _ *CacheTable, key interface{}) {
+		failed = append(failed, key)
+	}))
+	broken.Add("kept", "value", 0)
+	flaky.fail = true
+	broken.Add("secret", "value", 0)
+	if len(failed) != 1 || failed[0] != "secret" || broken.Exists("secret") {
+		t.Error("Expected the failed write to be reported and refused", failed)
+	}
+	if err := broken.Replace("kept", "new", 0); !errors.Is(err, errEncodeFailed) {
+		t.Error("Expected Replace to return the encryption error", err)
+	}
+	if err := broken.Update("kept", func(interface{}) (interface{}, bool) { return "new", true }); !errors.Is(err, errEncodeFailed) {
+		t.Error("Expected Update to return the encryption error", err)
+	}
+	if err := broken.Tx(func(tx *Txn) error { tx.Set("tx", "value", 0); return nil }); !errors.Is(err, errEncodeFailed) || broken.Exists("tx") {
+		t.Error("Expected the transaction to be discarded", err)
+	}
+	flaky.fail = false
+	if item, err := broken.Value("kept"); err != nil || item.Data() != "value" {
+		t.Error("Failed writes should keep the previous data", err)
+	}
+}
+
+var errEncodeFailed = errors.New("encode failed")
+
+// flakyCodec returns the data unchanged, or an error while fail is set
+type flakyCodec struct {
+	fail bool
+}
+
+func (c *flakyCodec) Encode(src []byte) ([]byte, error) {
+	if c.fail {
+		return nil, errEncodeFailed
+	}
+	return src, nil
+}
+
+func (c *flakyCodec) Decode(src []byte) ([]byte, error) { return src, nil }
+
+func TestCallbackPanic(t *testing.T) {
+	var mu sync.Mutex
+	var errs []*CallbackError
+	table := Cache("testCallbackPanic", WithErrorHandler(func(err error, table *CacheTable, key interface{}) {
+		var cbErr *CallbackError
+		if errors.As(err, &cbErr) {
+			mu.Lock()
+			errs = append(errs, cbErr)
+			mu.Unlock()
+		}
+	}))
+	table.SetAddedItemCallback(func(*CacheItem) { panic("added") })
+	table.SetDeleteItemCallback(func(*CacheItem) { panic("deleted") })
+
+	item := table.Add(k, v, 100*time.Millisecond)
+	item.SetAboutToExpireCallback(func(interface{}) { panic("expire") })
+	if !table.Exists(k) {
+		t.Error("A panicking callback should not prevent the add")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if table.Exists(k) {
+		t.Error("A panicking callback should not stop the expiration check")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 3 {
+		t.Fatal("Expected 3 callback errors, got", len(errs))
+	}
+	if errs[0].Callback != CallbackAddedItem || errs[0].Key != k || errs[0].Table != "testCallbackPanic" || len(errs[0].Stack) == 0 {
+		t.Error("Unexpected callback error", errs[0])
+	}
+	if errs[1].Callback != CallbackDeletedItem || errs[2].Callback != CallbackAboutToExpire || errs[2].Panic != "expire" {
+		t.Error("Unexpected callback errors", errs[1], errs[2])
+	}
+}
+
+func TestAsyncCallbacks(t *testing.T) {
+	table := Cache("testAsyncCallbacks", WithAsyncCallbacks(4))
+	release := make(chan struct{})
+	var mu sync.Mutex
+	events := make(map[interface{}][]string)
+	record := func(key interface{}, event string) {
+		mu.Lock()
+		events[key] = append(events[key], event)
+		mu.Unlock()
+	}
+	table.SetAddedItemCallback(func(item *CacheItem) {
+		<-release
+		record(item.Key(), "add")
+	})
+	table.SetDeleteItemCallback(func(item *CacheItem) {
+		record(item.Key(), "delete")
+	})
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 20; i++ {
+			table.Add(i, v, 0)
+			table.Delete(i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Add and Delete should not wait for slow callbacks")
+	}
+	close(release)
+	table.WaitCallbacks()
+
+	// waiting while other goroutines keep submitting callbacks is safe
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(base int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				table.Add(base+j, v, 0)
+			}
+		}(100 * (i + 1))
+		go func() {
+			defer wg.Done()
+			table.WaitCallbacks()
+		}()
+	}
+	wg.Wait()
+	table.WaitCallbacks()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 0; i < 20; i++ {
+		if e := events[i]; len(e) != 2 || e[0] != "add" || e[1] != "delete" {
+			t.Error("Callbacks for a key should run in order", i, e)
+		}
+	}
+	table.Close()
+	table.WaitCallbacks()
+}
+
+func TestErrorValues(t *testing.T) {
+	table := Cache("testErrorValues")
+	_, err := table.Value("missing")
+	var keyErr *KeyError
+	if !errors.Is(err, ErrCacheNotFound) || !errors.As(err, &keyErr) || keyErr.Key != "missing" || keyErr.Table != "testErrorValues" {
+		t.Error("Expected a KeyError wrapping ErrCacheNotFound", err)
+	}
+	if !strings.Contains(err.Error(), "testErrorValues") {
+		t.Error("Error message should contain the table name", err)
+	}
+
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		if key == "panic" {
+			panic("boom")
+		}
+		return nil
+	})
+	_, err = table.Value("absent")
+	if !errors.Is(err, ErrCacheNotFoundOrLoadable) || errors.Is(err, ErrLoaderFailed) {
+		t.Error("A loader returning nil should be reported as absence", err)
+	}
+	_, err = table.Value("panic")
+	var loaderErr *LoaderError
+	if !errors.Is(err, ErrLoaderFailed) || !errors.As(err, &loaderErr) || loaderErr.Key != "panic" {
+		t.Error("A panicking loader should be reported as a loader failure", err)
+	}
+
+	SetLanguage(English)
+	defer SetLanguage(Chinese)
+	if ErrCacheNotFound.Error() != "cache item not found" || !strings.Contains(keyErr.Error(), "(table testErrorValues, key missing)") {
+		t.Error("Unexpected English message", keyErr)
+	}
+	cbErr := &CallbackError{Table: "t", Key: k, Callback: CallbackAddedItem, Panic: "boom"}
+	if msg := cbErr.Error(); msg != CallbackAddedItem+" callback of table t panicked, key="+k+": boom" {
+		t.Error("Unexpected English callback error", msg)
+	}
+	typeErr := &TypeError{Key: k, Want: reflect.TypeOf(0), Got: reflect.TypeOf("")}
+	if msg := typeErr.Error(); msg != "cache item "+k+" has type string, want int" {
+		t.Error("Unexpected English type error", msg)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	table := Cache("testJanitor")
+	table.Add(k, v, 50*time.Millisecond)
+	j := table.janitor
+	if j == nil {
+		t.Fatal("Janitor should start once an item can expire")
+	}
+	table.Add(k+"2", v, 20*time.Millisecond)
+	if table.janitor != j {
+		t.Error("A table should only have one janitor")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if table.Count() != 0 {
+		t.Error("Janitor should expire items", table.Count())
+	}
+	table.Close()
+	select {
+	case <-j.done:
+	default:
+		t.Error("Close should wait for the janitor to exit")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bound := Cache("testJanitorContext", WithContext(ctx))
+	bound.Add(k, v, 0)
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for !bound.Closed() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !bound.Closed() {
+		t.Error("Cancelling the context should close the table")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shutdown.gob")
+	persisted := Cache("testShutdownPersisted", WithPersistFile(path))
+	persisted.Add(k, v, 0)
+
+	slowLoader := func(release chan struct{}) func(interface{}, ...interface{}) *CacheItem {
+		return func(key interface{}, args ...interface{}) *CacheItem {
+			<-release
+			return NewCacheItem(key, v, 0)
+		}
+	}
+	release := make(chan struct{})
+	loading := Cache("testShutdownLoading")
+	loading.SetDataLoader(slowLoader(release))
+	future := loading.ValueAsync(k)
+	time.AfterFunc(20*time.Millisecond, func() { close(release) })
+
+	if err := Shutdown(context.Background()); err != nil {
+		t.Error("Unexpected shutdown error", err)
+	}
+	if !persisted.Closed() || !loading.Closed() || len(Tables()) != 0 {
+		t.Error("Shutdown should close all tables")
+	}
+	select {
+	case <-future.Done():
+	default:
+		t.Error("Shutdown should wait for in-flight loaders")
+	}
+	restored := Cache("testShutdownRestored")
+	if err := restored.LoadFile(path); err != nil || !restored.Exists(k) {
+		t.Error("Tables with a persist file should be saved on shutdown", err)
+	}
+
+	stuck := make(chan struct{})
+	defer close(stuck)
+	blocked := Cache("testShutdownBlocked")
+	blocked.SetDataLoader(slowLoader(stuck))
+	blocked.ValueAsync(k)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Shutdown should give up when the context expires", err)
+	}
+}
+
+type serializedUser struct {
+	Name string
+	Age  int
+}
+
+func TestSerializer(t *testing.T) {
+	user := serializedUser{Name: "alice", Age: 30}
+	for name, s := range map[string]Serializer{"gob": GobSerializer[serializedUser](), "json": JSONSerializer[serializedUser]()} {
+		table := Cache("testSerializer"+name, WithSerializer(s))
+		table.Add("user", user, 0)
+		var buf bytes.Buffer
+		if err := table.Save(&buf); err != nil {
+			t.Fatal(name, err)
+		}
+		if err := Cache("testSerializerPlain" + name).Load(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrNoSerializer) {
+			t.Error("Loading serialized data without a serializer should fail", name, err)
+		}
+		restored := Cache("testSerializerRestored"+name, WithSerializer(s))
+		if err := restored.Load(&buf); err != nil {
+			t.Fatal(name, err)
+		}
+		if item, err := restored.Value("user"); err != nil || item.Data() != user {
+			t.Error("Custom struct should survive a round trip", name, err)
+		}
+	}
+
+	mp := MsgpackSerializer()
+	value := map[string]interface{}{
+		"name":   "bob",
+		"ids":    []interface{}{int64(1), int64(-200), int64(70000)},
+		"score":  1.5,
+		"active": true,
+		"raw":    []byte{1, 2},
+		"none":   nil,
+		"long":   strings.Repeat("x", 300),
+	}
+	b, err := mp.Encode(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := mp.Decode(b)
+	if err != nil || !reflect.DeepEqual(decoded, value) {
+		t.Error("Unexpected msgpack round trip", decoded, err)
+	}
+	if decoded, _ := mp.Decode(mustMsgpack(t, user)); !reflect.DeepEqual(decoded, map[string]interface{}{"Name": "alice", "Age": int64(30)}) {
+		t.Error("Structs should be encoded as maps", decoded)
+	}
+	if _, err := mp.Decode(b[:len(b)-1]); err == nil {
+		t.Error("Truncated data should fail to decode")
+	}
+
+	codec, _ := NewAESGCMCodec(1, bytes.Repeat([]byte{3}, 16))
+	sealed := Cache("testSerializerSealed", WithSerializer(mp), WithEncryption(codec))
+	sealed.Add("map", map[string]interface{}{"secret": "value"}, 0)
+	var buf bytes.Buffer
+	sealed.Save(&buf)
+	if bytes.Contains(buf.Bytes(), []byte("secret")) {
+		t.Error("Serialized data should be encrypted when saving")
+	}
+	restored := Cache("testSerializerSealedRestored", WithSerializer(mp), WithEncryption(codec))
+	if err := restored.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if item, _ := restored.Value("map"); item.Data().(map[string]interface{})["secret"] != "value" {
+		t.Error("Encrypted serialized data should be restored")
+	}
+}
+
+func mustMsgpack(t *testing.T, v interface{}) []byte {
+	b, err := MsgpackSerializer().Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+type failingStore struct {
+	mapStore
+	fail error
+}
+
+func (s *failingStore) Get(key interface{}) (interface{}, error) {
+	if s.fail != nil {
+		return nil, s.fail
+	}
+	return s.mapStore.Get(key)
+}
+
+func (s *failingStore) Set(key, data interface{}, lifeSpan time.Duration) error {
+	if s.fail != nil {
+		return s.fail
+	}
+	return s.mapStore.Set(key, data, lifeSpan)
+}
+
+func TestStorePolicy(t *testing.T) {
+	store := &failingStore{mapStore: mapStore{data: map[interface{}]interface{}{"backed": v}}}
+	var readErrs, writeErrs int
+	table := Cache("testStorePolicy", WithStorePolicy(store, StorePolicy{
+		WriteThrough: true,
+		OnReadError:  func(key interface{}, err error) { readErrs++ },
+		OnWriteError: func(key interface{}, err error) { writeErrs++ },
+	}))
+
+	if _, err := table.Value("backed"); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("Read-through is disabled", err)
+	}
+	table.Add(k, v, 0)
+	if store.data[k] != v {
+		t.Error("Write-through should propagate adds")
+	}
+	if _, err := table.Delete("backed"); !errors.Is(err, ErrCacheNotFound) || store.data["backed"] != v {
+		t.Error("Deletes should not be propagated", err)
+	}
+
+	store.fail = errors.New("store down")
+	table.Add("other", v, 0)
+	if writeErrs != 1 || !table.Exists("other") {
+		t.Error("Write errors should go to the hook without affecting the table", writeErrs)
+	}
+
+	reader := Cache("testStorePolicyRead", WithStorePolicy(store, StorePolicy{
+		ReadThrough: true,
+		OnReadError: func(key interface{}, err error) { readErrs++ },
+	}))
+	if _, err := reader.Value("backed"); !errors.Is(err, ErrLoaderFailed) || readErrs != 1 {
+		t.Error("Read errors should be reported as loader failures and to the hook", err, readErrs)
+	}
+}
+
+type flakyBatchStore struct {
+	mapStore
+	failures int
+	batches  [][]StoreOp
+}
+
+func (s *flakyBatchStore) WriteBatch(ops []StoreOp) error {
+	s.mu.Lock()
+	s.batches = append(s.batches, ops)
+	if s.failures > 0 {
+		s.failures--
+		s.mu.Unlock()
+		return errors.New("temporary failure")
+	}
+	s.mu.Unlock()
+	for _, op := range ops {
+		if op.Delete {
+			s.Delete(op.Key)
+		} else {
+			s.Set(op.Key, op.Data, op.LifeSpan)
+		}
+	}
+	return nil
+}
+
+func TestWriteBehind(t *testing.T) {
+	store := &flakyBatchStore{mapStore: mapStore{data: make(map[interface{}]interface{})}, failures: 1}
+	table := Cache("testWriteBehind", WithStore(store), WithWriteBehind(WriteBehindConfig{
+		Interval:   time.Hour,
+		BatchSize:  10,
+		Retries:    1,
+		RetryDelay: time.Millisecond,
+	}))
+	table.Add(k, "first", 0)
+	table.Add(k, "second", 0)
+	table.Add("deleted", v, 0)
+	table.Delete("deleted")
+	store.mu.Lock()
+	if len(store.data) != 0 {
+		t.Error("Adds should be acknowledged before reaching the store")
+	}
+	store.mu.Unlock()
+
+	// pending writes are visible to read-through even after the item left the table
+	table.Flush()
+	if item, err := table.Value(k); err != nil || item.Data() != "second" {
+		t.Error("Read-through should see the pending write", err)
+	}
+	if _, err := table.Value("deleted"); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("Read-through should see the pending delete", err)
+	}
+
+	table.FlushStore()
+	store.mu.Lock()
+	if store.data[k] != "second" || len(store.data) != 1 {
+		t.Error("Unexpected store contents after flush", store.data)
+	}
+	if len(store.batches) != 2 || len(store.batches[1]) != 2 {
+		t.Error("The failed batch should be retried once with coalesced ops", len(store.batches))
+	}
+	store.mu.Unlock()
+
+	for i := 0; i < 5; i++ {
+		table.Add(i, i, 0)
+	}
+	table.Close()
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.data) != 6 {
+		t.Error("Close should drain the write-behind queue", len(store.data))
+	}
+}
+
+func TestMaxLifeSpan(t *testing.T) {
+	table := Cache("testMaxLifeSpan")
+	table.SetMaxLifeSpan(time.Minute)
+
+	if p := table.Add(k+"_1", v, time.Hour); p.LifeSpan() != time.Minute {
+		t.Error("Expected life-span to be clamped", p.LifeSpan())
+	}
+	if p := table.Add(k+"_2", v, 0); p.LifeSpan() != time.Minute {
+		t.Error("Expected non-expiring item to be clamped", p.LifeSpan())
+	}
+	if p := table.Add(k+"_3", v, time.Second); p.LifeSpan() != time.Second {
+		t.Error("Expected shorter life-span to be kept", p.LifeSpan())
+	}
+	table.NotFoundAdd(k+"_4", time.Hour, v)
+	if p, err := table.Value(k + "_4"); err != nil || p.LifeSpan() != time.Minute {
+		t.Error("Expected NotFoundAdd life-span to be clamped")
+	}
+
+	// the default life-span is clamped as well
+	table.SetDefaultLifeSpan(time.Hour)
+	if p := table.AddDefault(k+"_5", v); p.LifeSpan() != time.Minute {
+		t.Error("Expected default life-span to be clamped", p.LifeSpan())
+	}
+
+	// updates and imports are clamped as well
+	table.Replace(k+"_3", v, 0)
+	if p, _ := table.Value(k + "_3"); p.LifeSpan() != time.Minute {
+		t.Error("Expected Replace life-span to be clamped", p.LifeSpan())
+	}
+	table.Touch(k+"_3", time.Hour)
+	if p, _ := table.Value(k + "_3"); p.LifeSpan() != time.Minute {
+		t.Error("Expected Touch life-span to be clamped", p.LifeSpan())
+	}
+	p, _ := table.Value(k + "_3")
+	if p.SetLifeSpan(0); p.LifeSpan() != time.Minute {
+		t.Error("Expected SetLifeSpan life-span to be clamped", p.LifeSpan())
+	}
+	table.Import([]ImportEntry{{Key: k + "_7", Data: v, TTL: -1}, {Key: k + "_8", Data: v, TTL: time.Hour}})
+	for _, key := range []string{k + "_7", k + "_8"} {
+		if ttl, err := table.TTL(key); err != nil || ttl > time.Minute || ttl < 59*time.Second {
+			t.Error("Expected imported life-span to be clamped", key, ttl, err)
+		}
+	}
+
+	table.SetMaxLifeSpan(0)
+	if p := table.Add(k+"_6", v, time.Hour); p.LifeSpan() != time.Hour {
+		t.Error("Expected no clamp after removing the maximum", p.LifeSpan())
+	}
+}
+
+func TestAccessCountDecay(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	table := Cache("testAccessCountDecay", WithClock(clock), WithAccessCountDecay(time.Hour))
+
+	old := table.Add(k+"_old", v, 0)
+	for i := 0; i < 16; i++ {
+		old.KeepAlive()
+	}
+	if old.AccessedCount() != 16 {
+		t.Error("Expected undecayed access count", old.AccessedCount())
+	}
+
+	// two half-lives later the old count has been quartered
+	clock.Advance(2 * time.Hour)
+	if old.AccessedCount() != 4 {
+		t.Error("Expected decayed access count", old.AccessedCount())
+	}
+	fresh := table.Add(k+"_fresh", v, 0)
+	for i := 0; i < 6; i++ {
+		fresh.KeepAlive()
+	}
+	if top := table.MostAccessed(1); len(top) != 1 || top[0] != fresh {
+		t.Error("Expected recently popular item to rank first")
+	}
+
+	// accessing a decayed item continues from the decayed count
+	old.KeepAlive()
+	if old.AccessedCount() != 5 {
+		t.Error("Expected access to build on decayed count", old.AccessedCount())
+	}
+	clock.Advance(100 * time.Hour)
+	if old.AccessedCount() != 0 || fresh.AccessedCount() != 0 {
+		t.Error("Expected counts to decay to zero")
+	}
+}
+
+func TestDurationHistograms(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	table := Cache("testDurationHistograms", WithClock(clock))
+
+	table.Add(k+"_old", v, time.Hour)
+	clock.Advance(30 * time.Minute)
+	table.Add(k+"_new", v, 10*time.Second)
+	table.Add(k+"_forever", v, 0)
+	clock.Advance(5 * time.Second)
+
+	age := table.AgeHistogram(time.Minute, time.Hour)
+	if age.Count != 3 || age.Counts[0] != 2 || age.Counts[1] != 1 || age.Counts[2] != 0 {
+		t.Error("Unexpected age histogram", age.Counts)
+	}
+	if age.Sum != 30*time.Minute+15*time.Second {
+		t.Error("Unexpected age sum", age.Sum)
+	}
+
+	ttl := table.TTLHistogram(time.Minute, time.Hour)
+	if ttl.Unbounded != 1 || ttl.Count != 2 || ttl.Counts[0] != 1 || ttl.Counts[1] != 1 {
+		t.Error("Unexpected TTL histogram", ttl.Counts, ttl.Unbounded)
+	}
+
+	// default bounds are used when none are given
+	if h := table.AgeHistogram(); len(h.Bounds) == 0 || len(h.Counts) != len(h.Bounds)+1 {
+		t.Error("Expected default histogram bounds")
+	}
+}
+
+func TestAddWithOptions(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	table := Cache("testAddWithOptions", WithClock(clock))
+
+	var expired []interface{}
+	item := table.AddWithOptions(k, v,
+		ItemLifeSpan(time.Minute),
+		ItemTags("a", "b"),
+		ItemAbsoluteExpiration(),
+		ItemAboutToExpire(func(key interface{}) { expired = append(expired, key) }),
+	)
+	if item.LifeSpan() != time.Minute || !item.HasTag("b") || !item.Absolute() || item.Pinned() {
+		t.Error("Error applying item options")
+	}
+	if len(table.ItemsByTag("a")) != 1 {
+		t.Error("Expected tagged item to be indexed")
+	}
+
+	// accesses do not push back an absolute expiration
+	clock.Advance(40 * time.Second)
+	item.KeepAlive()
+	if ttl := item.TTL(); ttl != 20*time.Second {
+		t.Error("Expected absolute TTL to ignore access", ttl)
+	}
+	clock.Advance(30 * time.Second)
+	if table.DeleteExpired() != 1 || len(expired) != 1 || expired[0] != k {
+		t.Error("Expected absolute item to expire with its callback", expired)
+	}
+
+	// sliding items are kept alive by access
+	sliding := table.AddWithOptions(k+"_sliding", v, ItemLifeSpan(time.Minute))
+	clock.Advance(40 * time.Second)
+	sliding.KeepAlive()
+	clock.Advance(30 * time.Second)
+	if table.DeleteExpired() != 0 {
+		t.Error("Expected sliding item to survive")
+	}
+
+	pinned := table.AddWithOptions(k+"_pinned", v, ItemLifeSpan(time.Second), ItemPinned())
+	clock.Advance(time.Minute)
+	table.DeleteExpired()
+	if !pinned.Pinned() || !table.Exists(k+"_pinned") {
+		t.Error("Expected pinned item to survive expiration")
+	}
+}
+
+func TestPeek(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	table := Cache("testPeek", WithClock(clock))
+	table.Add(k, v, time.Minute)
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		t.Error("Peek must not call the data loader")
+		return nil
+	})
+
+	clock.Advance(30 * time.Second)
+	item, err := table.Peek(k)
+	if err != nil || item.Data() != v {
+		t.Error("Error peeking item", err)
+	}
+	if item.AccessedCount() != 0 || item.TTL() != 30*time.Second {
+		t.Error("Expected Peek to leave access metadata untouched")
+	}
+	if s := table.Stats(); s.Hits != 0 || s.Misses != 0 {
+		t.Error("Expected Peek to leave stats untouched", s)
+	}
+	if _, err := table.Peek(k + "_missing"); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("Expected not found for missing key", err)
+	}
+
+	table.Close()
+	if _, err := table.Peek(k); err != ErrTableClosed {
+		t.Error("Expected closed error", err)
+	}
+}
+
+func TestBatchedExpiration(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	table := Cache("testBatchedExpiration", WithClock(clock))
+
+	const n = 3 * expireBatchSize
+	var mu sync.Mutex
+	stillPresent := 0
+	deleted := 0
+	// callbacks run after the locks are released, so they may use the table
+	table.SetDeleteItemCallback(func(item *CacheItem) {
+		mu.Lock()
+		defer mu.Unlock()
+		deleted++
+		if table.Exists(item.Key()) {
+			stillPresent++
+		}
+	})
+	for i := 0; i < n; i++ {
+		table.Add(i, v, time.Second)
+	}
+	keep := table.Add("keep", v, time.Hour)
+
+	clock.Advance(2 * time.Second)
+	if count := table.DeleteExpired(); count != n {
+		t.Error("Unexpected number of expired items", count)
+	}
+	mu.Lock()
+	if deleted != n || stillPresent != 0 {
+		t.Error("Expected callbacks for every expired item after removal", deleted, stillPresent)
+	}
+	mu.Unlock()
+	if table.Count() != 1 || !table.Exists(keep.Key()) {
+		t.Error("Expected only the unexpired item to remain")
+	}
+}
+
+func TestKeepAliveMode(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	table := Cache("testKeepAliveMode", WithClock(clock), WithKeepAliveMode(KeepAliveCountOnly))
+
+	item := table.Add(k, v, time.Minute)
+	clock.Advance(30 * time.Second)
+	table.Value(k)
+	if item.AccessedCount() != 1 || item.TTL() != 30*time.Second {
+		t.Error("Expected count-only access to leave TTL untouched", item.AccessedCount(), item.TTL())
+	}
+
+	table.SetKeepAliveMode(KeepAliveTouchOnly)
+	table.Value(k)
+	if item.AccessedCount() != 1 || item.TTL() != time.Minute {
+		t.Error("Expected touch-only access to extend TTL without counting", item.AccessedCount(), item.TTL())
+	}
+
+	// items can override the table setting
+	calls := 0
+	quiet := table.AddWithOptions(k+"_quiet", v, ItemLifeSpan(time.Minute), ItemKeepAliveMode(KeepAliveNone),
+		ItemAccessed(func(interface{}, int64) { calls++ }))
+	clock.Advance(10 * time.Second)
+	table.Value(k + "_quiet")
+	if quiet.AccessedCount() != 0 || quiet.TTL() != 50*time.Second || calls != 0 {
+		t.Error("Expected no access tracking for item with KeepAliveNone")
+	}
+	quiet.SetKeepAliveMode(KeepAliveInherit)
+	table.SetKeepAliveMode(KeepAliveFull)
+	table.Value(k + "_quiet")
+	if quiet.AccessedCount() != 1 || quiet.TTL() != time.Minute || calls != 1 {
+		t.Error("Expected full access tracking after inheriting table mode")
+	}
+
+	// explicit KeepAlive always does a full update
+	table.SetKeepAliveMode(KeepAliveNone)
+	item.KeepAlive()
+	if item.AccessedCount() != 2 {
+		t.Error("Expected explicit KeepAlive to count", item.AccessedCount())
+	}
+}
+
+func TestAddWithExpireAt(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	table := Cache("testAddWithExpireAt", WithClock(clock))
+
+	deadline := time.Unix(1060, 0)
+	item := table.AddWithExpireAt(k, v, deadline)
+	if !item.ExpireAt().Equal(deadline) || !item.Absolute() || item.LifeSpan() != time.Minute {
+		t.Error("Error applying expire-at time", item.ExpireAt())
+	}
+	clock.Advance(30 * time.Second)
+	table.Value(k)
+	if !item.ExpireAt().Equal(deadline) {
+		t.Error("Expected access not to move the deadline", item.ExpireAt())
+	}
+	clock.Advance(31 * time.Second)
+	if table.DeleteExpired() != 1 {
+		t.Error("Expected item to expire at its deadline")
+	}
+
+	// deadlines in the past expire on the next check
+	table.AddWithExpireAt(k+"_past", v, time.Unix(0, 0))
+	table.DeleteExpired()
+	if table.Exists(k + "_past") {
+		t.Error("Expected past deadline to expire immediately")
+	}
+
+	// sliding items report their current deadline, zero means forever
+	sliding := table.Add(k+"_sliding", v, time.Minute)
+	if !sliding.ExpireAt().Equal(clock.Now().Add(time.Minute)) {
+		t.Error("Unexpected sliding deadline", sliding.ExpireAt())
+	}
+	if !table.Add(k+"_forever", v, 0).ExpireAt().IsZero() {
+		t.Error("Expected zero deadline for non-expiring item")
+	}
+
+	table.SetMaxLifeSpan(time.Second)
+	if p := table.AddWithExpireAt(k+"_far", v, clock.Now().Add(time.Hour)); p.LifeSpan() != time.Second {
+		t.Error("Expected expire-at to respect the maximum life-span", p.LifeSpan())
+	}
+}
+
+type clonedSlice []int
+
+func (s clonedSlice) Clone() interface{} {
+	return append(clonedSlice(nil), s...)
+}
+
+func TestCopyOnRead(t *testing.T) {
+	table := Cache("testCopyOnRead", WithCopyOnRead())
+
+	table.Add("bytes", []byte("abc"), 0)
+	item, _ := table.Value("bytes")
+	b := item.Data().([]byte)
+	b[0] = 'x'
+	if string(item.Data().([]byte)) != "abc" {
+		t.Error("Expected byte slices to be copied on read")
+	}
+
+	table.Add("cloner", clonedSlice{1, 2}, 0)
+	item, _ = table.Value("cloner")
+	item.Data().(clonedSlice)[0] = 9
+	if item.Data().(clonedSlice)[0] != 1 {
+		t.Error("Expected Cloner values to be cloned on read")
+	}
+
+	// tables without the option share the stored value
+	shared := Cache("testCopyOnReadShared")
+	shared.Add("bytes", []byte("abc"), 0)
+	item, _ = shared.Value("bytes")
+	item.Data().([]byte)[0] = 'x'
+	if string(item.Data().([]byte)) != "xbc" {
+		t.Error("Expected shared value without copy-on-read")
+	}
+}
+
+func TestRegistryQuota(t *testing.T) {
+	defer SetRegistryQuota(RegistryQuota{})
+	base := len(RegisteredTables())
+
+	SetRegistryQuota(RegistryQuota{MaxTables: base + 2, MaxItemsPerTable: 2})
+	a, err := TryCache("testQuotaA", WithMaxItems(10))
+	if err != nil {
+		t.Fatal("Error creating table within quota", err)
+	}
+	defer a.Close()
+	for i := 0; i < 5; i++ {
+		a.Add(i, v, 0)
+	}
+	if a.Count() != 2 {
+		t.Error("Expected per-table item quota to cap the table", a.Count())
+	}
+	b, _ := TryCache("testQuotaB")
+	defer b.Close()
+	if _, err := TryCache("testQuotaC"); !errors.Is(err, ErrTooManyTables) {
+		t.Error("Expected table quota rejection", err)
+	}
+	// Cache ignores the reject policy and registers the table anyway
+	if c := Cache("testQuotaC"); c.Closed() || Cache("testQuotaC") != c {
+		t.Error("Expected Cache to create a usable table despite the quota")
+	}
+	DeleteCache("testQuotaC")
+	// existing tables are still returned
+	if again, err := TryCache("testQuotaA"); err != nil || again != a {
+		t.Error("Expected existing table despite quota", err)
+	}
+
+	// with LRU eviction the least recently used table makes room
+	SetRegistryQuota(RegistryQuota{MaxTables: len(RegisteredTables()), Policy: QuotaEvictLRU})
+	time.Sleep(time.Millisecond)
+	a.Value(0)
+	c, err := TryCache("testQuotaC")
+	if err != nil {
+		t.Fatal("Expected eviction to make room", err)
+	}
+	defer c.Close()
+	if a.Closed() || len(RegisteredTables()) != base+2 {
+		t.Error("Expected a different table to be evicted")
+	}
+
+	// memory budget is enforced on demand
+	SetRegistryQuota(RegistryQuota{MaxMemory: 1, Policy: QuotaEvictLRU})
+	if n := EnforceRegistryQuota(); n == 0 || !a.Closed() {
+		t.Error("Expected memory quota to evict tables with items", n)
+	}
+}
+
+func TestCallbackHandles(t *testing.T) {
+	table := Cache("testCallbackHandles")
+
+	var added, deleted []string
+	h1 := table.AddAddedItemCallback(func(*CacheItem) { added = append(added, "first") })
+	table.AddAddedItemCallback(func(*CacheItem) { added = append(added, "second") })
+	hd := table.AddDeleteItemCallback(func(*CacheItem) { deleted = append(deleted, "deleted") })
+	table.AddDeleteItemReasonCallback(func(*CacheItem, DeleteReason) { deleted = append(deleted, "reason") })
+
+	if !table.RemoveCallback(h1) || table.RemoveCallback(h1) {
+		t.Error("Expected handle to be removed exactly once")
+	}
+	table.Add(k, v, 0)
+	if len(added) != 1 || added[0] != "second" {
+		t.Error("Expected only the remaining added callback to run", added)
+	}
+	table.RemoveCallback(hd)
+	table.Delete(k)
+	if len(deleted) != 1 || deleted[0] != "reason" {
+		t.Error("Expected only the remaining delete callback to run", deleted)
+	}
+
+	// item level callbacks
+	var expired, accessed int
+	item := table.Add(k, v, 0)
+	he := item.AddAboutToExpireCallback(func(interface{}) { expired++ })
+	item.AddAboutToExpireCallback(func(interface{}) { expired += 10 })
+	ha := item.AddAccessedCallback(func(interface{}, int64) { accessed++ })
+	if !item.RemoveCallback(ha) || !item.RemoveCallback(he) || table.RemoveCallback(he) {
+		t.Error("Error removing item callbacks")
+	}
+	item.KeepAlive()
+	table.Delete(k)
+	if expired != 10 || accessed != 0 {
+		t.Error("Expected only the remaining item callbacks to run", expired, accessed)
+	}
+}
+
+func TestImport(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	table := Cache("testImport", WithClock(clock))
+
+	created := time.Unix(500, 0)
+	n := table.Import([]ImportEntry{
+		{Key: "a", Data: v, CreateTime: created, TTL: 30 * time.Second, LifeSpan: time.Minute, AccessCount: 3},
+		{Key: "b", Data: v, TTL: 10 * time.Second},
+		{Key: "forever", Data: v, TTL: -1},
+		{Key: "expired", Data: v, TTL: 0},
+	})
+	if n != 3 || table.Count() != 3 || table.Exists("expired") {
+		t.Error("Unexpected import result", n, table.Count())
+	}
+
+	a, _ := table.Peek("a")
+	if !a.CreateTime().Equal(created) || a.TTL() != 30*time.Second || a.LifeSpan() != time.Minute || a.AccessedCount() != 3 {
+		t.Error("Expected imported metadata to be preserved", a.CreateTime(), a.TTL(), a.LifeSpan())
+	}
+	b, _ := table.Peek("b")
+	if b.LifeSpan() != 10*time.Second || !b.CreateTime().Equal(clock.Now()) {
+		t.Error("Expected TTL to be used as life-span", b.LifeSpan())
+	}
+	forever, _ := table.Peek("forever")
+	if forever.TTL() != -1 {
+		t.Error("Expected non-expiring imported item", forever.TTL())
+	}
+
+	clock.Advance(20 * time.Second)
+	table.DeleteExpired()
+	if table.Exists("b") || !table.Exists("a") {
+		t.Error("Expected imported items to expire by their remaining TTL")
+	}
+}
+
+func TestAddWithExpireCallback(t *testing.T) {
+	table := Cache("testAddWithExpireCallback")
+
+	fired := make(chan interface{}, 1)
+	// the item expires immediately yet the callback is never missed
+	item := table.AddWithExpireCallback(k, v, time.Nanosecond, func(key interface{}) { fired <- key })
+	if item.LifeSpan() != time.Nanosecond {
+		t.Error("Error applying life-span", item.LifeSpan())
+	}
+	table.DeleteExpired()
+	select {
+	case key := <-fired:
+		if key != k {
+			t.Error("Unexpected key in expire callback", key)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected expire callback to fire")
+	}
+}
+
+func TestEvictionPriority(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	table := Cache("testEvictionPriority", WithClock(clock), WithMaxItems(2))
+
+	expensive := table.AddWithOptions("expensive", v, ItemPriority(10))
+	clock.Advance(time.Second)
+	table.Add("cheap", v, 0)
+	clock.Advance(time.Second)
+	// the least recently used item has the higher priority, so the cheap one goes
+	table.Add("new", v, 0)
+	if !table.Exists("expensive") || table.Exists("cheap") || !table.Exists("new") {
+		t.Error("Expected low priority item to be evicted first")
+	}
+
+	// equal priority falls back to recency
+	expensive.SetPriority(0)
+	clock.Advance(time.Second)
+	table.Add("newer", v, 0)
+	if table.Exists("expensive") || !table.Exists("new") {
+		t.Error("Expected least recently used item among equal priorities to be evicted")
+	}
+	if expensive.Priority() != 0 {
+		t.Error("Unexpected priority", expensive.Priority())
+	}
+}
+
+func TestWarm(t *testing.T) {
+	table := Cache("testWarm")
+	defer table.Close()
+	var running, peak int32
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		cur := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if cur <= p || atomic.CompareAndSwapInt32(&peak, p, cur) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if key == "bad" {
+			return nil
+		}
+		return NewCacheItem(key, v, 0)
+	})
+	table.Add("present", v, 0)
+
+	keys := []interface{}{"present", "bad"}
+	for i := 0; i < 20; i++ {
+		keys = append(keys, i)
+	}
+	var last WarmProgress
+	res, err := table.WarmWithProgress(context.Background(), keys, 4, func(p WarmProgress) { last = p })
+	if err != nil {
+		t.Fatal("Error warming table", err)
+	}
+	if res.Loaded != 20 || res.Skipped != 1 || len(res.Failed) != 1 || res.Failed[0] != "bad" {
+		t.Error("Unexpected warm result", res)
+	}
+	if last.Done != len(keys) || last.Total != len(keys) {
+		t.Error("Expected final progress to cover all keys", last)
+	}
+	if p := atomic.LoadInt32(&peak); p > 4 || p < 2 {
+		t.Error("Expected bounded parallel loading", p)
+	}
+	if table.Count() != 21 {
+		t.Error("Expected warmed items in the table", table.Count())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Cache("testWarmCanceled").Warm(ctx, []interface{}{1, 2, 3}, 1); err != context.Canceled {
+		t.Error("Expected canceled warm-up", err)
+	}
+}
+
+func TestFlushWithOptions(t *testing.T) {
+	store := &mapStore{data: map[interface{}]interface{}{}}
+	path := filepath.Join(t.TempDir(), "flush.gob")
+	table := Cache("testFlushWithOptions", WithStore(store), WithPersistFile(path))
+	defer table.Close()
+
+	var reasons []DeleteReason
+	expired := 0
+	table.SetDeleteItemReasonCallback(func(_ *CacheItem, r DeleteReason) { reasons = append(reasons, r) })
+	table.Add("a", v, 0).AddAboutToExpireCallback(func(interface{}) { expired++ })
+	table.Add("b", v, 0)
+
+	// plain Flush stays silent and keeps the store
+	table.Flush()
+	if len(reasons) != 0 || len(store.data) != 2 {
+		t.Error("Expected plain Flush to skip callbacks and store", reasons, len(store.data))
+	}
+
+	table.Add("a", v, 0).AddAboutToExpireCallback(func(interface{}) { expired++ })
+	table.Add("b", v, 0)
+	table.FlushWithCallbacks()
+	if len(reasons) != 2 || reasons[0] != ReasonFlushed || expired != 1 || table.Count() != 0 {
+		t.Error("Expected flush callbacks", reasons, expired)
+	}
+	if len(store.data) != 2 {
+		t.Error("Expected FlushWithCallbacks to keep the store")
+	}
+
+	table.Add("c", v, 0)
+	if err := table.FlushWithOptions(context.Background(), FlushOptions{Store: true, Persist: true}); err != nil {
+		t.Fatal("Error flushing with options", err)
+	}
+	if len(reasons) != 2 {
+		t.Error("Expected no callbacks without the Callbacks option")
+	}
+	store.mu.Lock()
+	_, hasA := store.data["a"]
+	_, hasC := store.data["c"]
+	store.mu.Unlock()
+	if !hasA || hasC {
+		t.Error("Expected only flushed keys to be deleted from the store")
+	}
+	restored := Cache("testFlushWithOptionsRestored")
+	defer restored.Close()
+	if err := restored.LoadFile(path); err != nil || restored.Count() != 0 {
+		t.Error("Expected flushed table to be persisted", err)
+	}
+}
+
+func TestRenameCache(t *testing.T) {
+	table := Cache("testRenameOld")
+	defer table.Close()
+	table.Add(k, v, 0)
+	other := Cache("testRenameTaken")
+	defer other.Close()
+
+	if err := RenameCache("testRenameOld", "testRenameTaken"); err != ErrTableExists {
+		t.Error("Expected rename onto existing table to fail", err)
+	}
+	if err := RenameCache("testRenameMissing", "testRenameAny"); err != ErrTableNotFound {
+		t.Error("Expected rename of missing table to fail", err)
+	}
+	if err := RenameCache("testRenameOld", "testRenameNew"); err != nil {
+		t.Fatal("Error renaming table", err)
+	}
+	if table.Name() != "testRenameNew" || Cache("testRenameNew") != table || !Cache("testRenameNew").Exists(k) {
+		t.Error("Expected table to be registered under the new name")
+	}
+	if _, ok := lookupTable("testRenameOld"); ok {
+		t.Error("Expected old name to be released")
+	}
+	var ke *KeyError
+	if _, err := table.Delete("missing"); !errors.As(err, &ke) || ke.Table != "testRenameNew" {
+		t.Error("Expected errors to carry the new name", err)
+	}
+
+	// closing unregisters the table under its current name
+	table.Close()
+	if _, ok := lookupTable("testRenameNew"); ok {
+		t.Error("Expected renamed table to be unregistered on close")
+	}
+}
+
+func TestNonBlockingReads(t *testing.T) {
+	table := Cache("testNonBlockingReads")
+	defer table.Close()
+	table.Add(k, v, 0)
+
+	// hold the table write lock the way expirationCheck and Flush do
+	table.Lock()
+	done := make(chan error, 1)
+	go func() {
+		if !table.Exists(k) {
+			done <- ErrCacheNotFound
+			return
+		}
+		_, err := table.Value(k)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error("Unexpected read error", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected hits not to wait for the table write lock")
+	}
+	table.Unlock()
+
+	// the lock-free index follows writes, deletes, renames and flushes
+	table.Add(k+"_2", v, 0)
+	table.Rename(k+"_2", k+"_3")
+	if table.Exists(k+"_2") || !table.Exists(k+"_3") {
+		t.Error("Expected read index to follow rename")
+	}
+	table.Delete(k)
+	if table.Exists(k) {
+		t.Error("Expected read index to follow delete")
+	}
+	table.Flush()
+	if table.Exists(k + "_3") {
+		t.Error("Expected read index to be reset by flush")
+	}
+	table.Close()
+	if _, err := table.Value(k); err != ErrTableClosed {
+		t.Error("Expected closed error", err)
+	}
+}
+
+type recordingHook struct {
+	mu     sync.Mutex
+	events []string
+	loadD  time.Duration
+	age    time.Duration
+}
+
+func (h *recordingHook) record(event string, key interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, fmt.Sprintf("%s:%v", event, key))
+}
+
+func (h *recordingHook) OnHit(table string, key interface{})  { h.record("hit", key) }
+func (h *recordingHook) OnMiss(table string, key interface{}) { h.record("miss", key) }
+func (h *recordingHook) OnLoad(table string, key interface{}, d time.Duration, err error) {
+	h.record(fmt.Sprintf("load(%v)", err != nil), key)
+	h.mu.Lock()
+	h.loadD = d
+	h.mu.Unlock()
+}
+func (h *recordingHook) OnEvict(table string, key interface{}, age time.Duration) {
+	h.record("evict", key)
+}
+func (h *recordingHook) OnExpire(table string, key interface{}, age time.Duration) {
+	h.record("expire", key)
+	h.mu.Lock()
+	h.age = age
+	h.mu.Unlock()
+}
+
+func TestMetricsHook(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	table := Cache("testMetricsHook", WithClock(clock), WithMaxItems(2))
+	defer table.Close()
+	hook := &recordingHook{}
+	table.SetMetricsHook(hook)
+
+	table.Add("a", v, time.Minute)
+	table.Value("a")
+	table.Value("missing")
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+		time.Sleep(time.Millisecond)
+		if key == "nope" {
+			return nil
+		}
+		return NewCacheItem(key, v, 0)
+	})
+	table.Value("b")
+	table.Value("nope")
+	// a third item evicts the least recently used "b"
+	clock.Advance(time.Second)
+	table.Value("a")
+	table.Add("c", v, 0)
+	clock.Advance(2 * time.Minute)
+	table.DeleteExpired()
+
+	want := []string{
+		"hit:a", "miss:missing",
+		"miss:b", "load(false):b",
+		"miss:nope", "load(true):nope",
+		"hit:a", "evict:b", "expire:a",
+	}
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	if fmt.Sprint(hook.events) != fmt.Sprint(want) {
+		t.Error("Unexpected metrics events", hook.events)
+	}
+	if hook.loadD < time.Millisecond {
+		t.Error("Expected load duration to be reported", hook.loadD)
+	}
+	if hook.age != 2*time.Minute+time.Second {
+		t.Error("Expected expired item age", hook.age)
+	}
+
+	// removing the hook stops reporting
+	table.SetMetricsHook(nil)
+	table.Value("c")
+	if len(hook.events) != len(want) {
+		t.Error("Expected no events after removing hook", hook.events)
+	}
+}
+
+func TestAboutToExpireSnapshotCallback(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	table := Cache("testAboutToExpireSnapshot", WithClock(clock))
+	defer table.Close()
+
+	var snapshots []SnapshotItem
+	item := table.AddWithTags(k, v, time.Minute, "audit")
+	item.KeepAlive()
+	item.KeepAlive()
+	h := item.AddAboutToExpireSnapshotCallback(func(s SnapshotItem) {
+		snapshots = append(snapshots, s)
+	})
+	if h == 0 {
+		t.Error("Expected non-zero callback handle")
+	}
+	other := table.AddWithOptions(k+"_other", "other", ItemLifeSpan(time.Minute),
+		ItemAboutToExpireSnapshot(func(s SnapshotItem) {
+			snapshots = append(snapshots, s)
+		}))
+	removed := other.AddAboutToExpireSnapshotCallback(func(s SnapshotItem) {
+		t.Error("Expected removed callback not to run")
+	})
+	if !other.RemoveCallback(removed) {
+		t.Error("Expected snapshot callback to be removable by handle")
+	}
+
+	clock.Advance(2 * time.Minute)
+	table.DeleteExpired()
+	if len(snapshots) != 2 {
+		t.Fatal("Expected a snapshot for each expired item", len(snapshots))
+	}
+	for _, s := range snapshots {
+		switch s.Key {
+		case k:
+			if s.Data != v || s.AccessCount != 2 || !s.CreateTime.Equal(time.Unix(1000, 0)) ||
+				len(s.Tags) != 1 || s.Tags[0] != "audit" {
+				t.Error("Unexpected snapshot of expired item", s)
+			}
+		case k + "_other":
+			if s.Data != "other" || len(s.Tags) != 0 {
+				t.Error("Unexpected snapshot of expired item", s)
+			}
+		default:
+			t.Error("Unexpected snapshot key", s.Key)
+		}
+	}
+}
+
+func TestCentralJanitor(t *testing.T) {
+	SetJanitorTick(5 * time.Millisecond)
+	defer SetJanitorTick(0)
+	scheduled := func(ct *CacheTable) bool {
+		sharedJanitor.mu.Lock()
+		defer sharedJanitor.mu.Unlock()
+		_, ok := sharedJanitor.timers[ct]
+		return ok
+	}
+
+	tables := make([]*CacheTable, 3)
+	for i := range tables {
+		tables[i] = Cache(fmt.Sprintf("testCentralJanitor%d", i), WithCentralJanitor())
+		tables[i].Add(k, v, time.Duration(i+1)*20*time.Millisecond)
+		tables[i].Add(k+"_forever", v, 0)
+	}
+	for _, table := range tables {
+		if table.janitor != nil {
+			t.Error("Expected no per-table janitor in central mode")
+		}
+		if !scheduled(table) {
+			t.Error("Expected table to be scheduled on the shared janitor")
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		done := true
+		for _, table := range tables {
+			if table.Exists(k) {
+				done = false
+			}
+		}
+		if done {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for _, table := range tables {
+		if table.Exists(k) || !table.Exists(k+"_forever") {
+			t.Error("Expected shared janitor to expire only the timed item", table.Name())
+		}
+		if scheduled(table) {
+			t.Error("Expected no pending timer once nothing can expire", table.Name())
+		}
+	}
+
+	// closing a table cancels its pending timer
+	tables[0].Add(k, v, time.Hour)
+	if !scheduled(tables[0]) {
+		t.Error("Expected table to be rescheduled")
+	}
+	for _, table := range tables {
+		table.Close()
+	}
+	if scheduled(tables[0]) {
+		t.Error("Expected close to cancel the shared timer")
+	}
+}
+
+func TestConfigDoesNotTakeTableLock(t *testing.T) {
+	table := Cache("testConfigDoesNotTakeTableLock")
+	defer table.Close()
+
+	var added, deleted int32
+	// configuration changes must not wait for the table lock held by writers
+	table.Lock()
+	done := make(chan CallbackHandle, 1)
+	go func() {
+		table.SetAddedItemCallback(func(*CacheItem) { atomic.AddInt32(&added, 1) })
+		h := table.AddDeleteItemCallback(func(*CacheItem) { atomic.AddInt32(&deleted, 1) })
+		table.SetDataLoader(func(key interface{}, args ...interface{}) *CacheItem {
+			return NewCacheItem(key, v, 0)
+		})
+		table.SetLogger(log.New(&bytes.Buffer{}, "", 0))
+		table.SetDefaultLifeSpan(time.Hour)
+		table.SetExpirationJitter(0)
+		done <- h
+	}()
+	var h CallbackHandle
+	select {
+	case h = <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected configuration changes not to wait for the table lock")
+	}
+	table.Unlock()
+
+	item := table.AddDefault(k, v)
+	if item.LifeSpan() != time.Hour {
+		t.Error("Expected default life span to take effect", item.LifeSpan())
+	}
+	if _, err := table.Value(k + "_loaded"); err != nil {
+		t.Error("Expected data loader to take effect", err)
+	}
+	table.Delete(k)
+	if !table.RemoveCallback(h) {
+		t.Error("Expected delete callback to be removable")
+	}
+	table.Delete(k + "_loaded")
+	if atomic.LoadInt32(&added) != 2 || atomic.LoadInt32(&deleted) != 1 {
+		t.Error("Unexpected callback counts", added, deleted)
+	}
+}
+
+type mutableKey struct {
+	name string
+}
+
+func (m *mutableKey) String() string { return m.name }
+
+func TestHashKeyFollowsEquality(t *testing.T) {
+	table := Cache("testHashKeyFollowsEquality", WithShards(64))
+	defer table.Close()
+
+	// pointer keys are hashed by address, not by their printed content
+	key := &mutableKey{name: "before"}
+	table.Add(key, v, 0)
+	key.name = "after"
+	if !table.Exists(key) {
+		t.Error("Expected pointer key to stay reachable after its String changed")
+	}
+	if _, err := table.Delete(key); err != nil || table.Count() != 0 {
+		t.Error("Expected pointer key to be deletable", err, table.Count())
+	}
+
+	// equal composite keys hash equally, including signed zeros
+	type point struct {
+		X, Y float64
+		tag  string
+	}
+	negZero := math.Copysign(0, -1)
+	if hashKey(point{0, 1, "a"}) != hashKey(point{negZero, 1, "a"}) {
+		t.Error("Expected +0 and -0 struct fields to hash equally")
+	}
+	if hashKey([2]interface{}{1, "x"}) != hashKey([2]interface{}{1, "x"}) {
+		t.Error("Expected equal arrays to hash equally")
+	}
+	table.Add(point{0, 1, "a"}, v, 0)
+	if !table.Exists(point{negZero, 1, "a"}) {
+		t.Error("Expected equal struct key to be found")
+	}
+}
+
+type gatedBatchStore struct {
+	mapStore
+	once    sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *gatedBatchStore) WriteBatch(ops []StoreOp) error {
+	s.once.Do(func() { close(s.started) })
+	<-s.release
+	for _, op := range ops {
+		if op.Delete {
+			s.Delete(op.Key)
+		} else {
+			s.Set(op.Key, op.Data, op.LifeSpan)
+		}
+	}
+	return nil
+}
+
+func TestWriteBehindInflightVisible(t *testing.T) {
+	store := &gatedBatchStore{
+		mapStore: mapStore{data: map[interface{}]interface{}{"gone": "stale", "updated": "stale"}},
+		started:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	table := Cache("testWriteBehindInflight", WithStore(store), WithWriteBehind(WriteBehindConfig{Interval: time.Hour}))
+	defer table.Close()
+	table.Add("gone", v, 0)
+	table.Delete("gone")
+	table.Add("updated", "fresh", 0)
+	table.Flush()
+
+	flushed := make(chan struct{})
+	go func() {
+		table.FlushStore()
+		close(flushed)
+	}()
+	<-store.started
+	// while the batch is being written, read-through must not see the old store values
+	if _, err := table.Value("gone"); !errors.Is(err, ErrCacheNotFound) {
+		t.Error("Expected in-flight delete to hide the stale store value", err)
+	}
+	table.Delete("updated")
+	if item, err := table.Value("updated"); err == nil {
+		t.Error("Expected newer pending delete to win over the in-flight write", item.Data())
+	}
+	close(store.release)
+	<-flushed
+}
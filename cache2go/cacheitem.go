@@ -3,6 +3,7 @@ package cache2go
 import (
 	"container/list"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,37 +22,212 @@ type CacheItem struct {
 	accessedTime time.Time
 	// 访问次数
 	accessCount int64
+	// 访问次数最近一次衰减所在的周期，缓存表开启访问次数衰减后才会使用
+	decayEpoch int64
 	// 在item将要被删除时触发的回调函数切片
-	aboutToExpire []func(key interface{})
+	aboutToExpire callbackList[func(key interface{})]
+	// 在item将要被删除时触发的回调函数切片，回调函数会收到缓存项的只读快照
+	aboutToExpireSnapshot callbackList[func(item SnapshotItem)]
+	// 在item过期时触发的续期回调函数，返回大于0的存活时间时不会删除item
+	renew func(key interface{}) time.Duration
+	// 在item被访问时触发的回调函数切片
+	accessed callbackList[func(key interface{}, count int64)]
+	// 被命中时更新访问信息的方式
+	keepAliveMode KeepAliveMode
+	// 是否使用绝对过期时间，以及此时存活时间开始计算的时间
+	absolute   bool
+	expireBase time.Time
+	// 淘汰优先级，超出容量限制时优先淘汰优先级低的缓存项
+	priority int
+	// 是否被固定，被固定的缓存项不会过期或被淘汰
+	pinned bool
+	// 访问频率统计的环形桶以及最近一次访问所在的桶，缓存表开启访问频率统计后才会分配
+	rateHits  []int64
+	rateEpoch int64
+	// 标签，创建之后不再修改
+	tags []string
+	// 版本号，每次加入缓存表或数据被修改时都会增大，未加入缓存表时为0
+	version uint64
+	// 是否正在后台提前刷新
+	refreshing atomic.Bool
+	// 在缓存表过期堆中的状态
+	expiry expiryState
+	// 所属的缓存表，在加入缓存表时设置，用于修改存活时间后通知缓存表重新调度定时器
+	table *CacheTable
 }
 
 // NewCacheItem 创建一个CacheItem
 func NewCacheItem(key, value interface{}, lifeSpan time.Duration) *CacheItem {
 	now := time.Now()
 	return &CacheItem{
-		key:           key,
-		data:          value,
-		lifeSpan:      lifeSpan,
-		createTime:    now,
-		accessedTime:  now,
-		accessCount:   0,
-		aboutToExpire: nil,
+		key:          key,
+		data:         value,
+		lifeSpan:     lifeSpan,
+		createTime:   now,
+		accessedTime: now,
+		accessCount:  0,
 	}
 }
 
-// KeepAlive 当访问该缓存项时需要调用
+// 获取当前时间，加入缓存表后使用缓存表的时钟，调用者需要持有缓存项的锁
+func (ci *CacheItem) now() time.Time {
+	if ci.table != nil {
+		return ci.table.now()
+	}
+	return time.Now()
+}
+
+// KeepAlive 当访问该缓存项时需要调用，会在释放锁之后执行访问回调函数
 func (ci *CacheItem) KeepAlive() {
+	ci.keepAlive(KeepAliveFull)
+}
+
+// 按照mode更新访问信息
+func (ci *CacheItem) keepAlive(mode KeepAliveMode) {
 	ci.Lock()
-	defer ci.Unlock()
-	ci.accessCount++
-	ci.accessedTime = time.Now()
+	if mode == KeepAliveNone {
+		ci.Unlock()
+		return
+	}
+	now := ci.now()
+	if mode != KeepAliveCountOnly {
+		ci.accessedTime = now
+	}
+	if mode != KeepAliveTouchOnly {
+		ci.accessCount, ci.decayEpoch = ci.decayedCountLocked(now)
+		ci.accessCount++
+		ci.recordAccessLocked(now)
+	}
+	key, count, accessed, table := ci.key, ci.accessCount, ci.accessed.fns, ci.table
+	ci.Unlock()
+
+	for _, callback := range accessed {
+		if table == nil {
+			callback(key, count)
+			continue
+		}
+		table.safeCall(CallbackAccessed, key, func() { callback(key, count) })
+	}
 }
 
 // LifeSpan 获取缓存项的存活时间
 func (ci *CacheItem) LifeSpan() time.Duration {
+	ci.RLock()
+	defer ci.RUnlock()
 	return ci.lifeSpan
 }
 
+// Touch 修改缓存项的存活时间并刷新最后访问时间，保留创建时间和访问次数，
+// 如果缓存项已经加入缓存表，会通知缓存表重新调度定时器
+func (ci *CacheItem) Touch(newLifeSpan time.Duration) {
+	ci.Lock()
+	newLifeSpan = itemLifeSpan(ci.table, newLifeSpan)
+	ci.lifeSpan = newLifeSpan
+	ci.accessedTime = ci.now()
+	ci.expireBase = ci.accessedTime
+	table, key := ci.table, ci.key
+	ci.Unlock()
+
+	if table != nil {
+		table.track(key, ci)
+		table.reschedule(newLifeSpan)
+	}
+}
+
+// SetLifeSpan 修改缓存项的存活时间，不刷新最后访问时间，
+// 缩短存活时间时会立即通知缓存表进行一次超时检查，使修改马上生效
+func (ci *CacheItem) SetLifeSpan(lifeSpan time.Duration) {
+	ci.Lock()
+	old := ci.lifeSpan
+	lifeSpan = itemLifeSpan(ci.table, lifeSpan)
+	ci.lifeSpan = lifeSpan
+	table, key := ci.table, ci.key
+	ci.Unlock()
+
+	if table == nil {
+		return
+	}
+	table.track(key, ci)
+	if lifeSpan > 0 && (old == 0 || lifeSpan < old) {
+		table.expirationCheck()
+	} else {
+		table.reschedule(lifeSpan)
+	}
+}
+
+// 解析传入Touch和SetLifeSpan的存活时间，负数在缓存表中使用默认存活时间，未加入缓存表时视为0，
+// 加入缓存表后同样受存活时间上限的限制
+func itemLifeSpan(table *CacheTable, lifeSpan time.Duration) time.Duration {
+	if table == nil {
+		if lifeSpan < 0 {
+			return 0
+		}
+		return lifeSpan
+	}
+	if lifeSpan < 0 {
+		return table.effectiveLifeSpan(DefaultLifeSpan)
+	}
+	return table.clampLifeSpan(lifeSpan)
+}
+
+// TTL 获取缓存项距离过期的剩余时间，根据存活时间和最后访问时间计算，
+// 存活时间为0的缓存项永不过期，返回-1；已经过期但尚未被清理的缓存项返回0
+func (ci *CacheItem) TTL() time.Duration {
+	ci.RLock()
+	defer ci.RUnlock()
+	if ci.lifeSpan == 0 {
+		return -1
+	}
+	ttl := ci.lifeSpan - ci.now().Sub(ci.expireBaseLocked())
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+// Pin 固定缓存项，被固定的缓存项不会因为超时或容量限制被删除，但仍然会记录访问信息
+func (ci *CacheItem) Pin() {
+	ci.Lock()
+	defer ci.Unlock()
+	ci.pinned = true
+}
+
+// Unpin 取消固定缓存项，如果缓存项已经过期会在下一次超时检查中被删除
+func (ci *CacheItem) Unpin() {
+	ci.Lock()
+	ci.pinned = false
+	lifeSpan := ci.lifeSpan
+	table, key := ci.table, ci.key
+	ci.Unlock()
+
+	if table != nil && lifeSpan > 0 {
+		table.track(key, ci)
+		table.expirationCheck()
+	}
+}
+
+// SetPriority 设置淘汰优先级，默认为0，超出WithMaxItems的限制时先淘汰优先级低的缓存项，
+// 优先级相同时淘汰最久未被访问的，适合让重新计算代价高的缓存项保留更久
+func (ci *CacheItem) SetPriority(priority int) {
+	ci.Lock()
+	defer ci.Unlock()
+	ci.priority = priority
+}
+
+// Priority 获取淘汰优先级
+func (ci *CacheItem) Priority() int {
+	ci.RLock()
+	defer ci.RUnlock()
+	return ci.priority
+}
+
+// Pinned 判断缓存项是否被固定
+func (ci *CacheItem) Pinned() bool {
+	ci.RLock()
+	defer ci.RUnlock()
+	return ci.pinned
+}
+
 // AccessedTime 获取最近的访问时间
 func (ci *CacheItem) AccessedTime() time.Time {
 	ci.RLock()
@@ -59,11 +235,11 @@ func (ci *CacheItem) AccessedTime() time.Time {
 	return ci.accessedTime
 }
 
-// AccessedCount 获取访问次数
+// AccessedCount 获取访问次数，缓存表开启访问次数衰减时返回衰减之后的值
 func (ci *CacheItem) AccessedCount() int64 {
 	ci.RLock()
 	defer ci.RUnlock()
-	return ci.accessCount
+	return ci.accessCountLocked()
 }
 
 // CreateTime 获取创建时间
@@ -71,36 +247,127 @@ func (ci *CacheItem) CreateTime() time.Time {
 	return ci.createTime
 }
 
+// Version 获取版本号，可以配合CacheTable.AddIfVersion实现乐观锁
+func (ci *CacheItem) Version() uint64 {
+	ci.RLock()
+	defer ci.RUnlock()
+	return ci.version
+}
+
 // Key 获取键
 func (ci *CacheItem) Key() interface{} {
+	ci.RLock()
+	defer ci.RUnlock()
 	return ci.key
 }
 
-// Data 获取数据
+// Data 获取数据，缓存表开启WithCopyOnRead时返回数据的副本
 func (ci *CacheItem) Data() interface{} {
-	return ci.data
+	ci.RLock()
+	defer ci.RUnlock()
+	data := ci.dataLocked()
+	if ci.table != nil && ci.table.copyOnRead {
+		// 压缩或加密的数据每次解码都会得到新的副本
+		if _, encoded := ci.data.(*encodedValue); !encoded {
+			data = cloneValue(data)
+		}
+	}
+	return data
 }
 
-// RemoveAboutToExpireCallBack 将删除时触发的回调函数清空
+// RemoveAboutToExpireCallBack 将删除时触发的回调函数清空，包括接收快照的回调函数
 func (ci *CacheItem) RemoveAboutToExpireCallBack() {
 	ci.Lock()
 	defer ci.Unlock()
-	ci.aboutToExpire = nil
+	ci.aboutToExpire.clear()
+	ci.aboutToExpireSnapshot.clear()
 }
 
 // SetAboutToExpireCallback 设置删除时触发的回调函数，如果切片不为空，那么就先清空再设置
 func (ci *CacheItem) SetAboutToExpireCallback(f func(interface{})) {
-	if len(ci.aboutToExpire) > 0 {
-		ci.RemoveAboutToExpireCallBack()
-	}
 	ci.Lock()
 	defer ci.Unlock()
-	ci.aboutToExpire = append(ci.aboutToExpire, f)
+	ci.aboutToExpire.set(f)
+}
+
+// AddAboutToExpireCallback 向切片中增加删除时触发的回调函数，返回的句柄可以用于RemoveCallback
+func (ci *CacheItem) AddAboutToExpireCallback(f func(interface{})) CallbackHandle {
+	ci.Lock()
+	defer ci.Unlock()
+	return ci.aboutToExpire.add(f)
+}
+
+// AddAboutToExpireSnapshotCallback 向切片中增加删除时触发的回调函数，回调函数会收到缓存项被删除时的快照，
+// 包括数据、创建时间、访问次数和标签，适合在写回或审计时使用即将消失的数据，返回的句柄可以用于RemoveCallback
+func (ci *CacheItem) AddAboutToExpireSnapshotCallback(f func(item SnapshotItem)) CallbackHandle {
+	ci.Lock()
+	defer ci.Unlock()
+	return ci.aboutToExpireSnapshot.add(f)
 }
 
-// AddAboutToExpireCallback 向切片中增加删除时触发的回调函数
-func (ci *CacheItem) AddAboutToExpireCallback(f func(interface{})) {
+// RemoveAccessedCallback 将访问时触发的回调函数清空
+func (ci *CacheItem) RemoveAccessedCallback() {
 	ci.Lock()
 	defer ci.Unlock()
-	ci.aboutToExpire = append(ci.aboutToExpire, f)
+	ci.accessed.clear()
+}
+
+// SetAccessedCallback 设置访问时触发的回调函数，如果切片不为空，那么就先清空再设置
+func (ci *CacheItem) SetAccessedCallback(f func(key interface{}, count int64)) {
+	ci.Lock()
+	defer ci.Unlock()
+	ci.accessed.set(f)
+}
+
+// AddAccessedCallback 向切片中增加访问时触发的回调函数，回调函数会收到键和最新的访问次数，
+// 可以用于在缓存项变热时触发后台刷新等逻辑，返回的句柄可以用于RemoveCallback
+func (ci *CacheItem) AddAccessedCallback(f func(key interface{}, count int64)) CallbackHandle {
+	ci.Lock()
+	defer ci.Unlock()
+	return ci.accessed.add(f)
+}
+
+// RemoveCallback 移除通过AddAboutToExpireCallback、AddAboutToExpireSnapshotCallback或AddAccessedCallback注册的回调函数，返回是否找到
+func (ci *CacheItem) RemoveCallback(h CallbackHandle) bool {
+	ci.Lock()
+	defer ci.Unlock()
+	return ci.aboutToExpire.remove(h) || ci.aboutToExpireSnapshot.remove(h) || ci.accessed.remove(h)
+}
+
+// SetRenewCallback 设置过期时触发的续期回调函数，回调函数返回大于0的存活时间时缓存项会以新的存活时间续期，
+// 不会被删除也不会触发删除回调；返回0时正常删除，传入nil取消续期回调。
+// 回调函数执行时缓存表处于加锁状态，不能调用同一个缓存表的方法
+func (ci *CacheItem) SetRenewCallback(f func(key interface{}) time.Duration) {
+	ci.Lock()
+	defer ci.Unlock()
+	ci.renew = f
+}
+
+// 对已经过期的缓存项执行续期回调函数，返回新的存活时间以及是否续期成功
+func (ci *CacheItem) renewExpired(now time.Time) (time.Duration, bool) {
+	ci.RLock()
+	renew, key, table := ci.renew, ci.key, ci.table
+	ci.RUnlock()
+	if renew == nil {
+		return 0, false
+	}
+	var lifeSpan time.Duration
+	call := func() { lifeSpan = renew(key) }
+	if table != nil {
+		table.safeCall(CallbackRenew, key, call)
+	} else {
+		call()
+	}
+	if lifeSpan <= 0 {
+		return 0, false
+	}
+	if table != nil {
+		lifeSpan = table.clampLifeSpan(lifeSpan)
+	}
+	ci.Lock()
+	ci.lifeSpan = lifeSpan
+	ci.accessedTime = now
+	ci.expireBase = now
+	ci.Unlock()
+	return lifeSpan, true
 }
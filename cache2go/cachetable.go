@@ -1,303 +1,1292 @@
 package cache2go
 
 import (
+	"context"
+	"errors"
 	"log"
-	"sort"
+	"math/rand"
+	"path"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type CacheTable struct {
+	// 保护缓存表的状态，回调函数、loadData和日志等配置见readConfig，修改配置不需要获取该锁，
+	// 单个缓存项的写入只需要获取对应分片的锁，命中缓存项的读取不需要获取锁，
+	// 修改缓存项时持有读锁，清空、关闭和超时检查等针对整个缓存表的操作持有写锁，
+	// 加锁顺序为缓存表、分片、缓存项
 	sync.RWMutex
 
-	// 缓存表的名字
-	name string
-	// 使用map存储每一个缓存项
-	items map[interface{}]*CacheItem
-	// 负责触发清理过期缓存项的定时器
-	cleanupTimer *time.Timer
+	// 缓存表的名字，RenameCache可以修改，保存的是string
+	name atomic.Value
+	// 缓存项按照键的哈希值分散存储在多个分片中，创建后不再改变
+	shards []*shard
+	// 负责定时清理过期缓存项的协程，以及绑定的ctx
+	janitor *janitor
+	ctx     context.Context
+	// 是否由所有缓存表共享的清理协程负责定时清理
+	centralJanitor bool
 	// 当前定时器的持续时间
 	cleanupDuration time.Duration
-	// 当尝试获取缓存表中不存在的缓存项时触发的回调函数
-	loadData func(key interface{}, args ...interface{}) *CacheItem
-	// 当增加一个缓存项时触发的回调函数
-	addedItem []func(item *CacheItem)
-	// 当删除一个缓存项时触发的回调函数
-	deletedItem []func(item *CacheItem)
-	// 日志
-	logger *log.Logger
+	// 日志级别，低于该级别的日志不会输出
+	logLevel atomic.Int32
+	// 命中缓存项时更新访问信息的方式
+	keepAliveMode atomic.Int32
+	// 最近一次被使用的时间，用于注册中心配额的淘汰
+	lastUsed atomic.Int64
+	// 缓存项的最大个数，0表示不限制
+	maxItems int
+	// 时钟，为nil时使用time.Now
+	clock Clock
+	// 访问频率统计中每个桶覆盖的时间，0表示不统计
+	rateResolution time.Duration
+	// 访问次数减半的周期，0表示不衰减
+	accessDecay time.Duration
+	// 是否在读取数据时返回副本
+	copyOnRead bool
+	// 提前刷新的窗口，0表示不开启
+	refreshAhead time.Duration
+	// 过期之后仍然可以返回旧数据的时长，0表示不开启
+	staleWhileRevalidate time.Duration
+	// 数据压缩算法、压缩阈值以及统计信息
+	codec             Codec
+	compressThreshold int
+	compression       compressionStats
+	// 数据加密算法，未开启加密时为nil
+	cipher Codec
+	// 二级索引
+	indexes indexes
+	// 按照到期时间排列的缓存项
+	expiry expiryQueue
+	// 正在进行的加载，包括loadData和从二级存储读取
+	loading inflight
+	// 持久化时数据使用的序列化方式，为nil时使用gob直接编码
+	serializer Serializer
+	// Shutdown时保存缓存表的文件，为空时不保存
+	persistPath string
+	// 异步执行回调函数的协程池，未开启时在调用者的协程中执行
+	callbackPool *callbackPool
+	// 错误处理函数，未设置时打印日志
+	errorHandler func(err error, table *CacheTable, key interface{})
+	// 二级存储以及同步策略，未设置时为nil
+	store       Store
+	storePolicy StorePolicy
+	// 写回队列，未开启写回模式时为nil
+	writeBehind *writeBehind
+	// Value的限流器，未开启限流时为nil
+	limiter *rateLimiter
+	// 是否开启TinyLFU准入策略，以及估计访问频率的sketch
+	admission bool
+	sketch    *frequencySketch
+	// 最近一次分配的缓存项版本号
+	version atomic.Uint64
+	// 限制ValueAsync同时执行loadData个数以及执行和排队总数的信号量
+	asyncLoaders chan struct{}
+	asyncQueue   chan struct{}
+	// loadData的最长执行时间以及限制并发数的信号量
+	loaderTimeout  time.Duration
+	loaderSlots    chan struct{}
+	loaderFailFast bool
+	// 超时检查是否被暂停，以及暂停的时间
+	paused   bool
+	pausedAt time.Time
+	// 统计信息
+	stats tableStats
+	// 回调函数、loadData、日志等配置，读取时不需要加锁，修改时持有configMu，不与缓存项的读写竞争
+	rcu      atomic.Pointer[readConfig]
+	configMu sync.Mutex
+	// 变更事件的订阅者
+	watchers watchers
+	// 正在通过GetOrCompute计算的键，保证同一个键同时只会计算一次，由computingMu保护，计算未命中时不需要获取缓存表的写锁
+	computing   map[interface{}]*computeCall
+	computingMu sync.Mutex
+}
+
+// DefaultLifeSpan 作为存活时间传入Add、NotFoundAdd等方法时表示使用缓存表的默认存活时间
+const DefaultLifeSpan time.Duration = -1
+
+// DeleteReason 缓存项被删除的原因
+type DeleteReason int
+
+const (
+	// ReasonDeleted 通过Delete等方法手动删除
+	ReasonDeleted DeleteReason = iota
+	// ReasonExpired 超过存活时间被删除
+	ReasonExpired
+	// ReasonFlushed 清空缓存表时被删除
+	ReasonFlushed
+	// ReasonEvicted 超出容量限制被淘汰
+	ReasonEvicted
+)
+
+func (r DeleteReason) String() string {
+	switch r {
+	case ReasonDeleted:
+		return "deleted"
+	case ReasonExpired:
+		return "expired"
+	case ReasonFlushed:
+		return "flushed"
+	case ReasonEvicted:
+		return "evicted"
+	}
+	return "unknown"
+}
+
+// 一次正在进行的GetOrCompute计算
+type computeCall struct {
+	wg   sync.WaitGroup
+	item *CacheItem
+	err  error
+}
+
+// Name 获取缓存表的名字
+func (ct *CacheTable) Name() string {
+	name, _ := ct.name.Load().(string)
+	return name
 }
 
 // SetDataLoader 设置当尝试获取缓存表中不存在的缓存项时触发的回调函数
 // TODO 搞清楚args的作用
 func (ct *CacheTable) SetDataLoader(f func(interface{}, ...interface{}) *CacheItem) {
-	ct.Lock()
-	defer ct.Unlock()
-	ct.loadData = f
+	ct.updateReadConfig(func(c *readConfig) { c.loadData = f })
+}
+
+// SetDefaultLifeSpan 设置缓存表的默认存活时间，在Add等方法传入DefaultLifeSpan时使用
+func (ct *CacheTable) SetDefaultLifeSpan(d time.Duration) {
+	ct.updateReadConfig(func(c *readConfig) { c.defaultLifeSpan = d })
 }
 
-// SetLogger 设置内部日志系统
+// SetMaxLifeSpan 设置存活时间的上限，Add、NotFoundAdd、Replace、Touch等方法传入的存活时间超过上限或为0时都会使用上限，
+// 导入和恢复的缓存项同样受限，只影响之后加入或修改的缓存项，传入0取消上限
+func (ct *CacheTable) SetMaxLifeSpan(d time.Duration) {
+	ct.updateReadConfig(func(c *readConfig) { c.maxLifeSpan = d })
+}
+
+// SetExpirationJitter 设置存活时间的随机抖动比例，每个缓存项的存活时间会在[lifeSpan*(1-jitter), lifeSpan*(1+jitter)]中随机选取，
+// 避免同时插入的大量缓存项在同一时刻过期并重新加载，传入0关闭抖动
+func (ct *CacheTable) SetExpirationJitter(jitter float64) {
+	if jitter < 0 {
+		jitter = 0
+	} else if jitter > 1 {
+		jitter = 1
+	}
+	ct.updateReadConfig(func(c *readConfig) { c.jitter = jitter })
+}
+
+// 计算缓存项实际使用的存活时间，每个缓存项都需要单独计算
+func (ct *CacheTable) effectiveLifeSpan(lifeSpan time.Duration) time.Duration {
+	cfg := ct.readConfig()
+	if lifeSpan == DefaultLifeSpan {
+		lifeSpan = cfg.defaultLifeSpan
+	}
+	if lifeSpan > 0 && cfg.jitter > 0 {
+		// 在[-jitter, jitter)范围内随机偏移
+		offset := (rand.Float64()*2 - 1) * cfg.jitter
+		lifeSpan += time.Duration(float64(lifeSpan) * offset)
+		if lifeSpan <= 0 {
+			lifeSpan = 1
+		}
+	}
+	return ct.clampLifeSpan(lifeSpan)
+}
+
+// 将存活时间限制在SetMaxLifeSpan设置的上限之内
+func (ct *CacheTable) clampLifeSpan(lifeSpan time.Duration) time.Duration {
+	if limit := ct.readConfig().maxLifeSpan; limit > 0 && (lifeSpan == 0 || lifeSpan > limit) {
+		lifeSpan = limit
+	}
+	return lifeSpan
+}
+
+// 对导入或恢复的缓存项应用存活时间上限，剩余存活时间超过上限时从现在开始按上限倒计时
+func (ct *CacheTable) clampRemaining(lifeSpan, remaining time.Duration) (time.Duration, time.Duration) {
+	capped := ct.clampLifeSpan(lifeSpan)
+	if capped == lifeSpan {
+		return lifeSpan, remaining
+	}
+	if remaining <= 0 || remaining > capped {
+		remaining = capped
+	}
+	return capped, remaining
+}
+
+// SetLogger 设置内部日志系统，日志会以key=value的格式输出，结构化日志请使用SetStructuredLogger
 func (ct *CacheTable) SetLogger(logger *log.Logger) {
-	ct.Lock()
-	defer ct.Unlock()
-	ct.logger = logger
+	if logger == nil {
+		ct.SetStructuredLogger(nil)
+		return
+	}
+	ct.SetStructuredLogger(NewStdLogger(logger))
 }
 
 // RemoveAddedItemCallBack 清空增加缓存项时触发的回调函数
 func (ct *CacheTable) RemoveAddedItemCallBack() {
-	ct.Lock()
-	defer ct.Unlock()
-	ct.addedItem = nil
+	ct.updateReadConfig(func(c *readConfig) { c.addedItem.clear() })
 }
 
 // SetAddedItemCallback 设置增加缓存项时触发的回调函数
 func (ct *CacheTable) SetAddedItemCallback(f func(*CacheItem)) {
-	if len(ct.addedItem) > 0 {
-		ct.RemoveAddedItemCallBack()
-	}
-	ct.Lock()
-	defer ct.Unlock()
-	ct.addedItem = append(ct.addedItem, f)
+	ct.updateReadConfig(func(c *readConfig) { c.addedItem.set(f) })
 }
 
-// AddAddedItemCallback 新增增加缓存项时触发的回调函数
-func (ct *CacheTable) AddAddedItemCallback(f func(*CacheItem)) {
-	ct.Lock()
-	defer ct.Unlock()
-	ct.addedItem = append(ct.addedItem, f)
+// AddAddedItemCallback 新增增加缓存项时触发的回调函数，返回的句柄可以用于RemoveCallback
+func (ct *CacheTable) AddAddedItemCallback(f func(*CacheItem)) CallbackHandle {
+	var h CallbackHandle
+	ct.updateReadConfig(func(c *readConfig) { h = c.addedItem.add(f) })
+	return h
 }
 
 // SetDeleteItemCallback 设置删除缓存项时触发的回调函数
 func (ct *CacheTable) SetDeleteItemCallback(f func(*CacheItem)) {
-	if len(ct.deletedItem) > 0 {
-		ct.RemoveDeleteItemCallback()
-	}
-	ct.Lock()
-	defer ct.Unlock()
-	ct.deletedItem = append(ct.deletedItem, f)
+	ct.updateReadConfig(func(c *readConfig) { c.deletedItem.set(f) })
 }
 
-// RemoveDeleteItemCallback 清空删除缓存项时触发的回调函数
+// RemoveDeleteItemCallback 清空删除缓存项时触发的回调函数，包括带有删除原因的回调函数
 func (ct *CacheTable) RemoveDeleteItemCallback() {
-	ct.Lock()
-	defer ct.Unlock()
-	ct.deletedItem = nil
+	ct.updateReadConfig(func(c *readConfig) {
+		c.deletedItem.clear()
+		c.deletedItemReason.clear()
+	})
 }
 
-// AddDeleteItemCallback 新增删除缓存项时触发的回调函数
-func (ct *CacheTable) AddDeleteItemCallback(f func(*CacheItem)) {
-	ct.Lock()
-	defer ct.Unlock()
-	ct.deletedItem = append(ct.deletedItem, f)
+// SetDeleteItemReasonCallback 设置删除缓存项时触发的回调函数，回调函数可以获取删除的原因
+func (ct *CacheTable) SetDeleteItemReasonCallback(f func(*CacheItem, DeleteReason)) {
+	ct.updateReadConfig(func(c *readConfig) { c.deletedItemReason.set(f) })
+}
+
+// AddDeleteItemReasonCallback 新增删除缓存项时触发的回调函数，回调函数可以获取删除的原因，返回的句柄可以用于RemoveCallback
+func (ct *CacheTable) AddDeleteItemReasonCallback(f func(*CacheItem, DeleteReason)) CallbackHandle {
+	var h CallbackHandle
+	ct.updateReadConfig(func(c *readConfig) { h = c.deletedItemReason.add(f) })
+	return h
+}
+
+// AddDeleteItemCallback 新增删除缓存项时触发的回调函数，返回的句柄可以用于RemoveCallback
+func (ct *CacheTable) AddDeleteItemCallback(f func(*CacheItem)) CallbackHandle {
+	var h CallbackHandle
+	ct.updateReadConfig(func(c *readConfig) { h = c.deletedItem.add(f) })
+	return h
+}
+
+// RemoveCallback 移除通过AddAddedItemCallback、AddDeleteItemCallback或AddDeleteItemReasonCallback注册的回调函数，
+// 返回是否找到，其余回调函数不受影响
+func (ct *CacheTable) RemoveCallback(h CallbackHandle) bool {
+	found := false
+	ct.updateReadConfig(func(c *readConfig) {
+		found = c.addedItem.remove(h) || c.deletedItem.remove(h) || c.deletedItemReason.remove(h)
+	})
+	return found
 }
 
 // Count 返获取缓存项的个数
 func (ct *CacheTable) Count() int {
-	ct.RLock()
-	defer ct.RUnlock()
-	return len(ct.items)
+	return ct.count()
 }
 
-// Foreach 对所有缓存项进行遍历操作
+// Foreach 对所有缓存项进行遍历操作，遍历期间依次持有每个分片的读锁，耗时的操作请使用Iterator
 func (ct *CacheTable) Foreach(op func(interface{}, *CacheItem)) {
-	ct.RLock()
-	defer ct.RUnlock()
+	ct.rangeItems(op)
+}
+
+// ForeachUntil 与Foreach相同，op返回false时立即停止遍历，适合找到需要的缓存项之后提前结束
+func (ct *CacheTable) ForeachUntil(op func(key interface{}, item *CacheItem) bool) {
+	ct.rangeItemsUntil(op)
+}
+
+// ForeachParallel 使用workers个协程并行遍历所有缓存项，每个协程每次处理一个分片并持有该分片的读锁，
+// 并行度不会超过分片的个数，op会被并发调用，需要保证并发安全，workers小于1时使用GOMAXPROCS
+func (ct *CacheTable) ForeachParallel(workers int, op func(key interface{}, item *CacheItem)) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(ct.shards) {
+		workers = len(ct.shards)
+	}
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= len(ct.shards) {
+					return
+				}
+				sh := ct.shards[i]
+				sh.RLock()
+				for k, v := range sh.items {
+					op(k, v)
+				}
+				sh.RUnlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Keys 获取缓存表中所有的键
+func (ct *CacheTable) Keys() []interface{} {
+	keys := make([]interface{}, 0, ct.count())
+	ct.rangeItems(func(k interface{}, _ *CacheItem) {
+		keys = append(keys, k)
+	})
+	return keys
+}
 
-	for k, v := range ct.items {
-		op(k, v)
+// KeysMatching 获取所有匹配glob模式的字符串键，非字符串的键会被忽略，
+// 模式语法与path.Match相同，其中*不会匹配/
+func (ct *CacheTable) KeysMatching(pattern string) ([]string, error) {
+	// 提前校验模式，避免缓存表为空时无法发现错误的模式
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
 	}
+	var keys []string
+	ct.rangeItems(func(k interface{}, _ *CacheItem) {
+		key, ok := k.(string)
+		if !ok {
+			return
+		}
+		if matched, _ := path.Match(pattern, key); matched {
+			keys = append(keys, key)
+		}
+	})
+	return keys, nil
 }
 
-// 遍历所有的缓存项进行超时检查，更新定时器的持续时间为所有缓存项中距离超时最近的时间，并且异步调用本身
+// 进行超时检查，删除已经到期的缓存项，并将清理协程的定时器重置为距离下一个缓存项到期的时间
 func (ct *CacheTable) expirationCheck() {
 	ct.Lock()
-	// 在每一次调用本函数时，需要停止上一次的计时器，以方便本次设置
-	if ct.cleanupTimer != nil {
-		ct.cleanupTimer.Stop()
+	// 暂停期间不进行超时检查，由ResumeExpiration重新触发，关闭后不再调度
+	if ct.paused || ct.isClosed() {
+		ct.scheduleCleanup(0)
+		ct.Unlock()
+		return
 	}
 
 	if ct.cleanupDuration > 0 {
-		ct.log(ct.name+"缓存表的定时器将于", ct.cleanupDuration, "秒后触发")
+		ct.log(LevelDebug, "定时器触发", "event", "timer", "after", ct.cleanupDuration)
 	} else {
-		ct.log(ct.name + "缓存表的定时器已注册")
+		ct.log(LevelDebug, "定时器已注册", "event", "timer")
 	}
 
-	now := time.Now()
-	// 当前缓存项中距离过期最短的时间
-	smallestDuration := 0 * time.Second
-	for k, v := range ct.items {
-		// 通过局部变量保存，减少持有锁的时间
-		v.RLock()
-		lifeSpan := v.LifeSpan()
-		accessedTime := v.accessedTime
-		v.RUnlock()
+	// 只处理已经到期的缓存项，下一次检查的时间为过期堆中最早的到期时间
+	_, smallestDuration, expired := ct.expireDue(ct.now())
+	ct.scheduleCleanup(smallestDuration)
+	cfg := ct.readConfig()
+	ct.Unlock()
+	ct.notifyDeleted(cfg, expired)
+}
 
-		// 对于存活时间为0的缓存项不去管理
-		if lifeSpan == 0 {
-			continue
+// DeleteExpired 同步删除所有已经过期的缓存项，返回删除的个数，不依赖定时器触发的超时检查
+func (ct *CacheTable) DeleteExpired() int {
+	ct.Lock()
+	count, _, expired := ct.expireDue(ct.now())
+	cfg := ct.readConfig()
+	ct.Unlock()
+	ct.notifyDeleted(cfg, expired)
+	ct.log(LevelInfo, "手动清理过期缓存项", "event", "deleteExpired", "count", count)
+	return count
+}
+
+// PauseExpiration 暂停超时检查并冻结所有缓存项的存活时间倒计时
+func (ct *CacheTable) PauseExpiration() {
+	ct.Lock()
+	defer ct.Unlock()
+	if ct.paused {
+		return
+	}
+	ct.paused = true
+	ct.pausedAt = ct.now()
+	ct.scheduleCleanup(0)
+	ct.log(LevelInfo, "超时检查已暂停", "event", "pause")
+}
+
+// ResumeExpiration 恢复超时检查，暂停期间经过的时间不计入缓存项的存活时间
+func (ct *CacheTable) ResumeExpiration() {
+	ct.Lock()
+	if !ct.paused {
+		ct.Unlock()
+		return
+	}
+	now := ct.now()
+	ct.rangeItems(func(_ interface{}, item *CacheItem) {
+		item.Lock()
+		// 暂停期间被访问过的缓存项只需要补偿访问之后经过的时间
+		from := ct.pausedAt
+		if item.accessedTime.After(from) {
+			from = item.accessedTime
 		}
-		// 距离上次访问经历的时间
-		curDuration := lifeSpan - now.Sub(accessedTime)
-		if curDuration <= 0 {
-			ct.Unlock()
-			// 超时的缓存项进行删除操作
-			if _, err := ct.deleteInternal(k); err != nil {
-				ct.log("缓存表：", ct.name, " 删除缓存项：", k, " 失败")
-			}
-			ct.Lock()
-		} else {
-			// 如果是第一次设置或当前缓存项的持续时间小于记录的最小持续时间就更新
-			if curDuration < smallestDuration || smallestDuration == 0 {
-				smallestDuration = curDuration
+		item.accessedTime = item.accessedTime.Add(now.Sub(from))
+		if item.absolute {
+			from = ct.pausedAt
+			if item.expireBase.After(from) {
+				from = item.expireBase
 			}
+			item.expireBase = item.expireBase.Add(now.Sub(from))
 		}
-	}
-	// 更新table的定时器持续时间
-	ct.cleanupDuration = smallestDuration
-	if smallestDuration > 0 {
-		// 如果当前持续时间大于0，则代表需要继续更新，time.AfterFunc是非阻塞的延时函数
-		// 它会在一段时间后创建协程再次进行超时检查
-		ct.cleanupTimer = time.AfterFunc(smallestDuration, func() {
-			go ct.expirationCheck()
-		})
-	}
+		item.Unlock()
+	})
+	ct.paused = false
+	ct.log(LevelInfo, "超时检查已恢复", "event", "resume", "paused", now.Sub(ct.pausedAt))
 	ct.Unlock()
+
+	ct.expirationCheck()
 }
 
 // 增加缓存项
 func (ct *CacheTable) addInternal(item *CacheItem) {
-	ct.log("向", ct.name, "缓存表中插入数据，key是", item.Key(), "lifeSpan是", item.LifeSpan())
-	ct.Lock()
-	ct.items[item.key] = item
-	expDur := ct.cleanupDuration
-	addedItem := ct.addedItem
-	ct.Unlock()
+	ct.insert(item, nil)
+}
+
+// 插入缓存项，check不为nil时在分片的锁内根据已存在的缓存项判断是否插入，返回是否插入
+func (ct *CacheTable) insert(item *CacheItem, check func(existing *CacheItem) bool) bool {
+	// 高频路径，日志关闭时避免构造参数
+	if ct.logEnabled(LevelDebug) {
+		ct.log(LevelDebug, "插入缓存项", "event", "add", "key", item.Key(), "lifeSpan", item.LifeSpan())
+	}
+	item.Lock()
+	item.table = ct
+	item.version = ct.nextVersion()
+	encoded, err := ct.encode(item.key, item.data)
+	item.data = encoded
+	item.Unlock()
+	if err != nil {
+		return false
+	}
+	ct.markUsed()
+	ct.recordFrequency(item.key)
+	ct.RLock()
+	if ct.isClosed() {
+		ct.RUnlock()
+		return false
+	}
+	if !ct.admit(item.key) {
+		ct.RUnlock()
+		ct.stats.add(&ct.stats.rejections, 1)
+		return false
+	}
+	sh := ct.shardFor(item.key)
+	sh.Lock()
+	existed := sh.items[item.key]
+	if check != nil && !check(existed) {
+		sh.Unlock()
+		ct.RUnlock()
+		return false
+	}
+	sh.set(item.key, item)
+	if existed != nil {
+		ct.untrack(existed)
+	}
+	ct.track(item.key, item)
+	ct.indexPut(item.key, item)
+	sh.Unlock()
+	ct.evictLocked()
+	addedItem := ct.readConfig().addedItem.fns
+	ct.RUnlock()
+	ct.stats.add(&ct.stats.adds, 1)
+	if ct.watched() {
+		ct.emitAdd(item, existed)
+	}
 
 	// 在插入数据后执行回调函数
 	if addedItem != nil {
 		for _, callback := range addedItem {
-			callback(item)
+			callback := callback
+			ct.runCallback(CallbackAddedItem, item.key, func() { callback(item) })
+		}
+	}
+
+	ct.reschedule(item.lifeSpan)
+	return true
+}
+
+// 缓存项个数超出限制时淘汰优先级最低的缓存项中最久未被访问的一个，调用者需要持有缓存表的锁，并且不能持有分片的锁
+func (ct *CacheTable) evictLocked() {
+	for ct.maxItems > 0 && ct.count() > ct.maxItems {
+		victimKey, victim := ct.lruVictim()
+		// 所有缓存项都被固定时无法淘汰
+		if victim == nil {
+			return
+		}
+		sh := ct.shardFor(victimKey)
+		sh.Lock()
+		// 遍历之后其他协程可能已经删除或替换了该缓存项
+		if sh.items[victimKey] == victim {
+			ct.deleteLocked(sh, victimKey, victim, ReasonEvicted)
 		}
+		sh.Unlock()
 	}
+}
+
+// 选出没有被固定的缓存项中优先级最低的，优先级相同时选择最久未被访问的
+func (ct *CacheTable) lruVictim() (interface{}, *CacheItem) {
+	var victimKey interface{}
+	var victim *CacheItem
+	var victimTime time.Time
+	var victimPriority int
+	ct.rangeItems(func(k interface{}, v *CacheItem) {
+		v.RLock()
+		pinned, accessedTime, priority := v.pinned, v.accessedTime, v.priority
+		v.RUnlock()
+		if pinned {
+			return
+		}
+		if victim == nil || priority < victimPriority ||
+			(priority == victimPriority && accessedTime.Before(victimTime)) {
+			victimKey, victim, victimTime, victimPriority = k, v, accessedTime, priority
+		}
+	})
+	return victimKey, victim
+}
+
+// 当缓存项的存活时间发生变化时判断是否需要重新调度定时器
+func (ct *CacheTable) reschedule(lifeSpan time.Duration) {
+	ct.RLock()
+	expDur := ct.cleanupDuration
+	ct.RUnlock()
 
 	// 首先当存活时间大于0时，需要进行超时检查
 	// 如果没有设置定时器，或当前的存活时间小于当前表记录的最短存活时间，立即进行一次超时检查
-	if item.lifeSpan > 0 && (expDur == 0 || item.lifeSpan < expDur) {
+	if lifeSpan > 0 && (expDur == 0 || lifeSpan < expDur) {
 		ct.expirationCheck()
 	}
 }
 
-// Add 新增缓存项，传入键值对和存活时间
+// Add 新增缓存项，传入键值对和存活时间，开启加密并且加密失败时缓存项不会加入缓存表，错误交给错误处理函数
 func (ct *CacheTable) Add(key, data interface{}, lifeSpan time.Duration) *CacheItem {
-	item := NewCacheItem(key, data, lifeSpan)
+	lifeSpan = ct.effectiveLifeSpan(lifeSpan)
+	item := ct.newItem(key, data, lifeSpan)
 
 	ct.addInternal(item)
+	ct.storeSet(key, data, lifeSpan)
 
 	return item
 }
 
-// 删除缓存项
-func (ct *CacheTable) deleteInternal(key interface{}) (*CacheItem, error) {
-	ct.Lock()
-	item, ok := ct.items[key]
+// AddDefault 使用缓存表的默认存活时间新增缓存项
+func (ct *CacheTable) AddDefault(key, data interface{}) *CacheItem {
+	return ct.Add(key, data, DefaultLifeSpan)
+}
+
+// AddAll 批量新增缓存项，所有缓存项使用相同的存活时间，只进行一次超时检查
+func (ct *CacheTable) AddAll(entries map[interface{}]interface{}, lifeSpan time.Duration) []*CacheItem {
+	items := make([]*CacheItem, 0, len(entries))
+	for key, data := range entries {
+		items = append(items, ct.newItem(key, data, ct.effectiveLifeSpan(lifeSpan)))
+	}
+	if ct.logEnabled(LevelDebug) {
+		ct.log(LevelDebug, "批量插入缓存项", "event", "addAll", "count", len(items), "lifeSpan", lifeSpan)
+	}
+	ct.addItems(items)
+	for _, item := range items {
+		ct.storeSet(item.key, entries[item.key], item.lifeSpan)
+	}
+	return items
+}
+
+// 插入多个已经创建好的缓存项，执行回调函数后只进行一次超时检查
+func (ct *CacheTable) addItems(items []*CacheItem) {
+	// 记录最短的剩余存活时间用于调度定时器
+	smallest := time.Duration(0)
+	now := ct.now()
+	// 加密失败的缓存项不会加入缓存表
+	encoded := items[:0:0]
+	for _, item := range items {
+		item.table = ct
+		item.version = ct.nextVersion()
+		data, err := ct.encode(item.key, item.data)
+		if err != nil {
+			continue
+		}
+		item.data = data
+		encoded = append(encoded, item)
+		if item.lifeSpan > 0 {
+			remaining := item.lifeSpan - now.Sub(item.expireBaseLocked())
+			if remaining <= 0 {
+				remaining = 1
+			}
+			if smallest == 0 || remaining < smallest {
+				smallest = remaining
+			}
+		}
+	}
+	items = encoded
+
+	ct.RLock()
+	if ct.isClosed() {
+		ct.RUnlock()
+		return
+	}
+	watched := ct.watched()
+	var existed []*CacheItem
+	if watched {
+		existed = make([]*CacheItem, len(items))
+	}
+	for i, item := range items {
+		sh := ct.shardFor(item.key)
+		sh.Lock()
+		if watched {
+			existed[i] = sh.items[item.key]
+		}
+		if old := sh.items[item.key]; old != nil {
+			ct.untrack(old)
+		}
+		sh.set(item.key, item)
+		ct.track(item.key, item)
+		ct.indexPut(item.key, item)
+		sh.Unlock()
+	}
+	ct.evictLocked()
+	addedItem := ct.readConfig().addedItem.fns
+	ct.RUnlock()
+	ct.stats.add(&ct.stats.adds, int64(len(items)))
+	for i := range existed {
+		ct.emitAdd(items[i], existed[i])
+	}
+
+	// 在插入数据后对每一个缓存项执行回调函数
+	if addedItem != nil {
+		for _, item := range items {
+			item := item
+			for _, callback := range addedItem {
+				callback := callback
+				ct.runCallback(CallbackAddedItem, item.key, func() { callback(item) })
+			}
+		}
+	}
+
+	ct.reschedule(smallest)
+}
+
+// 删除缓存项，传入删除的原因
+func (ct *CacheTable) deleteInternal(key interface{}, reason DeleteReason) (*CacheItem, error) {
+	ct.RLock()
+	defer ct.RUnlock()
+	sh := ct.shardFor(key)
+	sh.Lock()
+	defer sh.Unlock()
+	item, ok := sh.items[key]
 	if !ok {
-		return nil, ErrCacheNotFound
+		return nil, ct.keyError(key, ErrCacheNotFound)
 	}
-	deletedItem := ct.deletedItem
-	// 调用缓存表删除之前的回调函数
-	if deletedItem != nil {
+	ct.deleteLocked(sh, key, item, reason)
+	return item, nil
+}
+
+// 当键仍然对应item时删除缓存项，返回是否删除
+func (ct *CacheTable) deleteItem(key interface{}, item *CacheItem, reason DeleteReason) bool {
+	ct.RLock()
+	defer ct.RUnlock()
+	sh := ct.shardFor(key)
+	sh.Lock()
+	defer sh.Unlock()
+	if cur, ok := sh.items[key]; !ok || cur != item {
+		return false
+	}
+	ct.deleteLocked(sh, key, item, reason)
+	return true
+}
+
+// 已经从分片中删除、等待执行删除回调的缓存项
+type deletion struct {
+	key    interface{}
+	item   *CacheItem
+	reason DeleteReason
+}
+
+// 执行删除回调并从分片中删除缓存项，调用者需要持有缓存表的锁以及分片的写锁
+func (ct *CacheTable) deleteLocked(sh *shard, key interface{}, item *CacheItem, reason DeleteReason) {
+	d := deletion{key, item, reason}
+	ct.notifyDeleted(ct.readConfig(), []deletion{d})
+	ct.removeLocked(sh, d)
+}
+
+// 依次执行缓存表和缓存项的删除回调函数，cfg需要在调用者持有缓存表的锁时读取
+func (ct *CacheTable) notifyDeleted(cfg *readConfig, ds []deletion) {
+	deletedItem, deletedItemReason := cfg.deletedItem.fns, cfg.deletedItemReason.fns
+	for _, d := range ds {
+		key, item, reason := d.key, d.item, d.reason
+		// 调用缓存表删除之前的回调函数
 		for _, callback := range deletedItem {
-			callback(item)
+			callback := callback
+			ct.runCallback(CallbackDeletedItem, key, func() { callback(item) })
 		}
+		for _, callback := range deletedItemReason {
+			callback := callback
+			ct.runCallback(CallbackDeletedItemReason, key, func() { callback(item, reason) })
+		}
+		// 调用缓存项删除之前的回调函数
+		item.RLock()
+		aboutToExpire, withSnapshot := item.aboutToExpire.fns, item.aboutToExpireSnapshot.fns
+		var snapshot SnapshotItem
+		if len(withSnapshot) > 0 {
+			snapshot = item.snapshotLocked(key)
+		}
+		item.RUnlock()
+		for _, callback := range aboutToExpire {
+			callback := callback
+			ct.runCallback(CallbackAboutToExpire, key, func() { callback(key) })
+		}
+		for _, callback := range withSnapshot {
+			callback := callback
+			ct.runCallback(CallbackAboutToExpire, key, func() { callback(snapshot) })
+		}
+	}
+}
+
+// 从分片中删除缓存项并更新统计、索引和过期堆，不执行回调函数，调用者需要持有缓存表的锁以及分片的写锁
+func (ct *CacheTable) removeLocked(sh *shard, d deletion) {
+	key, item, reason := d.key, d.item, d.reason
+	switch reason {
+	case ReasonExpired:
+		ct.stats.add(&ct.stats.expirations, 1)
+	case ReasonEvicted:
+		ct.stats.add(&ct.stats.evictions, 1)
+	default:
+		ct.stats.add(&ct.stats.deletes, 1)
 	}
-	// 调用缓存项删除之前的回调函数
 	item.RLock()
-	defer item.RUnlock()
-	if item.aboutToExpire != nil {
-		for _, callback := range item.aboutToExpire {
-			callback(key)
-		}
+	ct.recordRemovalLocked(key, item, reason)
+	if ct.logEnabled(LevelDebug) {
+		ct.log(LevelDebug, "删除缓存项", "event", reason.String(), "key", key, "createTime", item.createTime, "accessCount", item.accessCount)
 	}
-	ct.log("删除了位于缓存表", ct.name, "中名为", key, "缓存项，创建时间是：", item.createTime, "访问次数是：", item.accessCount)
-	delete(ct.items, key)
-	ct.Unlock()
-	return item, nil
+	data := item.dataLocked()
+	item.RUnlock()
+	if ct.watched() {
+		ct.emitDelete(key, data, reason)
+	}
+	sh.remove(key)
+	ct.untrack(item)
+	ct.indexDelete(key)
+}
+
+// Touch 修改缓存项的存活时间并刷新最后访问时间，不会改变创建时间和访问次数，可以传入DefaultLifeSpan
+func (ct *CacheTable) Touch(key interface{}, lifeSpan time.Duration) error {
+	item, ok := ct.lookup(key)
+	if !ok {
+		return ct.keyError(key, ErrCacheNotFound)
+	}
+	item.Touch(ct.effectiveLifeSpan(lifeSpan))
+	return nil
+}
+
+// TTL 获取缓存项距离过期的剩余时间，含义与CacheItem.TTL相同
+func (ct *CacheTable) TTL(key interface{}) (time.Duration, error) {
+	item, ok := ct.lookup(key)
+	if !ok {
+		return 0, ct.keyError(key, ErrCacheNotFound)
+	}
+	return item.TTL(), nil
 }
 
-// Delete 删除缓存项，传入键
+// Delete 删除缓存项，传入键，二级存储开启删除同步时同时删除其中的数据，此时缓存表中不存在该键也不返回错误
 func (ct *CacheTable) Delete(key interface{}) (*CacheItem, error) {
-	return ct.deleteInternal(key)
+	item, err := ct.deleteInternal(key, ReasonDeleted)
+	if ct.propagateDeletes() {
+		// 缓存表中不存在的键仍然可能存在于二级存储中
+		ct.storeDelete(key)
+		if errors.Is(err, ErrCacheNotFound) {
+			err = nil
+		}
+	}
+	return item, err
 }
 
-// Exists 通过键检查缓存项是否存在，如果不存在不会进行创建
-func (ct *CacheTable) Exists(key interface{}) bool {
+// DeleteAll 批量删除缓存项，对每一个被删除的缓存项执行回调函数，返回实际存在并被删除的键
+func (ct *CacheTable) DeleteAll(keys ...interface{}) []interface{} {
+	var deleted []interface{}
+	ct.RLock()
+	for _, key := range keys {
+		sh := ct.shardFor(key)
+		sh.Lock()
+		if item, ok := sh.items[key]; ok {
+			ct.deleteLocked(sh, key, item, ReasonDeleted)
+			deleted = append(deleted, key)
+		}
+		sh.Unlock()
+	}
+	ct.RUnlock()
+
+	for _, key := range keys {
+		ct.storeDelete(key)
+	}
+	return deleted
+}
+
+// DeleteFunc 遍历缓存表，删除所有满足条件的缓存项并执行删除回调函数，返回删除的个数，
+// 遍历期间依次持有每个分片的写锁
+func (ct *CacheTable) DeleteFunc(match func(key interface{}, item *CacheItem) bool) int {
+	keys := ct.deleteWhere(match, ReasonDeleted)
+	for _, key := range keys {
+		ct.storeDelete(key)
+	}
+	return len(keys)
+}
+
+// 删除所有满足条件的缓存项，传入删除的原因，返回删除的键
+func (ct *CacheTable) deleteWhere(match func(key interface{}, item *CacheItem) bool, reason DeleteReason) []interface{} {
 	ct.RLock()
 	defer ct.RUnlock()
-	_, ok := ct.items[key]
+	var keys []interface{}
+	for _, sh := range ct.shards {
+		sh.Lock()
+		for key, item := range sh.items {
+			if match(key, item) {
+				ct.deleteLocked(sh, key, item, reason)
+				keys = append(keys, key)
+			}
+		}
+		sh.Unlock()
+	}
+	return keys
+}
+
+// Update 在缓存项的锁内根据旧数据计算新数据，保证读取-修改-写入的原子性，
+// f返回keep为false时会删除该缓存项，缓存项不存在时返回ErrCacheNotFound
+func (ct *CacheTable) Update(key interface{}, f func(old interface{}) (new interface{}, keep bool)) error {
+	return ct.update(key, func(old interface{}) (interface{}, bool, bool) {
+		data, keep := f(old)
+		return data, keep, keep
+	})
+}
+
+// 在缓存项的锁内修改数据，f额外返回数据是否发生了变化，用于决定是否发送变更事件
+func (ct *CacheTable) update(key interface{}, f func(old interface{}) (new interface{}, keep, changed bool)) error {
+	item, ok := ct.lookup(key)
+	if !ok {
+		return ct.keyError(key, ErrCacheNotFound)
+	}
+
+	item.Lock()
+	old := item.dataLocked()
+	data, keep, changed := f(old)
+	if keep && changed {
+		encoded, err := ct.encode(key, data)
+		if err != nil {
+			item.Unlock()
+			return ct.keyError(key, err)
+		}
+		item.data = encoded
+		item.version = ct.nextVersion()
+	}
+	item.Unlock()
+
+	if keep && changed {
+		ct.reindex(key, item)
+		ct.storeSet(key, data, item.LifeSpan())
+	}
+	if keep && changed && ct.watched() {
+		ct.emit(Event{Type: WatchUpdate, Key: key, OldData: old, NewData: data, Time: ct.now()})
+	}
+
+	if !keep {
+		// 释放缓存项的锁之后缓存项可能已被替换，只删除同一个缓存项
+		ct.deleteItem(key, item, ReasonDeleted)
+		ct.storeDelete(key)
+	}
+	return nil
+}
+
+// CompareAndSwap 当缓存项的数据等于old时替换为new，返回是否替换成功，
+// 与sync.Map相同，old必须是可比较的类型，缓存项不存在时返回ErrCacheNotFound
+func (ct *CacheTable) CompareAndSwap(key, old, new interface{}) (bool, error) {
+	swapped := false
+	err := ct.update(key, func(cur interface{}) (interface{}, bool, bool) {
+		if cur == old {
+			swapped = true
+			return new, true, true
+		}
+		return cur, true, false
+	})
+	return swapped, err
+}
+
+// Pop 原子地获取并删除缓存项，返回缓存项的数据，会执行删除回调函数
+func (ct *CacheTable) Pop(key interface{}) (interface{}, error) {
+	item, err := ct.deleteInternal(key, ReasonDeleted)
+	if err != nil {
+		return nil, err
+	}
+	ct.storeDelete(key)
+	return item.Data(), nil
+}
+
+// Exists 通过键检查缓存项是否存在，如果不存在不会进行创建
+func (ct *CacheTable) Exists(key interface{}) bool {
+	_, ok := ct.lookup(key)
 
 	return ok
 }
 
+// Peek 获取缓存项但不调用KeepAlive，不影响访问次数、最后访问时间和命中统计，也不会执行loadData，
+// 适合监控和调试时查看缓存项，缓存项不存在时返回ErrCacheNotFound
+func (ct *CacheTable) Peek(key interface{}) (*CacheItem, error) {
+	if ct.Closed() {
+		return nil, ErrTableClosed
+	}
+	item, ok := ct.lookup(key)
+	if !ok {
+		return nil, ct.keyError(key, ErrCacheNotFound)
+	}
+	return item, nil
+}
+
 // NotFoundAdd 通过键检查缓存项是否存在，如果不存在就会进行创建，不会执行loadData
 func (ct *CacheTable) NotFoundAdd(key interface{}, lifeSpan time.Duration, data interface{}) bool {
-	ct.Lock()
-
-	if _, ok := ct.items[key]; ok {
-		ct.Unlock()
+	if _, ok := ct.lookup(key); ok {
 		return false
 	}
-	ct.Unlock()
-	item := NewCacheItem(key, data, lifeSpan)
-	ct.addInternal(item)
+	lifeSpan = ct.effectiveLifeSpan(lifeSpan)
+	item := ct.newItem(key, data, lifeSpan)
 
-	return true
+	// 检查和插入之间其他协程可能已经插入了同一个键
+	added := ct.insert(item, func(existing *CacheItem) bool {
+		return existing == nil
+	})
+	if added {
+		ct.storeSet(key, data, lifeSpan)
+	}
+	return added
+}
+
+// Replace 替换已存在缓存项的数据和存活时间，不会重置创建时间和访问次数，缓存项不存在时返回ErrCacheNotFound，
+// 与NotFoundAdd相对应，可以传入DefaultLifeSpan
+func (ct *CacheTable) Replace(key, data interface{}, lifeSpan time.Duration) error {
+	item, ok := ct.lookup(key)
+	if !ok {
+		return ct.keyError(key, ErrCacheNotFound)
+	}
+	lifeSpan = ct.effectiveLifeSpan(lifeSpan)
+	encoded, err := ct.encode(key, data)
+	if err != nil {
+		return ct.keyError(key, err)
+	}
+
+	item.Lock()
+	old := item.dataLocked()
+	item.data = encoded
+	item.version = ct.nextVersion()
+	item.Unlock()
+	ct.reindex(key, item)
+	if ct.watched() {
+		ct.emit(Event{Type: WatchUpdate, Key: key, OldData: old, NewData: data, Time: ct.now()})
+	}
+	item.SetLifeSpan(lifeSpan)
+	ct.storeSet(key, data, lifeSpan)
+	return nil
+}
+
+// Rename 将缓存项重新绑定到新的键上，保留存活时间、访问次数和回调函数，
+// 旧键不存在时返回ErrCacheNotFound，新键已存在时返回ErrCacheExists。
+// 对订阅者和二级存储而言相当于删除旧键并新增新键，缓存项会获得新的版本号
+func (ct *CacheTable) Rename(oldKey, newKey interface{}) error {
+	item, err := ct.rename(oldKey, newKey)
+	if err != nil {
+		return err
+	}
+	data := item.Data()
+	if ct.watched() {
+		ct.emitDelete(oldKey, data, ReasonDeleted)
+		ct.emitAdd(item, nil)
+	}
+	ct.storeDelete(oldKey)
+	ct.storeSet(newKey, data, item.LifeSpan())
+	return nil
+}
+
+// 在分片中移动缓存项，返回移动的缓存项
+func (ct *CacheTable) rename(oldKey, newKey interface{}) (*CacheItem, error) {
+	ct.RLock()
+	defer ct.RUnlock()
+	// 按照分片的下标顺序加锁，避免并发重命名时死锁
+	i, j := ct.shardIndex(oldKey), ct.shardIndex(newKey)
+	oldShard, newShard := ct.shards[i], ct.shards[j]
+	if i > j {
+		newShard.Lock()
+		defer newShard.Unlock()
+	}
+	oldShard.Lock()
+	defer oldShard.Unlock()
+	if i < j {
+		newShard.Lock()
+		defer newShard.Unlock()
+	}
+	item, ok := oldShard.items[oldKey]
+	if !ok {
+		return nil, ct.keyError(oldKey, ErrCacheNotFound)
+	}
+	if _, ok := newShard.items[newKey]; ok {
+		return nil, ct.keyError(newKey, ErrCacheExists)
+	}
+
+	item.Lock()
+	item.key = newKey
+	item.version = ct.nextVersion()
+	item.Unlock()
+	oldShard.remove(oldKey)
+	newShard.set(newKey, item)
+	ct.track(newKey, item)
+	ct.indexDelete(oldKey)
+	ct.indexPut(newKey, item)
+	ct.log(LevelDebug, "重命名缓存项", "event", "rename", "key", oldKey, "newKey", newKey)
+	return item, nil
 }
 
 // Value 根据键获取值，并延长存活时间，如果未设置loadData不会创建新的缓存项，可传入参数为loadData函数使用
 func (ct *CacheTable) Value(key interface{}, args ...interface{}) (*CacheItem, error) {
-	ct.RLock()
+	return ct.ValueContext(context.Background(), key, args...)
+}
 
-	r, ok := ct.items[key]
-	loadData := ct.loadData
-	ct.RUnlock()
+// ValueContext 与Value相同，ctx用于链路追踪，设置了Tracer时会记录命中情况以及loadData的执行
+func (ct *CacheTable) ValueContext(ctx context.Context, key interface{}, args ...interface{}) (*CacheItem, error) {
+	// 命中时不获取缓存表的锁，只读取原子替换的配置和分片的无锁索引
+	cfg := ct.readConfig()
+	r, ok := ct.lookup(key)
+	loadData, tracer := cfg.loadData, cfg.tracer
+	if cfg.closed {
+		return nil, ErrTableClosed
+	}
+	if !ct.allow(key) {
+		return nil, ErrRateLimited
+	}
+	ct.markUsed()
+	ct.recordFrequency(key)
+
+	var span Span
+	if tracer != nil {
+		ctx, span = tracer.Start(ctx, SpanValue, ct.Name(), key)
+	}
+	if ok && loadData != nil && ct.staleWhileRevalidate > 0 {
+		if over := r.expiredFor(ct.now()); over > ct.staleWhileRevalidate {
+			// 超过过期数据的上限，删除后同步加载
+			ct.deleteItem(key, r, ReasonExpired)
+			ok = false
+		} else if over > 0 {
+			// 直接返回过期的数据，在后台刷新，不更新最后访问时间
+			ct.refresh(r, loadData, args...)
+			ct.recordHit(key)
+			if span != nil {
+				span.Event(EventStale)
+				span.End(nil)
+			}
+			return r, nil
+		}
+	}
 	if ok {
+		if loadData != nil && ct.shouldRefresh(r) {
+			ct.refresh(r, loadData, args...)
+		}
 		// 更新缓存项的访问次数和最后访问时间
-		r.KeepAlive()
+		ct.hit(r)
+		ct.recordHit(key)
+		if span != nil {
+			span.Event(EventHit)
+			span.End(nil)
+		}
 		return r, nil
 	}
 
-	// 如果缓存不存在且存在loadData回调函数，那么就执行loadData，并创建缓存项
+	ct.recordMiss(key)
+	if span == nil {
+		return ct.load(ctx, key, loadData, args...)
+	}
+	span.Event(EventMiss)
+	item, err := ct.load(ctx, key, loadData, args...)
+	span.End(err)
+	return item, err
+}
+
+// 如果缓存不存在且存在loadData回调函数，那么就执行loadData，并创建缓存项，
+// 超出loadData的并发数或执行时间限制时返回对应的错误
+func (ct *CacheTable) load(ctx context.Context, key interface{}, loadData func(interface{}, ...interface{}) *CacheItem, args ...interface{}) (*CacheItem, error) {
 	if loadData != nil {
-		item := loadData(key, args...)
+		tracer := ct.readConfig().tracer
+		var span Span
+		if tracer != nil {
+			_, span = tracer.Start(ctx, SpanLoad, ct.Name(), key)
+		}
+
+		item, err := ct.callLoader(ctx, key, loadData, args...)
 		if item != nil {
-			ct.Add(key, item.data, item.lifeSpan)
+			ct.stats.add(&ct.stats.loads, 1)
+			if span != nil {
+				span.End(nil)
+			}
+			// 加载的数据来自数据源，不需要写入二级存储
+			ct.addInternal(ct.newItem(key, item.data, ct.effectiveLifeSpan(item.lifeSpan)))
 			return item, nil
 		}
-		return nil, ErrCacheNotFoundOrLoadable
+		if err == nil {
+			err = ct.keyError(key, ErrCacheNotFoundOrLoadable)
+		} else {
+			err = ct.loaderError(key, err)
+		}
+		ct.stats.add(&ct.stats.loadFailures, 1)
+		if span != nil {
+			span.End(err)
+		}
+		return nil, err
+	}
+	if ct.readThrough() {
+		return ct.loadFromStore(ctx, key)
+	}
+	return nil, ct.keyError(key, ErrCacheNotFound)
+}
+
+// Values 批量获取缓存项，返回找到的缓存项以及缺失的键，
+// 对于缺失的键如果设置了loadData会尝试加载，加载失败的键会出现在缺失列表中
+func (ct *CacheTable) Values(keys ...interface{}) (map[interface{}]*CacheItem, []interface{}) {
+	found := make(map[interface{}]*CacheItem, len(keys))
+	var missing []interface{}
+
+	for _, key := range keys {
+		if r, ok := ct.lookup(key); ok {
+			found[key] = r
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	loadData := ct.readConfig().loadData
+	for _, key := range missing {
+		ct.recordMiss(key)
+	}
+
+	// 更新缓存项的访问次数和最后访问时间
+	for key, r := range found {
+		ct.recordHit(key)
+		ct.hit(r)
+	}
+
+	if (loadData == nil && !ct.readThrough()) || len(missing) == 0 {
+		return found, missing
+	}
+	var notLoaded []interface{}
+	for _, key := range missing {
+		if item, err := ct.load(context.Background(), key, loadData); err == nil {
+			found[key] = item
+		} else {
+			notLoaded = append(notLoaded, key)
+		}
+	}
+	return found, notLoaded
+}
+
+// GetOrCompute 获取缓存项，如果不存在就调用compute计算数据并以lifeSpan存入缓存表，与SetDataLoader无关，
+// 同一个键并发调用时只会执行一次compute，其余调用者等待并共享结果，compute返回错误时不会存入缓存表
+func (ct *CacheTable) GetOrCompute(key interface{}, lifeSpan time.Duration, compute func() (interface{}, error)) (*CacheItem, error) {
+	if r, ok := ct.lookup(key); ok {
+		ct.hit(r)
+		ct.recordHit(key)
+		return r, nil
+	}
+	ct.computingMu.Lock()
+	// 获取锁期间其他调用者可能已经完成了计算，计算结果在移出computing之前就已存入缓存表
+	if r, ok := ct.lookup(key); ok {
+		ct.computingMu.Unlock()
+		ct.hit(r)
+		ct.recordHit(key)
+		return r, nil
+	}
+	ct.recordMiss(key)
+	if c, ok := ct.computing[key]; ok {
+		ct.computingMu.Unlock()
+		// 等待正在进行的计算
+		c.wg.Wait()
+		return c.item, c.err
+	}
+	if ct.computing == nil {
+		ct.computing = make(map[interface{}]*computeCall)
+	}
+	c := &computeCall{}
+	c.wg.Add(1)
+	ct.computing[key] = c
+	ct.computingMu.Unlock()
+
+	defer func() {
+		ct.computingMu.Lock()
+		delete(ct.computing, key)
+		ct.computingMu.Unlock()
+		c.wg.Done()
+	}()
+
+	start := time.Now()
+	data, err := compute()
+	ct.recordLoad(key, time.Since(start), err)
+	if err != nil {
+		ct.stats.add(&ct.stats.loadFailures, 1)
+		c.err = err
+		return nil, err
 	}
-	return nil, ErrCacheNotFound
+	ct.stats.add(&ct.stats.loads, 1)
+	c.item = ct.Add(key, data, lifeSpan)
+	return c.item, nil
 }
 
-// Flush 清空缓存表
+// Flush 清空缓存表，不执行删除回调函数，也不会同步到二级存储，需要时使用FlushWithOptions，
+// 订阅者会收到每个缓存项原因为ReasonFlushed的WatchDelete事件
 func (ct *CacheTable) Flush() {
 	ct.Lock()
-	defer ct.Unlock()
+	ct.log(LevelInfo, "清空缓存表", "event", "flush")
+	removed := ct.resetShards(ct.watched())
+	ct.scheduleCleanup(0)
+	ct.Unlock()
 
-	ct.log("清空", ct.name, "缓存表")
+	ct.emitFlushed(removed)
+}
 
-	ct.items = make(map[interface{}]*CacheItem)
-	ct.cleanupDuration = 0
-	if ct.cleanupTimer != nil {
-		ct.cleanupTimer.Stop()
-	}
+// Close 关闭缓存表，停止定时器并且不再进行超时检查，清空所有缓存项但不执行删除回调函数，订阅者会收到ReasonFlushed的删除事件，
+// 关闭后新增操作会被忽略，Value返回ErrTableClosed，缓存表同时会从注册中心移除，再次调用Cache会创建新的缓存表
+func (ct *CacheTable) Close() {
+	ct.close(false)
+}
+
+// CloseWithCallbacks 与Close相同，但会对每一个缓存项以ReasonFlushed执行删除回调函数
+func (ct *CacheTable) CloseWithCallbacks() {
+	ct.close(true)
 }
 
-// 打印日志
-func (ct *CacheTable) log(v ...interface{}) {
-	if ct.logger == nil {
+func (ct *CacheTable) close(callbacks bool) {
+	ct.Lock()
+	if ct.isClosed() {
+		ct.Unlock()
 		return
 	}
-	ct.logger.Println(v...)
+	ct.updateReadConfig(func(c *readConfig) { c.closed = true })
+	ct.scheduleCleanup(0)
+	janitor := ct.janitor
+	if callbacks {
+		// deleteLocked同时会发送删除事件
+		for _, sh := range ct.shards {
+			sh.Lock()
+			for key, item := range sh.items {
+				ct.deleteLocked(sh, key, item, ReasonFlushed)
+			}
+			sh.Unlock()
+		}
+	}
+	removed := ct.resetShards(!callbacks && ct.watched())
+	ct.log(LevelInfo, "关闭缓存表", "event", "close")
+	ct.Unlock()
+
+	ct.emitFlushed(removed)
+	// 清理协程可能正在等待缓存表的锁，需要在释放锁之后等待它退出
+	ct.stopJanitor(janitor)
+	if ct.writeBehind != nil {
+		ct.writeBehind.close()
+	}
+	if ct.callbackPool != nil {
+		ct.callbackPool.stop()
+	}
+	unregister(ct)
+}
+
+// Closed 判断缓存表是否已经被关闭
+func (ct *CacheTable) Closed() bool {
+	return ct.isClosed()
 }
 
 // CacheItemPair 存储键和访问次数
@@ -313,32 +1302,10 @@ func (p CacheItemPairList) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 func (p CacheItemPairList) Len() int           { return len(p) }
 func (p CacheItemPairList) Less(i, j int) bool { return p[i].AccessCount > p[j].AccessCount }
 
-// MostAccessed 返回最多访问的缓存项，传入限制个数
+// MostAccessed 返回最多访问的缓存项，传入限制个数，按访问次数从高到低排列，
+// 使用大小为count的最小堆选择，不会对所有缓存项排序
 func (ct *CacheTable) MostAccessed(count int64) []*CacheItem {
-	ct.RLock()
-	defer ct.RUnlock()
-
-	p := make(CacheItemPairList, len(ct.items))
-	i := 0
-	for k, v := range ct.items {
-		p[i] = CacheItemPair{k, v.accessCount}
-		i++
-	}
-	sort.Sort(p)
-
-	var r []*CacheItem
-	c := int64(0)
-	for _, v := range p {
-		if c >= count {
-			break
-		}
-
-		item, ok := ct.items[v.Key]
-		if ok {
-			r = append(r, item)
-		}
-		c++
-	}
-
-	return r
+	return ct.topItems(count, func(item *CacheItem) int64 {
+		return item.AccessedCount()
+	})
 }
@@ -0,0 +1,111 @@
+package cache2go
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// 回调函数的名字，用于CallbackError.Callback
+const (
+	CallbackAddedItem         = "addedItem"
+	CallbackDeletedItem       = "deletedItem"
+	CallbackDeletedItemReason = "deletedItemReason"
+	CallbackAboutToExpire     = "aboutToExpire"
+	CallbackAccessed          = "accessed"
+	CallbackRenew             = "renew"
+	CallbackStoreError        = "storeError"
+)
+
+// CallbackError 回调函数执行时发生了panic，panic会被恢复，不会影响缓存表的操作和超时检查
+type CallbackError struct {
+	Table    string
+	Key      interface{}
+	Callback string
+	// recover得到的值以及发生panic时的调用栈
+	Panic interface{}
+	Stack []byte
+}
+
+func (e *CallbackError) Error() string {
+	return fmt.Sprintf(localize("缓存表%s的%s回调函数发生panic，key=%v：%v", "%[2]s callback of table %[1]s panicked, key=%[3]v: %[4]v"), e.Table, e.Callback, e.Key, e.Panic)
+}
+
+// WithErrorHandler 设置错误处理函数，回调函数发生panic、写入二级存储失败以及加密缓存项失败时调用，
+// 未设置时以LevelWarn打印日志。处理函数可能在缓存表加锁时执行，不能调用同一个缓存表的方法
+func WithErrorHandler(f func(err error, table *CacheTable, key interface{})) Option {
+	return func(ct *CacheTable) {
+		ct.errorHandler = f
+	}
+}
+
+// 执行回调函数并恢复其中的panic，返回是否正常执行完成
+func (ct *CacheTable) safeCall(callback string, key interface{}, f func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+			ct.reportError(&CallbackError{
+				Table:    ct.Name(),
+				Key:      key,
+				Callback: callback,
+				Panic:    r,
+				Stack:    debug.Stack(),
+			}, key)
+		}
+	}()
+	f()
+	return true
+}
+
+// 将错误交给错误处理函数
+func (ct *CacheTable) reportError(err error, key interface{}) {
+	if ct.errorHandler != nil {
+		ct.errorHandler(err, ct, key)
+		return
+	}
+	ct.log(LevelWarn, "执行失败", "event", "error", "key", key, "error", err)
+}
+
+// CallbackHandle 注册回调函数时返回的句柄，可以通过RemoveCallback单独移除该回调函数
+type CallbackHandle uint64
+
+var callbackHandles atomic.Uint64
+
+// 回调函数列表，每个回调函数对应一个句柄。移除时总是创建新的切片，
+// 调用者在锁内读取fns之后可以在释放锁之后安全遍历
+type callbackList[F any] struct {
+	handles []CallbackHandle
+	fns     []F
+}
+
+func (l *callbackList[F]) add(f F) CallbackHandle {
+	h := CallbackHandle(callbackHandles.Add(1))
+	l.handles = append(l.handles, h)
+	l.fns = append(l.fns, f)
+	return h
+}
+
+// 清空之后设置为只有f一个回调函数
+func (l *callbackList[F]) set(f F) CallbackHandle {
+	l.clear()
+	return l.add(f)
+}
+
+func (l *callbackList[F]) clear() {
+	l.handles, l.fns = nil, nil
+}
+
+// 移除句柄对应的回调函数，返回是否找到
+func (l *callbackList[F]) remove(h CallbackHandle) bool {
+	for i, cur := range l.handles {
+		if cur != h {
+			continue
+		}
+		handles := make([]CallbackHandle, 0, len(l.handles)-1)
+		fns := make([]F, 0, len(l.fns)-1)
+		l.handles = append(append(handles, l.handles[:i]...), l.handles[i+1:]...)
+		l.fns = append(append(fns, l.fns[:i]...), l.fns[i+1:]...)
+		return true
+	}
+	return false
+}
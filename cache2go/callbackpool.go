@@ -0,0 +1,125 @@
+package cache2go
+
+import "sync"
+
+// WithAsyncCallbacks 在workers个后台协程中执行新增、删除和过期时的回调函数，
+// Add、Delete等操作不再等待回调函数执行完成，也不会在执行回调函数时持有锁；
+// 同一个键的回调函数总是由同一个协程按照发生的顺序执行，不同键之间不保证顺序。
+// 等待执行的回调函数没有数量限制，回调函数执行得比写入慢时队列会持续增长并占用内存，
+// 可以通过WaitCallbacks等待它们执行完成，workers小于1时按1处理
+func WithAsyncCallbacks(workers int) Option {
+	return func(ct *CacheTable) {
+		if workers < 1 {
+			workers = 1
+		}
+		ct.callbackPool = newCallbackPool(workers)
+	}
+}
+
+// WaitCallbacks 等待所有已经提交的异步回调函数执行完成，未开启异步回调时直接返回
+func (ct *CacheTable) WaitCallbacks() {
+	if ct.callbackPool != nil {
+		ct.callbackPool.wait()
+	}
+}
+
+// 执行回调函数，开启异步回调时交给后台协程执行
+func (ct *CacheTable) runCallback(callback string, key interface{}, f func()) {
+	if ct.callbackPool == nil || !ct.callbackPool.submit(hashKey(key), func() { ct.safeCall(callback, key, f) }) {
+		ct.safeCall(callback, key, f)
+	}
+}
+
+// 执行回调函数的协程池，每个协程有自己的队列
+type callbackPool struct {
+	workers []*callbackWorker
+	// 已提交但尚未执行完成的回调函数个数，归零时唤醒wait
+	mu      sync.Mutex
+	idle    *sync.Cond
+	pending int
+}
+
+type callbackWorker struct {
+	sync.Mutex
+	queue  []func()
+	notify chan struct{}
+	closed bool
+}
+
+func newCallbackPool(n int) *callbackPool {
+	p := &callbackPool{workers: make([]*callbackWorker, n)}
+	p.idle = sync.NewCond(&p.mu)
+	for i := range p.workers {
+		w := &callbackWorker{notify: make(chan struct{}, 1)}
+		p.workers[i] = w
+		go p.run(w)
+	}
+	return p
+}
+
+// 将回调函数放入哈希值对应的协程的队列，协程池已经停止时返回false
+func (p *callbackPool) submit(hash uint64, f func()) bool {
+	w := p.workers[hash%uint64(len(p.workers))]
+	w.Lock()
+	if w.closed {
+		w.Unlock()
+		return false
+	}
+	p.mu.Lock()
+	p.pending++
+	p.mu.Unlock()
+	w.queue = append(w.queue, f)
+	w.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (p *callbackPool) run(w *callbackWorker) {
+	for range w.notify {
+		for {
+			w.Lock()
+			if len(w.queue) == 0 {
+				closed := w.closed
+				w.Unlock()
+				if closed {
+					return
+				}
+				break
+			}
+			f := w.queue[0]
+			w.queue[0] = nil
+			w.queue = w.queue[1:]
+			w.Unlock()
+			f()
+			p.mu.Lock()
+			if p.pending--; p.pending == 0 {
+				p.idle.Broadcast()
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *callbackPool) wait() {
+	p.mu.Lock()
+	for p.pending > 0 {
+		p.idle.Wait()
+	}
+	p.mu.Unlock()
+}
+
+// 停止接收新的回调函数，已经提交的回调函数仍然会被执行
+func (p *callbackPool) stop() {
+	for _, w := range p.workers {
+		w.Lock()
+		w.closed = true
+		w.Unlock()
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+}
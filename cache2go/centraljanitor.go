@@ -0,0 +1,133 @@
+package cache2go
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultJanitorTick 共享清理协程的时间轮每一格的默认时长
+const DefaultJanitorTick = 100 * time.Millisecond
+
+// 时间轮的格数，超过一圈的定时通过圈数表示
+const janitorWheelSize = 512
+
+// WithCentralJanitor 使用所有缓存表共享的清理协程进行定时清理，不再为缓存表单独创建定时器和协程，
+// 适合存在大量缓存表的进程。共享协程使用时间轮调度，超时检查最多延后一格的时长，见SetJanitorTick；
+// 所有缓存表的超时检查在同一个协程中依次执行，删除回调函数耗时较长时会推迟其他缓存表的清理。
+// 同时使用WithContext时仍然会为缓存表创建一个等待ctx结束的协程
+func WithCentralJanitor() Option {
+	return func(ct *CacheTable) {
+		ct.centralJanitor = true
+	}
+}
+
+// SetJanitorTick 设置共享清理协程的时间轮每一格的时长，小于等于0时使用DefaultJanitorTick，
+// 只影响之后的定时，应在创建缓存表之前调用
+func SetJanitorTick(d time.Duration) {
+	if d <= 0 {
+		d = DefaultJanitorTick
+	}
+	sharedJanitor.mu.Lock()
+	defer sharedJanitor.mu.Unlock()
+	sharedJanitor.tick = d
+	if sharedJanitor.ticker != nil {
+		sharedJanitor.ticker.Reset(d)
+	}
+}
+
+// 共享清理协程，使用单层时间轮记录每个缓存表下一次超时检查的时间，每个缓存表最多有一个定时，
+// 存在定时时才运行协程和ticker，没有定时后退出，不会产生空闲的唤醒
+type centralJanitor struct {
+	mu     sync.Mutex
+	tick   time.Duration
+	pos    int
+	slots  [janitorWheelSize]map[*CacheTable]struct{}
+	timers map[*CacheTable]*wheelTimer
+	ticker *time.Ticker
+}
+
+// 缓存表在时间轮中的定时，rounds为指针转过slot时还需要等待的圈数
+type wheelTimer struct {
+	slot   int
+	rounds int
+}
+
+var sharedJanitor = &centralJanitor{tick: DefaultJanitorTick}
+
+// 在d之后对缓存表进行超时检查，替换之前的定时，d小于等于0时取消定时
+func (j *centralJanitor) schedule(ct *CacheTable, d time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if t, ok := j.timers[ct]; ok {
+		delete(j.slots[t.slot], ct)
+		delete(j.timers, ct)
+	}
+	if d <= 0 {
+		return
+	}
+	ticks := int((d + j.tick - 1) / j.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	t := &wheelTimer{
+		slot:   (j.pos + ticks) % janitorWheelSize,
+		rounds: (ticks - 1) / janitorWheelSize,
+	}
+	if j.slots[t.slot] == nil {
+		j.slots[t.slot] = make(map[*CacheTable]struct{})
+	}
+	j.slots[t.slot][ct] = struct{}{}
+	if j.timers == nil {
+		j.timers = make(map[*CacheTable]*wheelTimer)
+	}
+	j.timers[ct] = t
+	if j.ticker == nil {
+		j.ticker = time.NewTicker(j.tick)
+		go j.run(j.ticker)
+	}
+}
+
+func (j *centralJanitor) run(ticker *time.Ticker) {
+	for range ticker.C {
+		// 超时检查会重新调度定时，不能持有时间轮的锁
+		for _, ct := range j.advance() {
+			ct.expirationCheck()
+		}
+		if j.stopIfIdle(ticker) {
+			return
+		}
+	}
+}
+
+// 将指针前进一格，返回到期的缓存表
+func (j *centralJanitor) advance() []*CacheTable {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.pos = (j.pos + 1) % janitorWheelSize
+	var due []*CacheTable
+	for ct := range j.slots[j.pos] {
+		t := j.timers[ct]
+		if t.rounds > 0 {
+			t.rounds--
+			continue
+		}
+		delete(j.slots[j.pos], ct)
+		delete(j.timers, ct)
+		due = append(due, ct)
+	}
+	return due
+}
+
+// 没有任何定时时停止ticker，返回协程是否应该退出
+func (j *centralJanitor) stopIfIdle(ticker *time.Ticker) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.timers) > 0 {
+		return false
+	}
+	ticker.Stop()
+	if j.ticker == ticker {
+		j.ticker = nil
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package cache2go
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync/atomic"
+)
+
+// Codec 缓存项数据的压缩算法
+type Codec interface {
+	Encode(src []byte) ([]byte, error)
+	Decode(src []byte) ([]byte, error)
+}
+
+// GzipCodec 使用gzip压缩，Level为0时使用gzip.DefaultCompression
+type GzipCodec struct {
+	Level int
+}
+
+// Encode 压缩数据
+func (c GzipCodec) Encode(src []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode 解压数据
+func (c GzipCodec) Decode(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// WithCompression 开启数据压缩，类型为[]byte或string并且长度不小于threshold的数据会使用codec压缩后保存，
+// 读取时自动解压，对调用者透明；压缩失败或压缩后没有变小时保存原始数据
+func WithCompression(codec Codec, threshold int) Option {
+	return func(ct *CacheTable) {
+		ct.codec = codec
+		ct.compressThreshold = threshold
+	}
+}
+
+// CompressionStats 压缩的统计信息，累计所有被压缩过的数据
+type CompressionStats struct {
+	// 被压缩的数据个数
+	Values int64 `json:"values"`
+	// 压缩前的总字节数
+	OriginalBytes int64 `json:"originalBytes"`
+	// 压缩后的总字节数
+	CompressedBytes int64 `json:"compressedBytes"`
+}
+
+// Ratio 计算压缩率，即压缩后与压缩前字节数的比值，没有压缩过任何数据时返回0
+func (s CompressionStats) Ratio() float64 {
+	if s.OriginalBytes == 0 {
+		return 0
+	}
+	return float64(s.CompressedBytes) / float64(s.OriginalBytes)
+}
+
+// 缓存表内部维护的压缩计数器
+type compressionStats struct {
+	values          atomic.Int64
+	originalBytes   atomic.Int64
+	compressedBytes atomic.Int64
+}
+
+// CompressionStats 获取缓存表的压缩统计信息
+func (ct *CacheTable) CompressionStats() CompressionStats {
+	return CompressionStats{
+		Values:          ct.compression.values.Load(),
+		OriginalBytes:   ct.compression.originalBytes.Load(),
+		CompressedBytes: ct.compression.compressedBytes.Load(),
+	}
+}
+
+// 压缩或加密后保存在缓存项中的数据，读取时先解密再解压
+type encodedValue struct {
+	data []byte
+	// 原始数据是否为string
+	str bool
+	// 压缩和加密使用的算法，未使用时为nil
+	compress Codec
+	encrypt  Codec
+}
+
+// 根据配置压缩和加密数据，只处理[]byte和string，不需要处理时原样返回，
+// 加密失败时交给错误处理函数并返回错误，调用者不能保存该数据
+func (ct *CacheTable) encode(key, data interface{}) (interface{}, error) {
+	if ct.codec == nil && ct.cipher == nil {
+		return data, nil
+	}
+	var raw []byte
+	str := false
+	switch d := data.(type) {
+	case []byte:
+		raw = d
+	case string:
+		raw, str = []byte(d), true
+	default:
+		return data, nil
+	}
+	v := &encodedValue{data: raw, str: str}
+	if ct.codec != nil && len(raw) >= ct.compressThreshold {
+		if packed, err := ct.codec.Encode(raw); err == nil && len(packed) < len(raw) {
+			ct.compression.values.Add(1)
+			ct.compression.originalBytes.Add(int64(len(raw)))
+			ct.compression.compressedBytes.Add(int64(len(packed)))
+			v.data, v.compress = packed, ct.codec
+		}
+	}
+	if ct.cipher != nil {
+		sealed, err := ct.cipher.Encode(v.data)
+		if err != nil {
+			// 加密失败时不能保存明文
+			ct.reportError(err, key)
+			return nil, err
+		}
+		v.data, v.encrypt = sealed, ct.cipher
+	}
+	if v.compress == nil && v.encrypt == nil {
+		return data, nil
+	}
+	return v, nil
+}
+
+// 获取缓存项解密和解压之后的数据，调用者需要持有缓存项的锁
+func (ci *CacheItem) dataLocked() interface{} {
+	v, ok := ci.data.(*encodedValue)
+	if !ok {
+		return ci.data
+	}
+	raw, err := v.decode()
+	if err != nil {
+		if ci.table != nil {
+			ci.table.log(LevelWarn, "解码缓存项失败", "event", "decode", "key", ci.key, "error", err)
+		}
+		return nil
+	}
+	if v.str {
+		return string(raw)
+	}
+	return raw
+}
+
+func (v *encodedValue) decode() ([]byte, error) {
+	raw := v.data
+	var err error
+	if v.encrypt != nil {
+		if raw, err = v.encrypt.Decode(raw); err != nil {
+			return nil, err
+		}
+	}
+	if v.compress != nil {
+		if raw, err = v.compress.Decode(raw); err != nil {
+			return nil, err
+		}
+	}
+	return raw, nil
+}
@@ -0,0 +1,28 @@
+package cache2go
+
+// Cloner 由缓存的数据实现，开启WithCopyOnRead后Data返回Clone的结果
+type Cloner interface {
+	Clone() interface{}
+}
+
+// WithCopyOnRead 开启读取时复制，CacheItem.Data返回数据的副本，避免调用者修改共享的缓存数据。
+// 实现了Cloner的数据使用Clone复制，[]byte复制底层数组，其余类型原样返回
+func WithCopyOnRead() Option {
+	return func(ct *CacheTable) {
+		ct.copyOnRead = true
+	}
+}
+
+// 复制数据，无法复制的类型原样返回
+func cloneValue(data interface{}) interface{} {
+	switch d := data.(type) {
+	case Cloner:
+		return d.Clone()
+	case []byte:
+		if d == nil {
+			return d
+		}
+		return append([]byte(nil), d...)
+	}
+	return data
+}
@@ -0,0 +1,38 @@
+package cache2go
+
+import "time"
+
+// WithAccessCountDecay 开启访问次数的衰减，每经过halfLife时间访问次数减半，
+// 使MostAccessed、LeastAccessed等按访问次数排序的方法反映最近的热度，而不是缓存项存在以来的累计访问次数。
+// 衰减在访问和读取访问次数时按经过的周期数计算，不需要额外的协程
+func WithAccessCountDecay(halfLife time.Duration) Option {
+	return func(ct *CacheTable) {
+		ct.accessDecay = halfLife
+	}
+}
+
+// 计算衰减之后的访问次数以及当前所在的衰减周期，调用者需要持有缓存项的锁
+func (ci *CacheItem) decayedCountLocked(now time.Time) (int64, int64) {
+	if ci.table == nil || ci.table.accessDecay <= 0 {
+		return ci.accessCount, 0
+	}
+	// 周期从1开始计数，0表示从未被访问过，还没有记录衰减周期
+	epoch := now.UnixNano()/int64(ci.table.accessDecay) + 1
+	if ci.decayEpoch == 0 {
+		return ci.accessCount, epoch
+	}
+	n := epoch - ci.decayEpoch
+	if n <= 0 {
+		return ci.accessCount, ci.decayEpoch
+	}
+	if n >= 63 {
+		return 0, epoch
+	}
+	return ci.accessCount >> uint(n), epoch
+}
+
+// 获取衰减之后的访问次数，调用者需要持有缓存项的锁
+func (ci *CacheItem) accessCountLocked() int64 {
+	count, _ := ci.decayedCountLocked(ci.now())
+	return count
+}
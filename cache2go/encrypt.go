@@ -0,0 +1,114 @@
+package cache2go
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// AESGCMCodec 使用AES-GCM加密数据，密文的格式为4字节的密钥编号、随机nonce和密文，
+// 支持密钥轮换：新写入的数据使用当前密钥加密，使用旧密钥加密的数据只要旧密钥没有被移除就仍然可以解密
+type AESGCMCodec struct {
+	sync.RWMutex
+	keys    map[uint32]cipher.AEAD
+	current uint32
+}
+
+// NewAESGCMCodec 使用编号为id的密钥创建加密算法，key的长度必须为16、24或32字节
+func NewAESGCMCodec(id uint32, key []byte) (*AESGCMCodec, error) {
+	c := &AESGCMCodec{keys: make(map[uint32]cipher.AEAD)}
+	if err := c.Rotate(id, key); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// WithEncryption 开启数据加密，类型为[]byte或string的数据在缓存表内部以密文保存，读取时自动解密，
+// 同时开启压缩时先压缩再加密；设置了加密的缓存表通过Save保存的这类数据同样是密文，Load时需要使用相同的密钥
+func WithEncryption(codec Codec) Option {
+	return func(ct *CacheTable) {
+		ct.cipher = codec
+	}
+}
+
+// AddKey 增加一个只用于解密的密钥，用于读取使用旧密钥加密的数据
+func (c *AESGCMCodec) AddKey(id uint32, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.keys[id] = aead
+	return nil
+}
+
+// Rotate 增加密钥并将其作为当前密钥，之后写入的数据都会使用该密钥加密
+func (c *AESGCMCodec) Rotate(id uint32, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.keys[id] = aead
+	c.current = id
+	return nil
+}
+
+// RemoveKey 移除不再使用的密钥，不能移除当前密钥，使用该密钥加密的数据将无法读取
+func (c *AESGCMCodec) RemoveKey(id uint32) error {
+	c.Lock()
+	defer c.Unlock()
+	if id == c.current {
+		return ErrCurrentKey
+	}
+	delete(c.keys, id)
+	return nil
+}
+
+// Encode 使用当前密钥加密数据
+func (c *AESGCMCodec) Encode(src []byte) ([]byte, error) {
+	c.RLock()
+	id := c.current
+	aead := c.keys[id]
+	c.RUnlock()
+
+	out := make([]byte, 4+aead.NonceSize(), 4+aead.NonceSize()+len(src)+aead.Overhead())
+	binary.BigEndian.PutUint32(out, id)
+	if _, err := rand.Read(out[4:]); err != nil {
+		return nil, err
+	}
+	// 密钥编号作为附加数据，防止被篡改为其他密钥
+	return aead.Seal(out, out[4:], src, out[:4]), nil
+}
+
+// Decode 根据密文中的密钥编号选择密钥解密数据
+func (c *AESGCMCodec) Decode(src []byte) ([]byte, error) {
+	if len(src) < 4 {
+		return nil, ErrInvalidCiphertext
+	}
+	id := binary.BigEndian.Uint32(src)
+	c.RLock()
+	aead, ok := c.keys[id]
+	c.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownKey, id)
+	}
+	if len(src) < 4+aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce, sealed := src[4:4+aead.NonceSize()], src[4+aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, src[:4])
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
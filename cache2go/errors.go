@@ -1,8 +1,112 @@
 package cache2go
 
-import "errors"
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Language 错误信息使用的语言
+type Language int32
+
+const (
+	// Chinese 中文，默认语言
+	Chinese Language = iota
+	// English 英文
+	English
+)
+
+var language atomic.Int32
+
+// SetLanguage 设置本包返回的错误信息使用的语言，对所有缓存表生效
+func SetLanguage(l Language) {
+	language.Store(int32(l))
+}
+
+// 根据当前语言选择信息
+func localize(zh, en string) string {
+	if Language(language.Load()) == English {
+		return en
+	}
+	return zh
+}
+
+// 本包定义的错误，同时保存中文和英文信息
+type cacheError struct {
+	zh, en string
+}
+
+func newError(zh, en string) error {
+	return &cacheError{zh: zh, en: en}
+}
+
+func (e *cacheError) Error() string {
+	return localize(e.zh, e.en)
+}
 
 var (
-	ErrCacheNotFound           = errors.New("缓存项不存在")
-	ErrCacheNotFoundOrLoadable = errors.New("缓存项不存在并且未能加入缓存表中")
+	ErrCacheNotFound           = newError("缓存项不存在", "cache item not found")
+	ErrCacheNotFoundOrLoadable = newError("缓存项不存在并且未能加入缓存表中", "cache item not found and could not be loaded")
+	ErrCacheExists             = newError("缓存项已存在", "cache item already exists")
+	ErrTableClosed             = newError("缓存表已关闭", "cache table is closed")
+	ErrTableNotFound           = newError("缓存表不存在", "cache table not found")
+	ErrTableExists             = newError("缓存表已存在", "cache table already exists")
+	ErrLoaderTimeout           = newError("加载数据超时", "loading data timed out")
+	ErrLoaderBusy              = newError("加载数据的并发数已达上限", "too many concurrent loads")
+	ErrLoaderFailed            = newError("加载数据失败", "loading data failed")
+	ErrVersionMismatch         = newError("缓存项的版本号不一致", "cache item version mismatch")
+	ErrRateLimited             = newError("访问频率超过限制", "rate limit exceeded")
+	ErrTooManyTables           = newError("缓存表个数超出配额", "too many cache tables")
+	ErrMemoryQuota             = newError("缓存表占用的内存超出配额", "cache memory quota exceeded")
+	ErrExpvarExists            = newError("expvar变量已存在", "expvar variable already exists")
+	ErrUnknownKey              = newError("找不到解密使用的密钥", "unknown encryption key")
+	ErrCurrentKey              = newError("不能移除当前使用的密钥", "cannot remove the current encryption key")
+	ErrInvalidCiphertext       = newError("密文长度不正确", "invalid ciphertext length")
+	ErrNoSerializer            = newError("缓存表未设置Serializer，无法读取序列化保存的数据", "table has no serializer configured, cannot read serialized data")
+	ErrNotEncrypted            = newError("缓存表未开启加密，无法读取加密保存的数据", "table has no encryption configured, cannot read encrypted data")
 )
+
+// KeyError 与某个键相关的错误，记录缓存表的名字和键，可以通过errors.Is与ErrCacheNotFound等错误比较，
+// 通过errors.As获取键
+type KeyError struct {
+	Table string
+	Key   interface{}
+	Err   error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf(localize("%v（缓存表%s，键%v）", "%v (table %s, key %v)"), e.Err, e.Table, e.Key)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// LoaderError loadData或二级存储执行失败，用于与数据不存在区分，errors.Is(err, ErrLoaderFailed)总是成立，
+// Err为具体的原因，例如ErrLoaderTimeout、ErrLoaderBusy、ctx的错误以及panic
+type LoaderError struct {
+	Table string
+	Key   interface{}
+	Err   error
+}
+
+func (e *LoaderError) Error() string {
+	return fmt.Sprintf(localize("%v：%v（缓存表%s，键%v）", "%v: %v (table %s, key %v)"), ErrLoaderFailed, e.Err, e.Table, e.Key)
+}
+
+func (e *LoaderError) Unwrap() error {
+	return e.Err
+}
+
+func (e *LoaderError) Is(target error) bool {
+	return target == ErrLoaderFailed
+}
+
+// 构造与键相关的错误
+func (ct *CacheTable) keyError(key interface{}, err error) error {
+	return &KeyError{Table: ct.Name(), Key: key, Err: err}
+}
+
+// 构造加载失败的错误
+func (ct *CacheTable) loaderError(key interface{}, err error) error {
+	return &LoaderError{Table: ct.Name(), Key: key, Err: err}
+}
@@ -0,0 +1,183 @@
+package cache2go
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// 按照到期时间排列的缓存项最小堆，超时检查只需要处理堆顶已经到期的缓存项，
+// 访问缓存项只会推迟到期时间，不会更新堆，所以堆中记录的到期时间可能早于实际的到期时间，
+// 弹出时会重新计算，未到期的缓存项重新放回堆中
+type expiryQueue struct {
+	sync.Mutex
+	heap expiryHeap
+}
+
+// 缓存项在过期堆中的状态，由expiryQueue的锁保护
+type expiryState struct {
+	// 在堆中的位置加一，0表示不在堆中
+	pos      int
+	deadline time.Time
+	key      interface{}
+}
+
+type expiryHeap []*CacheItem
+
+func (h expiryHeap) Len() int { return len(h) }
+func (h expiryHeap) Less(i, j int) bool {
+	return h[i].expiry.deadline.Before(h[j].expiry.deadline)
+}
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].expiry.pos = i + 1
+	h[j].expiry.pos = j + 1
+}
+func (h *expiryHeap) Push(x interface{}) {
+	item := x.(*CacheItem)
+	item.expiry.pos = len(*h) + 1
+	*h = append(*h, item)
+}
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	item.expiry.pos = 0
+	return item
+}
+
+// 将缓存项按照deadline加入过期堆，已经在堆中时只会提前到期时间
+func (ct *CacheTable) pushExpiry(key interface{}, item *CacheItem, deadline time.Time) {
+	q := &ct.expiry
+	q.Lock()
+	defer q.Unlock()
+	st := &item.expiry
+	if st.pos == 0 {
+		st.deadline, st.key = deadline, key
+		heap.Push(&q.heap, item)
+		return
+	}
+	st.key = key
+	if deadline.Before(st.deadline) {
+		st.deadline = deadline
+		heap.Fix(&q.heap, st.pos-1)
+	}
+}
+
+// 根据缓存项当前的存活时间将其加入过期堆，永不过期或被固定的缓存项不会加入，调用者不能持有缓存项的写锁
+func (ct *CacheTable) track(key interface{}, item *CacheItem) {
+	item.RLock()
+	lifeSpan, base, pinned := item.lifeSpan, item.expireBaseLocked(), item.pinned
+	item.RUnlock()
+	if lifeSpan <= 0 || pinned {
+		return
+	}
+	ct.pushExpiry(key, item, base.Add(lifeSpan))
+}
+
+// 将缓存项从过期堆中移除
+func (ct *CacheTable) untrack(item *CacheItem) {
+	q := &ct.expiry
+	q.Lock()
+	defer q.Unlock()
+	if item.expiry.pos != 0 {
+		heap.Remove(&q.heap, item.expiry.pos-1)
+	}
+}
+
+// 清空过期堆，调用者需要持有缓存表的写锁
+func (ct *CacheTable) resetExpiry() {
+	q := &ct.expiry
+	q.Lock()
+	defer q.Unlock()
+	for _, item := range q.heap {
+		item.expiry.pos = 0
+	}
+	q.heap = nil
+}
+
+// 每批从过期堆中取出的缓存项个数上限
+const expireBatchSize = 1024
+
+// 从过期堆中取出的到期缓存项
+type dueItem struct {
+	key  interface{}
+	item *CacheItem
+}
+
+// 从过期堆中弹出最多limit个已经到期的缓存项，没有到期的缓存项时同时返回距离下一个缓存项到期的时间，
+// 堆为空时返回0
+func (ct *CacheTable) popDue(now time.Time, limit int) ([]dueItem, time.Duration) {
+	q := &ct.expiry
+	q.Lock()
+	defer q.Unlock()
+	var due []dueItem
+	for len(q.heap) > 0 && len(due) < limit {
+		item := q.heap[0]
+		if deadline := item.expiry.deadline; deadline.After(now) {
+			return due, deadline.Sub(now)
+		}
+		due = append(due, dueItem{item.expiry.key, item})
+		heap.Pop(&q.heap)
+	}
+	return due, 0
+}
+
+// 删除所有已经到期的缓存项，返回删除的个数、距离下一个缓存项到期的时间以及被删除的缓存项，
+// 没有需要管理的缓存项时返回0。到期的缓存项按批取出并按分片分组，每个分片每批只加锁一次，
+// 删除回调函数不在这里执行，由调用者在释放缓存表的锁之后通过notifyDeleted执行，调用者需要持有缓存表的写锁
+func (ct *CacheTable) expireDue(now time.Time) (int, time.Duration, []deletion) {
+	stale := ct.staleGrace()
+	var expired []deletion
+	groups := make([][]dueItem, len(ct.shards))
+	for {
+		due, next := ct.popDue(now, expireBatchSize)
+		if len(due) == 0 {
+			return len(expired), next, expired
+		}
+		for _, d := range due {
+			i := ct.shardIndex(d.key)
+			groups[i] = append(groups[i], d)
+		}
+		for i, group := range groups {
+			if len(group) == 0 {
+				continue
+			}
+			sh := ct.shards[i]
+			sh.Lock()
+			for _, d := range group {
+				// 缓存项可能已经被删除或替换
+				if sh.items[d.key] == d.item && ct.expireItem(sh, d.key, d.item, now, stale) {
+					expired = append(expired, deletion{d.key, d.item, ReasonExpired})
+				}
+			}
+			sh.Unlock()
+			groups[i] = group[:0]
+		}
+	}
+}
+
+// 处理从过期堆中弹出的缓存项，返回是否被删除，被删除时不执行删除回调函数，调用者需要持有缓存表的锁以及分片的写锁
+func (ct *CacheTable) expireItem(sh *shard, key interface{}, item *CacheItem, now time.Time, stale time.Duration) bool {
+	// 通过局部变量保存，减少持有锁的时间
+	item.RLock()
+	lifeSpan, base, pinned := item.lifeSpan, item.expireBaseLocked(), item.pinned
+	item.RUnlock()
+
+	// 对于存活时间为0或被固定的缓存项不去管理，修改存活时间或取消固定时会重新加入过期堆
+	if lifeSpan == 0 || pinned {
+		return false
+	}
+	if deadline := base.Add(lifeSpan + stale); deadline.After(now) {
+		ct.pushExpiry(key, item, deadline)
+		return false
+	}
+	// 续期回调可以延长缓存项的存活时间，否则对超时的缓存项进行删除操作
+	if renewed, ok := item.renewExpired(now); ok {
+		ct.pushExpiry(key, item, now.Add(renewed))
+		return false
+	}
+	ct.removeLocked(sh, deletion{key, item, ReasonExpired})
+	return true
+}
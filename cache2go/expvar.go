@@ -0,0 +1,35 @@
+package cache2go
+
+import (
+	"expvar"
+	"sync"
+)
+
+// 保证检查和注册expvar变量的原子性，expvar.Publish在名字重复时会panic
+var expvarMu sync.Mutex
+
+// PublishExpvar 将缓存表的统计信息和缓存项个数以prefix+表名为名字注册到expvar中，
+// 可以通过/debug/vars获取，名字已被注册时返回ErrExpvarExists
+func (ct *CacheTable) PublishExpvar(prefix string) error {
+	name := prefix + ct.Name()
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	if expvar.Get(name) != nil {
+		return ErrExpvarExists
+	}
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		s := ct.Stats()
+		return map[string]interface{}{
+			"items":        ct.Count(),
+			"hits":         s.Hits,
+			"misses":       s.Misses,
+			"loads":        s.Loads,
+			"loadFailures": s.LoadFailures,
+			"adds":         s.Adds,
+			"deletes":      s.Deletes,
+			"expirations":  s.Expirations,
+			"hitRatio":     s.HitRatio(),
+		}
+	}))
+	return nil
+}
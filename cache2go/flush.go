@@ -0,0 +1,78 @@
+package cache2go
+
+import "context"
+
+// FlushOptions FlushWithOptions的选项
+type FlushOptions struct {
+	// 执行缓存表的删除回调函数以及缓存项的aboutToExpire回调函数，删除原因为ReasonFlushed
+	Callbacks bool
+	// 同时从二级存储中删除，需要WithStorePolicy开启PropagateDeletes
+	Store bool
+	// 清空之后保存到WithPersistFile设置的文件，避免重启时恢复已经清空的数据
+	Persist bool
+}
+
+// FlushWithCallbacks 清空缓存表并对每个缓存项执行删除回调函数，删除原因为ReasonFlushed
+func (ct *CacheTable) FlushWithCallbacks() {
+	ct.FlushWithOptions(context.Background(), FlushOptions{Callbacks: true})
+}
+
+// FlushWithOptions 清空缓存表，opts控制是否执行删除回调函数以及是否同步到二级存储和持久化文件，
+// 订阅者总会收到原因为ReasonFlushed的WatchDelete事件，回调函数在释放缓存表的锁之后执行。ctx结束时不再继续从二级存储中删除并返回ctx的错误
+func (ct *CacheTable) FlushWithOptions(ctx context.Context, opts FlushOptions) error {
+	if !opts.Callbacks && !opts.Store {
+		ct.Flush()
+	} else {
+		ct.Lock()
+		ct.log(LevelInfo, "清空缓存表", "event", "flush", "callbacks", opts.Callbacks, "store", opts.Store)
+		removed := ct.resetShards(true)
+		ct.scheduleCleanup(0)
+		cfg := ct.readConfig()
+		ct.Unlock()
+
+		ct.emitFlushed(removed)
+		if opts.Callbacks {
+			ct.notifyDeleted(cfg, removed)
+		}
+		if opts.Store {
+			for _, d := range removed {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				ct.storeDelete(d.key)
+			}
+		}
+	}
+	if opts.Persist && ct.persistPath != "" {
+		return ct.SaveFile(ct.persistPath)
+	}
+	return nil
+}
+
+// 清空所有分片、索引和过期堆，collect为true时返回被删除的缓存项，调用者需要持有缓存表的写锁
+func (ct *CacheTable) resetShards(collect bool) []deletion {
+	var removed []deletion
+	for _, sh := range ct.shards {
+		sh.Lock()
+		if collect {
+			for key, item := range sh.items {
+				removed = append(removed, deletion{key, item, ReasonFlushed})
+			}
+		}
+		sh.reset()
+		sh.Unlock()
+	}
+	ct.indexReset()
+	ct.resetExpiry()
+	return removed
+}
+
+// 对清空的缓存项发送原因为ReasonFlushed的删除事件
+func (ct *CacheTable) emitFlushed(removed []deletion) {
+	if len(removed) == 0 || !ct.watched() {
+		return
+	}
+	for _, d := range removed {
+		ct.emitDelete(d.key, d.item.Data(), ReasonFlushed)
+	}
+}
@@ -0,0 +1,114 @@
+package cache2go
+
+import "context"
+
+const (
+	// DefaultAsyncLoaders ValueAsync默认同时执行loadData的最大个数
+	DefaultAsyncLoaders = 8
+	// DefaultAsyncQueue ValueAsync默认排队等待执行loadData的最大个数
+	DefaultAsyncQueue = 1024
+)
+
+// Future ValueAsync返回的异步结果
+type Future struct {
+	done chan struct{}
+	item *CacheItem
+	err  error
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+// 设置结果并唤醒等待者，只能调用一次
+func (f *Future) resolve(item *CacheItem, err error) *Future {
+	f.item, f.err = item, err
+	close(f.done)
+	return f
+}
+
+// Done 返回在结果可用时关闭的channel
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait 等待加载完成并返回结果，ctx结束时返回ctx.Err()，但不会取消正在进行的加载
+func (f *Future) Wait(ctx context.Context) (*CacheItem, error) {
+	select {
+	case <-f.done:
+		return f.item, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// WithAsyncLoaders 设置ValueAsync同时执行loadData的最大个数n以及排队等待的最大个数queue，
+// 排队已满时Future返回ErrLoaderBusy，n小于1时按1处理，queue小于0时按0处理
+func WithAsyncLoaders(n, queue int) Option {
+	return func(ct *CacheTable) {
+		if n < 1 {
+			n = 1
+		}
+		if queue < 0 {
+			queue = 0
+		}
+		ct.asyncLoaders = make(chan struct{}, n)
+		ct.asyncQueue = make(chan struct{}, n+queue)
+	}
+}
+
+// ValueAsync 与Value相同，但不会阻塞调用者，命中时返回已经完成的Future，
+// 未命中时在后台执行loadData，同时执行和排队的个数受WithAsyncLoaders限制，默认为DefaultAsyncLoaders和DefaultAsyncQueue，
+// 排队已满时返回的Future立即以ErrLoaderBusy完成
+func (ct *CacheTable) ValueAsync(key interface{}, args ...interface{}) *Future {
+	f := newFuture()
+	cfg := ct.readConfig()
+	r, ok := ct.lookup(key)
+	loadData := cfg.loadData
+	if cfg.closed {
+		return f.resolve(nil, ErrTableClosed)
+	}
+	if ok {
+		ct.hit(r)
+		ct.recordHit(key)
+		return f.resolve(r, nil)
+	}
+	ct.recordMiss(key)
+	if loadData == nil {
+		return f.resolve(nil, ct.keyError(key, ErrCacheNotFound))
+	}
+
+	sem, queue := ct.asyncLoaderSlots()
+	select {
+	case queue <- struct{}{}:
+	default:
+		return f.resolve(nil, ct.keyError(key, ErrLoaderBusy))
+	}
+	// 排队等待的异步加载同样计入正在进行的加载
+	ct.loading.add()
+	go func() {
+		defer ct.loading.done()
+		defer func() { <-queue }()
+		sem <- struct{}{}
+		defer func() { <-sem }()
+		f.resolve(ct.load(context.Background(), key, loadData, args...))
+	}()
+	return f
+}
+
+// 获取限制异步加载并发数和排队个数的信号量，未通过WithAsyncLoaders设置时使用默认值
+func (ct *CacheTable) asyncLoaderSlots() (chan struct{}, chan struct{}) {
+	ct.RLock()
+	sem, queue := ct.asyncLoaders, ct.asyncQueue
+	ct.RUnlock()
+	if sem != nil {
+		return sem, queue
+	}
+	ct.Lock()
+	defer ct.Unlock()
+	if ct.asyncLoaders == nil {
+		ct.asyncLoaders = make(chan struct{}, DefaultAsyncLoaders)
+		ct.asyncQueue = make(chan struct{}, DefaultAsyncLoaders+DefaultAsyncQueue)
+	}
+	return ct.asyncLoaders, ct.asyncQueue
+}
@@ -0,0 +1,80 @@
+package cache2go
+
+import (
+	"sort"
+	"time"
+)
+
+// 存在时长和剩余存活时间直方图默认的桶上界
+var defaultDurationBuckets = [...]time.Duration{
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+}
+
+// DurationHistogram 缓存项存在时长或剩余存活时间的分布
+type DurationHistogram struct {
+	// 每个桶的上界，从小到大排列
+	Bounds []time.Duration
+	// 每个桶中的缓存项个数，比Bounds多一个元素，最后一个表示超过所有上界的个数
+	Counts []int64
+	// 所有计入桶中的时长之和
+	Sum time.Duration
+	// 计入桶中的缓存项个数
+	Count int64
+	// 永不过期的缓存项个数，只在TTLHistogram中使用，这些缓存项不计入桶中
+	Unbounded int64
+}
+
+// AgeHistogram 统计所有缓存项自创建以来经过的时间的分布，不传入bounds时使用默认的桶上界
+func (ct *CacheTable) AgeHistogram(bounds ...time.Duration) DurationHistogram {
+	h := newDurationHistogram(bounds)
+	now := ct.now()
+	ct.rangeItems(func(_ interface{}, item *CacheItem) {
+		h.observe(now.Sub(item.CreateTime()))
+	})
+	return h
+}
+
+// TTLHistogram 统计所有缓存项剩余存活时间的分布，已经过期但尚未被清理的缓存项计为0，
+// 永不过期的缓存项只计入Unbounded，不传入bounds时使用默认的桶上界
+func (ct *CacheTable) TTLHistogram(bounds ...time.Duration) DurationHistogram {
+	h := newDurationHistogram(bounds)
+	now := ct.now()
+	ct.rangeItems(func(_ interface{}, item *CacheItem) {
+		item.RLock()
+		lifeSpan, base := item.lifeSpan, item.expireBaseLocked()
+		item.RUnlock()
+		if lifeSpan == 0 {
+			h.Unbounded++
+			return
+		}
+		ttl := lifeSpan - now.Sub(base)
+		if ttl < 0 {
+			ttl = 0
+		}
+		h.observe(ttl)
+	})
+	return h
+}
+
+func newDurationHistogram(bounds []time.Duration) DurationHistogram {
+	if len(bounds) == 0 {
+		bounds = defaultDurationBuckets[:]
+	}
+	b := append([]time.Duration(nil), bounds...)
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	return DurationHistogram{Bounds: b, Counts: make([]int64, len(b)+1)}
+}
+
+func (h *DurationHistogram) observe(d time.Duration) {
+	i := sort.Search(len(h.Bounds), func(i int) bool { return d <= h.Bounds[i] })
+	h.Counts[i]++
+	h.Sum += d
+	h.Count++
+}
@@ -0,0 +1,51 @@
+package cache2go
+
+import "time"
+
+// ImportEntry Import导入的一个缓存项
+type ImportEntry struct {
+	Key  interface{}
+	Data interface{}
+	// 创建时间，为零值时使用当前时间
+	CreateTime time.Time
+	// 剩余存活时间，小于0表示永不过期，等于0表示已经过期，与CacheItem.TTL的返回值含义相同
+	TTL time.Duration
+	// 完整的存活时间，大于0时访问之后按该存活时间续期，否则使用TTL作为存活时间
+	LifeSpan time.Duration
+	// 访问次数
+	AccessCount int64
+}
+
+// Import 批量导入缓存项并保留创建时间和剩余存活时间，适用于从快照预热或从其他缓存实例迁移，
+// 已经过期的缓存项会被跳过，返回导入的个数。导入的缓存项不会写入二级存储，只进行一次超时检查
+func (ct *CacheTable) Import(entries []ImportEntry) int {
+	now := ct.now()
+	items := make([]*CacheItem, 0, len(entries))
+	for _, e := range entries {
+		if e.TTL == 0 {
+			continue
+		}
+		lifeSpan, ttl := e.LifeSpan, e.TTL
+		if ttl < 0 {
+			lifeSpan = 0
+		} else if lifeSpan < ttl {
+			lifeSpan = ttl
+		}
+		lifeSpan, ttl = ct.clampRemaining(lifeSpan, ttl)
+		item := NewCacheItem(e.Key, e.Data, lifeSpan)
+		item.createTime = e.CreateTime
+		if item.createTime.IsZero() {
+			item.createTime = now
+		}
+		item.accessCount = e.AccessCount
+		// 通过调整最后访问时间还原剩余存活时间
+		item.accessedTime = now
+		if lifeSpan > 0 {
+			item.accessedTime = now.Add(ttl - lifeSpan)
+		}
+		item.expireBase = item.accessedTime
+		items = append(items, item)
+	}
+	ct.addItems(items)
+	return len(items)
+}
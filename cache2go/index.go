@@ -0,0 +1,146 @@
+package cache2go
+
+import "sync"
+
+// 缓存表上注册的二级索引
+type indexes struct {
+	sync.RWMutex
+	byName map[string]*index
+}
+
+// 一个二级索引，fn根据缓存项计算索引值
+type index struct {
+	fn func(*CacheItem) []string
+	// 索引值到缓存项的映射
+	entries map[string]map[interface{}]*CacheItem
+	// 每个键加入索引时计算出的索引值，删除时使用
+	values map[interface{}][]string
+}
+
+func (idx *index) put(key interface{}, item *CacheItem, values []string) {
+	idx.remove(key)
+	for _, v := range values {
+		m, ok := idx.entries[v]
+		if !ok {
+			m = make(map[interface{}]*CacheItem)
+			idx.entries[v] = m
+		}
+		m[key] = item
+	}
+	idx.values[key] = values
+}
+
+func (idx *index) remove(key interface{}) {
+	for _, v := range idx.values[key] {
+		if m := idx.entries[v]; m != nil {
+			delete(m, key)
+			if len(m) == 0 {
+				delete(idx.entries, v)
+			}
+		}
+	}
+	delete(idx.values, key)
+}
+
+// AddIndex 注册名为name的二级索引，fn返回缓存项的索引值，会对已存在的缓存项建立索引，
+// 之后在新增、删除以及修改数据时自动维护，同名的索引会被替换。
+// fn在分片的锁内执行，不能调用同一个缓存表的方法
+func (ct *CacheTable) AddIndex(name string, fn func(item *CacheItem) []string) {
+	ct.Lock()
+	defer ct.Unlock()
+	idx := &index{
+		fn:      fn,
+		entries: make(map[string]map[interface{}]*CacheItem),
+		values:  make(map[interface{}][]string),
+	}
+	ct.rangeItems(func(key interface{}, item *CacheItem) {
+		idx.put(key, item, fn(item))
+	})
+	ct.indexes.Lock()
+	if ct.indexes.byName == nil {
+		ct.indexes.byName = make(map[string]*index)
+	}
+	ct.indexes.byName[name] = idx
+	ct.indexes.Unlock()
+}
+
+// RemoveIndex 删除名为name的二级索引
+func (ct *CacheTable) RemoveIndex(name string) {
+	ct.indexes.Lock()
+	defer ct.indexes.Unlock()
+	delete(ct.indexes.byName, name)
+}
+
+// ByIndex 获取名为name的索引中索引值为value的所有缓存项，不保证顺序，索引不存在时返回nil
+func (ct *CacheTable) ByIndex(name, value string) []*CacheItem {
+	ct.indexes.RLock()
+	defer ct.indexes.RUnlock()
+	idx, ok := ct.indexes.byName[name]
+	if !ok {
+		return nil
+	}
+	m := idx.entries[value]
+	items := make([]*CacheItem, 0, len(m))
+	for _, item := range m {
+		items = append(items, item)
+	}
+	return items
+}
+
+// 更新键在所有索引中的索引值，调用者需要持有分片的写锁，不能持有缓存项的锁
+func (ct *CacheTable) indexPut(key interface{}, item *CacheItem) {
+	ct.indexes.RLock()
+	if len(ct.indexes.byName) == 0 {
+		ct.indexes.RUnlock()
+		return
+	}
+	// 在获取写锁之前计算索引值，避免持有索引的锁时获取缓存项的锁
+	all := make(map[*index][]string, len(ct.indexes.byName))
+	for _, idx := range ct.indexes.byName {
+		all[idx] = idx.fn(item)
+	}
+	ct.indexes.RUnlock()
+
+	ct.indexes.Lock()
+	for idx, values := range all {
+		idx.put(key, item, values)
+	}
+	ct.indexes.Unlock()
+}
+
+// 从所有索引中删除键，调用者需要持有分片的写锁
+func (ct *CacheTable) indexDelete(key interface{}) {
+	ct.indexes.Lock()
+	defer ct.indexes.Unlock()
+	for _, idx := range ct.indexes.byName {
+		idx.remove(key)
+	}
+}
+
+// 清空所有索引中的数据，调用者需要持有缓存表的写锁
+func (ct *CacheTable) indexReset() {
+	ct.indexes.Lock()
+	defer ct.indexes.Unlock()
+	for _, idx := range ct.indexes.byName {
+		idx.entries = make(map[string]map[interface{}]*CacheItem)
+		idx.values = make(map[interface{}][]string)
+	}
+}
+
+// 缓存项的数据被修改后重新计算索引值，缓存项已经被删除或替换时不做任何操作
+func (ct *CacheTable) reindex(key interface{}, item *CacheItem) {
+	ct.indexes.RLock()
+	empty := len(ct.indexes.byName) == 0
+	ct.indexes.RUnlock()
+	if empty {
+		return
+	}
+	ct.RLock()
+	defer ct.RUnlock()
+	sh := ct.shardFor(key)
+	sh.Lock()
+	defer sh.Unlock()
+	if sh.items[key] == item {
+		ct.indexPut(key, item)
+	}
+}
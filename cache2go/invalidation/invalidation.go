@@ -0,0 +1,219 @@
+// Package invalidation 实现跨进程缓存失效同步中与传输无关的部分：消息格式、
+// 应用远程消息、把本地删除转换为消息以及基于来源标识的防回环，
+// 具体的消息中间件见redisbridge和natsbridge
+package invalidation
+
+import (
+	"cache2go"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	// OpDelete 删除缓存表中的一个键
+	OpDelete = "delete"
+	// OpFlush 清空缓存表
+	OpFlush = "flush"
+)
+
+// 远程删除标记的有效期，监听事件因缓冲区已满被丢弃时标记不会被消费，超时后清理，
+// 避免一直屏蔽之后本地对该键的删除
+const pendingTimeout = 5 * time.Second
+
+// Message 在实例之间传递的失效消息，使用JSON编码
+type Message struct {
+	// 发布者的标识，用于忽略自己发布的消息
+	Origin string `json:"origin"`
+	Table  string `json:"table"`
+	Op     string `json:"op"`
+	Key    string `json:"key,omitempty"`
+}
+
+// Relay 在失效消息与本地缓存表之间转换
+type Relay struct {
+	origin string
+	tables map[string]bool
+
+	// 正在应用远程删除的键，本地监听到这些键的删除时不再发布，只记录正在被Watch监听的缓存表
+	mu        sync.Mutex
+	pending   map[pendingKey]*pendingEntry
+	watched   map[*cache2go.CacheTable]int
+	lastSweep time.Time
+}
+
+type pendingKey struct {
+	table, key string
+}
+
+// 远程删除的次数以及最近一次记录的时间
+type pendingEntry struct {
+	n  int
+	at time.Time
+}
+
+// NewRelay 创建Relay，origin为空时随机生成，tables为空时处理所有已注册的缓存表
+func NewRelay(origin string, tables []string) *Relay {
+	if origin == "" {
+		var b [8]byte
+		rand.Read(b[:])
+		origin = hex.EncodeToString(b[:])
+	}
+	r := &Relay{
+		origin:  origin,
+		pending: make(map[pendingKey]*pendingEntry),
+		watched: make(map[*cache2go.CacheTable]int),
+	}
+	if len(tables) > 0 {
+		r.tables = make(map[string]bool, len(tables))
+		for _, name := range tables {
+			r.tables[name] = true
+		}
+	}
+	return r
+}
+
+// Origin 获取实例的标识
+func (r *Relay) Origin() string {
+	return r.origin
+}
+
+// Handles 判断是否需要同步该缓存表
+func (r *Relay) Handles(table string) bool {
+	return r.tables == nil || r.tables[table]
+}
+
+// Delete 构造删除键的消息
+func (r *Relay) Delete(table, key string) []byte {
+	return r.encode(Message{Origin: r.origin, Table: table, Op: OpDelete, Key: key})
+}
+
+// Flush 构造清空缓存表的消息
+func (r *Relay) Flush(table string) []byte {
+	return r.encode(Message{Origin: r.origin, Table: table, Op: OpFlush})
+}
+
+func (r *Relay) encode(m Message) []byte {
+	payload, _ := json.Marshal(m)
+	return payload
+}
+
+// Apply 应用一条失效消息，无法解析、来自自己或不需要同步的缓存表的消息会被忽略
+func (r *Relay) Apply(payload []byte) {
+	var m Message
+	if err := json.Unmarshal(payload, &m); err != nil {
+		return
+	}
+	if m.Origin == r.origin || !r.Handles(m.Table) {
+		return
+	}
+	t, ok := lookupTable(m.Table)
+	if !ok {
+		return
+	}
+	switch m.Op {
+	case OpDelete:
+		pk := pendingKey{m.Table, m.Key}
+		marked := r.markPending(t, pk)
+		if _, err := t.Delete(m.Key); err != nil && marked {
+			// 键不存在时不会产生删除事件
+			r.consumePending(pk)
+		}
+	case OpFlush:
+		t.Flush()
+	}
+}
+
+// Watch 监听当前已注册并且需要同步的缓存表，把通过Delete删除的键交给publish发布，
+// 过期和淘汰以及远程消息引起的删除不会发布，只发布字符串类型的键，ctx取消后停止
+func (r *Relay) Watch(ctx context.Context, publish func(payload []byte) error) {
+	for _, t := range cache2go.RegisteredTables() {
+		if r.Handles(t.Name()) {
+			// 在返回之前开始监听，之后应用的远程删除都能被监听到
+			events := t.WatchWithOptions(ctx, cache2go.WatchOptions{Buffer: 256})
+			r.mu.Lock()
+			r.watched[t]++
+			r.mu.Unlock()
+			go r.watch(t, events, publish)
+		}
+	}
+}
+
+func (r *Relay) watch(t *cache2go.CacheTable, events <-chan cache2go.Event, publish func([]byte) error) {
+	defer func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.watched[t]--; r.watched[t] <= 0 {
+			delete(r.watched, t)
+		}
+	}()
+	for e := range events {
+		if e.Type != cache2go.WatchDelete || e.Reason != cache2go.ReasonDeleted {
+			continue
+		}
+		key, ok := e.Key.(string)
+		if !ok || r.consumePending(pendingKey{t.Name(), key}) {
+			continue
+		}
+		publish(r.Delete(t.Name(), key))
+	}
+}
+
+// 记录一次远程删除，缓存表没有被监听时不记录并返回false，同时清理超时的标记
+func (r *Relay) markPending(t *cache2go.CacheTable, pk pendingKey) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if now.Sub(r.lastSweep) >= pendingTimeout {
+		r.lastSweep = now
+		for k, e := range r.pending {
+			if now.Sub(e.at) >= pendingTimeout {
+				delete(r.pending, k)
+			}
+		}
+	}
+	if r.watched[t] == 0 {
+		return false
+	}
+	e, ok := r.pending[pk]
+	if !ok {
+		e = &pendingEntry{}
+		r.pending[pk] = e
+	}
+	e.n++
+	e.at = now
+	return true
+}
+
+// 消费一次远程删除的标记，返回该键是否正在应用远程删除，超时的标记视为不存在
+func (r *Relay) consumePending(pk pendingKey) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.pending[pk]
+	if !ok {
+		return false
+	}
+	if time.Since(e.at) >= pendingTimeout {
+		delete(r.pending, pk)
+		return false
+	}
+	if e.n <= 1 {
+		delete(r.pending, pk)
+	} else {
+		e.n--
+	}
+	return true
+}
+
+// 查找已存在的缓存表，不存在时不会创建
+func lookupTable(name string) (*cache2go.CacheTable, bool) {
+	for _, t := range cache2go.RegisteredTables() {
+		if t.Name() == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
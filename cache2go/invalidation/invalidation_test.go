@@ -0,0 +1,106 @@
+package invalidation
+
+import (
+	"cache2go"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func pendingCount(r *Relay) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+func TestApplyWithoutWatch(t *testing.T) {
+	table := cache2go.Cache("testInvalidationNoWatch")
+	defer table.Close()
+	// Publish=false: remote deletes are applied but nothing watches the table
+	r := NewRelay("local", []string{"testInvalidationNoWatch"})
+	other := NewRelay("remote", nil)
+	for i := 0; i < 10; i++ {
+		key := string(rune('a' + i))
+		table.Add(key, i, 0)
+		r.Apply(other.Delete("testInvalidationNoWatch", key))
+		if table.Exists(key) {
+			t.Error("Expected remote delete to be applied", key)
+		}
+	}
+	if n := pendingCount(r); n != 0 {
+		t.Error("Expected no pending entries for unwatched tables", n)
+	}
+}
+
+func TestWatchSkipsRemoteDeletes(t *testing.T) {
+	table := cache2go.Cache("testInvalidationWatch")
+	defer table.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var published []string
+	r := NewRelay("local", []string{"testInvalidationWatch"})
+	r.Watch(ctx, func(payload []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		published = append(published, string(payload))
+		return nil
+	})
+	other := NewRelay("remote", nil)
+
+	table.Add("remote", v, 0)
+	r.Apply(other.Delete("testInvalidationWatch", "remote"))
+	// a remote delete of a missing key leaves nothing behind
+	r.Apply(other.Delete("testInvalidationWatch", "missing"))
+	table.Add("local", v, 0)
+	table.Delete("local")
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := len(published)
+		mu.Unlock()
+		if n > 0 && pendingCount(r) == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(published) != 1 || published[0] != string(r.Delete("testInvalidationWatch", "local")) {
+		t.Error("Expected only the local delete to be published", published)
+	}
+	if n := pendingCount(r); n != 0 {
+		t.Error("Expected pending entries to be consumed", n)
+	}
+}
+
+func TestStalePendingEntriesExpire(t *testing.T) {
+	table := cache2go.Cache("testInvalidationStale")
+	defer table.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewRelay("local", []string{"testInvalidationStale"})
+	r.Watch(ctx, func([]byte) error { return nil })
+
+	// simulate an entry whose watch event was dropped
+	pk := pendingKey{"testInvalidationStale", "dropped"}
+	r.mu.Lock()
+	r.pending[pk] = &pendingEntry{n: 1, at: time.Now().Add(-2 * pendingTimeout)}
+	r.mu.Unlock()
+	if r.consumePending(pk) {
+		t.Error("Expected stale entry not to suppress a local delete")
+	}
+
+	r.mu.Lock()
+	r.pending[pk] = &pendingEntry{n: 1, at: time.Now().Add(-2 * pendingTimeout)}
+	r.mu.Unlock()
+	r.Apply(NewRelay("remote", nil).Delete("testInvalidationStale", "missing"))
+	if n := pendingCount(r); n != 0 {
+		t.Error("Expected stale entries to be swept", n)
+	}
+}
+
+const v = "value"
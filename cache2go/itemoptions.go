@@ -0,0 +1,172 @@
+package cache2go
+
+import "time"
+
+// ItemOption 在AddWithOptions插入缓存项之前对缓存项进行设置
+type ItemOption func(*itemOptions)
+
+type itemOptions struct {
+	lifeSpan      time.Duration
+	tags          []string
+	pinned        bool
+	absolute      bool
+	aboutToExpire []func(key interface{})
+	withSnapshot  []func(item SnapshotItem)
+	accessed      []func(key interface{}, count int64)
+	renew         func(key interface{}) time.Duration
+	keepAliveMode KeepAliveMode
+	expireAt      time.Time
+	priority      int
+}
+
+// ItemLifeSpan 设置缓存项的存活时间，不设置时使用缓存表的默认存活时间
+func ItemLifeSpan(d time.Duration) ItemOption {
+	return func(o *itemOptions) {
+		o.lifeSpan = d
+	}
+}
+
+// ItemTags 设置缓存项的标签，与AddWithTags相同
+func ItemTags(tags ...string) ItemOption {
+	return func(o *itemOptions) {
+		o.tags = append(o.tags, tags...)
+	}
+}
+
+// ItemPinned 固定缓存项，与插入之后调用Pin相同
+func ItemPinned() ItemOption {
+	return func(o *itemOptions) {
+		o.pinned = true
+	}
+}
+
+// ItemPriority 设置淘汰优先级，与SetPriority相同
+func ItemPriority(priority int) ItemOption {
+	return func(o *itemOptions) {
+		o.priority = priority
+	}
+}
+
+// ItemAbsoluteExpiration 使用绝对过期时间，存活时间从创建时开始计算，访问缓存项不会推迟过期，
+// 调用Touch或续期回调续期时重新开始计算
+func ItemAbsoluteExpiration() ItemOption {
+	return func(o *itemOptions) {
+		o.absolute = true
+	}
+}
+
+// ItemExpireAt 设置缓存项在t时过期，使用绝对过期时间，忽略ItemLifeSpan和缓存表的存活时间抖动，
+// t早于当前时间时缓存项会在下一次超时检查中过期
+func ItemExpireAt(t time.Time) ItemOption {
+	return func(o *itemOptions) {
+		o.expireAt = t
+	}
+}
+
+// ItemAboutToExpire 增加删除时触发的回调函数
+func ItemAboutToExpire(f func(key interface{})) ItemOption {
+	return func(o *itemOptions) {
+		o.aboutToExpire = append(o.aboutToExpire, f)
+	}
+}
+
+// ItemAboutToExpireSnapshot 增加删除时触发的回调函数，与AddAboutToExpireSnapshotCallback相同
+func ItemAboutToExpireSnapshot(f func(item SnapshotItem)) ItemOption {
+	return func(o *itemOptions) {
+		o.withSnapshot = append(o.withSnapshot, f)
+	}
+}
+
+// ItemAccessed 增加访问时触发的回调函数
+func ItemAccessed(f func(key interface{}, count int64)) ItemOption {
+	return func(o *itemOptions) {
+		o.accessed = append(o.accessed, f)
+	}
+}
+
+// ItemRenew 设置过期时触发的续期回调函数，与SetRenewCallback相同
+func ItemRenew(f func(key interface{}) time.Duration) ItemOption {
+	return func(o *itemOptions) {
+		o.renew = f
+	}
+}
+
+// AddWithOptions 新增缓存项，存活时间、标签、固定状态和回调函数都在插入之前设置好，
+// 避免插入之后再设置回调函数时缓存项已经过期或被删除
+func (ct *CacheTable) AddWithOptions(key, data interface{}, opts ...ItemOption) *CacheItem {
+	o := itemOptions{lifeSpan: DefaultLifeSpan}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	item := ct.newItem(key, data, 0)
+	item.expireBase = item.createTime
+	var lifeSpan time.Duration
+	if o.expireAt.IsZero() {
+		lifeSpan = ct.effectiveLifeSpan(o.lifeSpan)
+	} else if lifeSpan = o.expireAt.Sub(item.createTime); lifeSpan <= 0 {
+		// 过期时间已经过去，使到期时间保持为t
+		lifeSpan = 1
+		item.expireBase = o.expireAt.Add(-lifeSpan)
+		o.absolute = true
+	} else {
+		lifeSpan = ct.clampLifeSpan(lifeSpan)
+		o.absolute = true
+	}
+	item.lifeSpan = lifeSpan
+	item.tags = o.tags
+	item.pinned = o.pinned
+	item.priority = o.priority
+	item.absolute = o.absolute
+	for _, f := range o.aboutToExpire {
+		item.aboutToExpire.add(f)
+	}
+	for _, f := range o.withSnapshot {
+		item.aboutToExpireSnapshot.add(f)
+	}
+	for _, f := range o.accessed {
+		item.accessed.add(f)
+	}
+	item.renew = o.renew
+	item.keepAliveMode = o.keepAliveMode
+
+	ct.addInternal(item)
+	ct.storeSet(key, data, lifeSpan)
+	return item
+}
+
+// AddWithExpireCallback 新增缓存项并在插入之前设置删除时触发的回调函数，存活时间很短的缓存项也不会丢失通知，
+// 与AddWithOptions(key, data, ItemLifeSpan(lifeSpan), ItemAboutToExpire(f))相同
+func (ct *CacheTable) AddWithExpireCallback(key, data interface{}, lifeSpan time.Duration, f func(key interface{})) *CacheItem {
+	return ct.AddWithOptions(key, data, ItemLifeSpan(lifeSpan), ItemAboutToExpire(f))
+}
+
+// AddWithExpireAt 新增在t时过期的缓存项，不需要调用者换算成相对于当前时间的存活时间，
+// 访问缓存项不会推迟过期时间，与AddWithOptions(key, data, ItemExpireAt(t))相同
+func (ct *CacheTable) AddWithExpireAt(key, data interface{}, t time.Time) *CacheItem {
+	return ct.AddWithOptions(key, data, ItemExpireAt(t))
+}
+
+// ExpireAt 获取缓存项当前的过期时间，未使用绝对过期时间时会随访问推迟，永不过期的缓存项返回零值
+func (ci *CacheItem) ExpireAt() time.Time {
+	ci.RLock()
+	defer ci.RUnlock()
+	if ci.lifeSpan == 0 {
+		return time.Time{}
+	}
+	return ci.expireBaseLocked().Add(ci.lifeSpan)
+}
+
+// Absolute 判断缓存项是否使用绝对过期时间
+func (ci *CacheItem) Absolute() bool {
+	ci.RLock()
+	defer ci.RUnlock()
+	return ci.absolute
+}
+
+// 获取存活时间开始计算的时间，默认为最后访问时间，使用绝对过期时间时不受访问影响，调用者需要持有缓存项的锁
+func (ci *CacheItem) expireBaseLocked() time.Time {
+	if ci.absolute {
+		return ci.expireBase
+	}
+	return ci.accessedTime
+}
@@ -0,0 +1,62 @@
+package cache2go
+
+// Iterator 缓存表的迭代器，在创建时持有锁复制所有缓存项的指针，之后的遍历过程不持有缓存表的锁，
+// 因此遍历时执行耗时操作不会阻塞其他协程的写入
+type Iterator struct {
+	table *CacheTable
+	keys  []interface{}
+	items []*CacheItem
+	// 当前位置，初始为-1
+	pos int
+	// 是否在遍历时校验缓存项仍然存在于缓存表中
+	live bool
+}
+
+// Iterator 创建缓存表的迭代器
+// live为false时遍历创建时的快照，遍历期间被删除或替换的缓存项仍会被返回；
+// live为true时每一步都会短暂获取读锁，跳过已经被删除或替换的缓存项，但不会返回创建之后新增的缓存项
+func (ct *CacheTable) Iterator(live bool) *Iterator {
+	n := ct.count()
+	it := &Iterator{
+		table: ct,
+		keys:  make([]interface{}, 0, n),
+		items: make([]*CacheItem, 0, n),
+		pos:   -1,
+		live:  live,
+	}
+	ct.rangeItems(func(k interface{}, v *CacheItem) {
+		it.keys = append(it.keys, k)
+		it.items = append(it.items, v)
+	})
+	return it
+}
+
+// Next 移动到下一个缓存项，没有更多缓存项时返回false
+func (it *Iterator) Next() bool {
+	for it.pos+1 < len(it.items) {
+		it.pos++
+		if !it.live {
+			return true
+		}
+		item, ok := it.table.lookup(it.keys[it.pos])
+		if ok && item == it.items[it.pos] {
+			return true
+		}
+	}
+	return false
+}
+
+// Key 获取当前缓存项的键
+func (it *Iterator) Key() interface{} {
+	return it.keys[it.pos]
+}
+
+// Item 获取当前缓存项
+func (it *Iterator) Item() *CacheItem {
+	return it.items[it.pos]
+}
+
+// Len 获取迭代器创建时的缓存项个数
+func (it *Iterator) Len() int {
+	return len(it.items)
+}
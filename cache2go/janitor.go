@@ -0,0 +1,94 @@
+package cache2go
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithContext 将缓存表与ctx绑定，ctx结束时缓存表会被关闭，等同于调用Close
+func WithContext(ctx context.Context) Option {
+	return func(ct *CacheTable) {
+		ct.ctx = ctx
+	}
+}
+
+// 每个缓存表一个的清理协程，由可重置的定时器驱动，在第一次需要定时清理时启动，缓存表关闭时退出
+type janitor struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// 启动清理协程，调用者需要持有缓存表的写锁
+func (ct *CacheTable) startJanitor() *janitor {
+	if ct.janitor != nil {
+		return ct.janitor
+	}
+	parent := ct.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	j := &janitor{timer: timer, cancel: cancel, done: make(chan struct{})}
+	ct.janitor = j
+	go ct.runJanitor(ctx, j)
+	return j
+}
+
+func (ct *CacheTable) runJanitor(ctx context.Context, j *janitor) {
+	for {
+		select {
+		case <-j.timer.C:
+			ct.expirationCheck()
+		case <-ctx.Done():
+			j.timer.Stop()
+			close(j.done)
+			if ct.ctx != nil && ct.ctx.Err() != nil {
+				// 绑定的ctx结束，关闭缓存表
+				ct.Close()
+			}
+			return
+		}
+	}
+}
+
+// 重置定时器，d大于0时在d之后进行超时检查，否则停止定时器，调用者需要持有缓存表的写锁
+func (ct *CacheTable) scheduleCleanup(d time.Duration) {
+	ct.cleanupDuration = d
+	if ct.centralJanitor {
+		sharedJanitor.schedule(ct, d)
+		return
+	}
+	j := ct.janitor
+	if j == nil {
+		if d <= 0 {
+			return
+		}
+		j = ct.startJanitor()
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.timer.Stop() {
+		// 丢弃已经触发但尚未被清理协程接收的信号
+		select {
+		case <-j.timer.C:
+		default:
+		}
+	}
+	if d > 0 {
+		j.timer.Reset(d)
+	}
+}
+
+// 停止清理协程并等待其退出，调用者不能持有缓存表的锁
+func (ct *CacheTable) stopJanitor(j *janitor) {
+	if j == nil {
+		return
+	}
+	j.cancel()
+	<-j.done
+}
@@ -0,0 +1,55 @@
+package cache2go
+
+// KeepAliveMode 控制Value等方法命中缓存项时如何更新访问信息
+type KeepAliveMode int32
+
+const (
+	// KeepAliveInherit 缓存项使用缓存表的设置，缓存表使用该值时等同于KeepAliveFull
+	KeepAliveInherit KeepAliveMode = iota
+	// KeepAliveFull 刷新最后访问时间并增加访问次数，默认行为
+	KeepAliveFull
+	// KeepAliveCountOnly 只增加访问次数，不刷新最后访问时间，存活时间不会因为访问而延长
+	KeepAliveCountOnly
+	// KeepAliveTouchOnly 只刷新最后访问时间，不增加访问次数
+	KeepAliveTouchOnly
+	// KeepAliveNone 不更新任何访问信息，也不执行访问回调函数
+	KeepAliveNone
+)
+
+// WithKeepAliveMode 设置命中缓存项时更新访问信息的方式，与SetKeepAliveMode相同
+func WithKeepAliveMode(mode KeepAliveMode) Option {
+	return func(ct *CacheTable) {
+		ct.keepAliveMode.Store(int32(mode))
+	}
+}
+
+// SetKeepAliveMode 设置命中缓存项时更新访问信息的方式，设置了KeepAliveMode的缓存项不受影响，
+// 直接调用CacheItem.KeepAlive时总是按KeepAliveFull处理
+func (ct *CacheTable) SetKeepAliveMode(mode KeepAliveMode) {
+	ct.keepAliveMode.Store(int32(mode))
+}
+
+// ItemKeepAliveMode 设置缓存项被命中时更新访问信息的方式，覆盖缓存表的设置
+func ItemKeepAliveMode(mode KeepAliveMode) ItemOption {
+	return func(o *itemOptions) {
+		o.keepAliveMode = mode
+	}
+}
+
+// SetKeepAliveMode 设置缓存项被命中时更新访问信息的方式，传入KeepAliveInherit时使用缓存表的设置
+func (ci *CacheItem) SetKeepAliveMode(mode KeepAliveMode) {
+	ci.Lock()
+	defer ci.Unlock()
+	ci.keepAliveMode = mode
+}
+
+// 缓存表命中缓存项时调用，缓存项设置了KeepAliveMode时优先使用缓存项的设置，否则使用缓存表的设置
+func (ct *CacheTable) hit(item *CacheItem) {
+	mode := KeepAliveMode(ct.keepAliveMode.Load())
+	item.RLock()
+	if item.keepAliveMode != KeepAliveInherit {
+		mode = item.keepAliveMode
+	}
+	item.RUnlock()
+	item.keepAlive(mode)
+}
@@ -0,0 +1,134 @@
+package cache2go
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithLoaderTimeout 设置loadData的最长执行时间，超时后调用者得到ErrLoaderTimeout，
+// loadData无法被中断，它在超时之后返回的数据会被丢弃，0表示不限制
+func WithLoaderTimeout(d time.Duration) Option {
+	return func(ct *CacheTable) {
+		ct.loaderTimeout = d
+	}
+}
+
+// WithLoaderLimit 设置同时执行loadData的最大个数，超出时failFast为true直接返回ErrLoaderBusy，
+// 否则排队等待，等待期间ctx结束时返回ctx.Err()，小于1时表示不限制
+func WithLoaderLimit(n int, failFast bool) Option {
+	return func(ct *CacheTable) {
+		if n < 1 {
+			ct.loaderSlots = nil
+			return
+		}
+		ct.loaderSlots = make(chan struct{}, n)
+		ct.loaderFailFast = failFast
+	}
+}
+
+// 执行loadData并将其中的panic转换为错误，执行期间计入正在进行的加载
+func (ct *CacheTable) runLoader(key interface{}, loadData func(interface{}, ...interface{}) *CacheItem, args ...interface{}) (item *CacheItem, err error) {
+	ct.loading.add()
+	defer ct.loading.done()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf(localize("loadData发生panic：%v", "loadData panicked: %v"), r)
+		}
+	}()
+	return loadData(key, args...), nil
+}
+
+// 在并发数和执行时间的限制下执行loadData，loadData返回nil时item和错误都为nil
+func (ct *CacheTable) callLoader(ctx context.Context, key interface{}, loadData func(interface{}, ...interface{}) *CacheItem, args ...interface{}) (item *CacheItem, err error) {
+	if ct.loaderSlots != nil {
+		if ct.loaderFailFast {
+			select {
+			case ct.loaderSlots <- struct{}{}:
+			default:
+				return nil, ErrLoaderBusy
+			}
+		} else {
+			select {
+			case ct.loaderSlots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		defer func() { <-ct.loaderSlots }()
+	}
+
+	start := time.Now()
+	defer func() {
+		loadErr := err
+		if item == nil && err == nil {
+			loadErr = ErrCacheNotFoundOrLoadable
+		}
+		ct.recordLoad(key, time.Since(start), loadErr)
+	}()
+	if ct.loaderTimeout <= 0 {
+		return ct.runLoader(key, loadData, args...)
+	}
+
+	type loadResult struct {
+		item *CacheItem
+		err  error
+	}
+	result := make(chan loadResult, 1)
+	go func() {
+		item, err := ct.runLoader(key, loadData, args...)
+		result <- loadResult{item, err}
+	}()
+	timer := time.NewTimer(ct.loaderTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-result:
+		return r.item, r.err
+	case <-timer.C:
+		ct.log(LevelWarn, "加载数据超时", "event", "load", "key", key, "timeout", ct.loaderTimeout)
+		return nil, ErrLoaderTimeout
+	}
+}
+
+// 正在进行的操作的计数，可以等待计数归零
+type inflight struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{}
+}
+
+func (f *inflight) add() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.n == 0 {
+		f.idle = make(chan struct{})
+	}
+	f.n++
+}
+
+func (f *inflight) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.n--
+	if f.n == 0 {
+		close(f.idle)
+	}
+}
+
+// 等待计数归零或ctx结束
+func (f *inflight) wait(ctx context.Context) error {
+	f.mu.Lock()
+	if f.n == 0 {
+		f.mu.Unlock()
+		return nil
+	}
+	idle := f.idle
+	f.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,89 @@
+package cache2go
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// LogLevel 日志级别
+type LogLevel int32
+
+const (
+	// LevelDebug 插入、删除等高频操作，默认级别
+	LevelDebug LogLevel = iota
+	// LevelInfo 清空、暂停等低频操作
+	LevelInfo
+	// LevelWarn 异常情况
+	LevelWarn
+)
+
+// Logger 结构化日志接口，方法签名与log/slog中的*slog.Logger兼容，可以直接传入，
+// args为交替出现的键和值，例如"table", "users", "key", 1
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// stdLogger 将*log.Logger适配为Logger，输出key=value格式的日志
+type stdLogger struct {
+	l *log.Logger
+}
+
+// NewStdLogger 将标准库的*log.Logger包装为Logger
+func NewStdLogger(l *log.Logger) Logger {
+	return &stdLogger{l: l}
+}
+
+func (s *stdLogger) Debug(msg string, args ...interface{}) { s.output("DEBUG", msg, args) }
+func (s *stdLogger) Info(msg string, args ...interface{})  { s.output("INFO", msg, args) }
+func (s *stdLogger) Warn(msg string, args ...interface{})  { s.output("WARN", msg, args) }
+func (s *stdLogger) Error(msg string, args ...interface{}) { s.output("ERROR", msg, args) }
+
+func (s *stdLogger) output(level, msg string, args []interface{}) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "level=%s msg=%q", level, msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			// 缺少值的键与slog一样使用!BADKEY
+			fmt.Fprintf(&b, " !BADKEY=%v", args[i])
+		}
+	}
+	s.l.Println(b.String())
+}
+
+// SetStructuredLogger 设置结构化日志，每条日志都会带上table字段，传入nil关闭日志
+func (ct *CacheTable) SetStructuredLogger(logger Logger) {
+	ct.updateReadConfig(func(c *readConfig) { c.logger = logger })
+}
+
+// SetLogLevel 设置日志级别，低于该级别的日志不会构造也不会输出
+func (ct *CacheTable) SetLogLevel(level LogLevel) {
+	ct.logLevel.Store(int32(level))
+}
+
+// 判断该级别的日志是否需要输出，高频路径在构造日志参数之前调用
+func (ct *CacheTable) logEnabled(level LogLevel) bool {
+	return ct.readConfig().logger != nil && level >= LogLevel(ct.logLevel.Load())
+}
+
+// 打印日志，args为交替出现的键和值
+func (ct *CacheTable) log(level LogLevel, msg string, args ...interface{}) {
+	logger := ct.readConfig().logger
+	if logger == nil || level < LogLevel(ct.logLevel.Load()) {
+		return
+	}
+	args = append([]interface{}{"table", ct.Name()}, args...)
+	switch level {
+	case LevelDebug:
+		logger.Debug(msg, args...)
+	case LevelInfo:
+		logger.Info(msg, args...)
+	default:
+		logger.Warn(msg, args...)
+	}
+}
@@ -0,0 +1,277 @@
+// Package memcached 提供memcached文本协议的前端，使用CacheTable作为存储，
+// 支持get、gets、set、delete、touch、stats和quit命令
+package memcached
+
+import (
+	"bufio"
+	"cache2go"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// exptime超过30天时按照unix时间戳处理，与memcached一致
+const relativeExpireLimit = 60 * 60 * 24 * 30
+
+// 单个数据块的最大长度
+const maxValueSize = 1 << 20
+
+// Item 通过memcached协议写入的缓存数据
+type Item struct {
+	Flags uint32
+	Data  []byte
+}
+
+// Server memcached文本协议服务
+type Server struct {
+	table *cache2go.CacheTable
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewServer 创建使用table作为存储的memcached服务
+func NewServer(table *cache2go.CacheTable) *Server {
+	return &Server{table: table, conns: make(map[net.Conn]struct{})}
+}
+
+// ListenAndServe 监听addr并提供服务
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 在l上接受连接并提供服务，直到Close被调用
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return net.ErrClosed
+	}
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+// Close 停止监听并关闭所有连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// 处理一个连接上的所有命令
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			w.WriteString("ERROR\r\n")
+			w.Flush()
+			continue
+		}
+		if fields[0] == "quit" {
+			return
+		}
+		if err := s.handle(fields, r, w); err != nil {
+			return
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// 处理一条命令，返回错误时关闭连接
+func (s *Server) handle(fields []string, r *bufio.Reader, w *bufio.Writer) error {
+	switch fields[0] {
+	case "get", "gets":
+		if len(fields) < 2 {
+			w.WriteString("ERROR\r\n")
+			return nil
+		}
+		found, _ := s.table.Values(toKeys(fields[1:])...)
+		for _, key := range fields[1:] {
+			item, ok := found[key]
+			if !ok {
+				continue
+			}
+			flags, data := itemData(item)
+			if fields[0] == "gets" {
+				fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, flags, len(data), item.Version())
+			} else {
+				fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, flags, len(data))
+			}
+			w.Write(data)
+			w.WriteString("\r\n")
+		}
+		w.WriteString("END\r\n")
+	case "set":
+		// set <key> <flags> <exptime> <bytes> [noreply]
+		if len(fields) < 5 {
+			w.WriteString("ERROR\r\n")
+			return nil
+		}
+		flags, err1 := strconv.ParseUint(fields[2], 10, 32)
+		exptime, err2 := strconv.ParseInt(fields[3], 10, 64)
+		size, err3 := strconv.Atoi(fields[4])
+		if err1 != nil || err2 != nil || err3 != nil || size < 0 || size > maxValueSize {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		if string(data[size:]) != "\r\n" {
+			w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+			return nil
+		}
+		key := fields[1]
+		if lifeSpan, ok := lifeSpanOf(exptime); ok {
+			s.table.Add(key, &Item{Flags: uint32(flags), Data: data[:size]}, lifeSpan)
+		} else {
+			// 已经过期的数据直接删除
+			s.table.Delete(key)
+		}
+		reply(w, fields, 5, "STORED")
+	case "delete":
+		if len(fields) < 2 {
+			w.WriteString("ERROR\r\n")
+			return nil
+		}
+		if _, err := s.table.Delete(fields[1]); err != nil {
+			reply(w, fields, 2, "NOT_FOUND")
+		} else {
+			reply(w, fields, 2, "DELETED")
+		}
+	case "touch":
+		// touch <key> <exptime> [noreply]
+		if len(fields) < 3 {
+			w.WriteString("ERROR\r\n")
+			return nil
+		}
+		exptime, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return nil
+		}
+		lifeSpan, ok := lifeSpanOf(exptime)
+		if !ok {
+			_, err = s.table.Delete(fields[1])
+		} else {
+			err = s.table.Touch(fields[1], lifeSpan)
+		}
+		if errors.Is(err, cache2go.ErrCacheNotFound) {
+			reply(w, fields, 3, "NOT_FOUND")
+		} else {
+			reply(w, fields, 3, "TOUCHED")
+		}
+	case "stats":
+		st := s.table.Stats()
+		fmt.Fprintf(w, "STAT curr_items %d\r\n", s.table.Count())
+		fmt.Fprintf(w, "STAT get_hits %d\r\n", st.Hits)
+		fmt.Fprintf(w, "STAT get_misses %d\r\n", st.Misses)
+		fmt.Fprintf(w, "STAT total_items %d\r\n", st.Adds)
+		fmt.Fprintf(w, "STAT evictions %d\r\n", st.Evictions)
+		fmt.Fprintf(w, "STAT expired_unfetched %d\r\n", st.Expirations)
+		w.WriteString("END\r\n")
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return nil
+}
+
+// 根据noreply参数决定是否回复
+func reply(w *bufio.Writer, fields []string, noreplyIndex int, msg string) {
+	if len(fields) > noreplyIndex && fields[noreplyIndex] == "noreply" {
+		return
+	}
+	w.WriteString(msg + "\r\n")
+}
+
+// 将memcached的exptime转换为存活时间，返回false表示数据已经过期
+func lifeSpanOf(exptime int64) (time.Duration, bool) {
+	switch {
+	case exptime == 0:
+		return 0, true
+	case exptime < 0:
+		return 0, false
+	case exptime > relativeExpireLimit:
+		d := time.Until(time.Unix(exptime, 0))
+		return d, d > 0
+	}
+	return time.Duration(exptime) * time.Second, true
+}
+
+// 获取缓存项的flags和数据，兼容不是通过memcached协议写入的数据
+func itemData(item *cache2go.CacheItem) (uint32, []byte) {
+	switch data := item.Data().(type) {
+	case *Item:
+		return data.Flags, data.Data
+	case []byte:
+		return 0, data
+	case string:
+		return 0, []byte(data)
+	default:
+		return 0, []byte(fmt.Sprint(data))
+	}
+}
+
+func toKeys(keys []string) []interface{} {
+	res := make([]interface{}, len(keys))
+	for i, k := range keys {
+		res[i] = k
+	}
+	return res
+}
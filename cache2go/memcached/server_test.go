@@ -0,0 +1,80 @@
+package memcached
+
+import (
+	"bufio"
+	"cache2go"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	table := cache2go.Cache("testMemcachedServer")
+	// 关闭时从注册中心移除，重复运行时使用新的缓存表，统计信息不会累加
+	defer table.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(table)
+	go srv.Serve(l)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	send := func(cmd string, lines int) string {
+		conn.Write([]byte(cmd))
+		var b strings.Builder
+		for i := 0; i < lines; i++ {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal("Error reading response", err)
+			}
+			b.WriteString(line)
+		}
+		return b.String()
+	}
+
+	if resp := send("set key 5 0 5\r\nvalue\r\n", 1); resp != "STORED\r\n" {
+		t.Error("Unexpected set response", resp)
+	}
+	if resp := send("get key missing\r\n", 3); resp != "VALUE key 5 5\r\nvalue\r\nEND\r\n" {
+		t.Error("Unexpected get response", resp)
+	}
+	// gets返回的cas值为缓存项的版本号，每次修改都会变化
+	item, _ := table.Value("key")
+	first := fmt.Sprintf("VALUE key 5 5 %d\r\nvalue\r\nEND\r\n", item.Version())
+	if resp := send("gets key\r\n", 3); resp != first {
+		t.Error("Unexpected gets response", resp)
+	}
+	send("set key 5 0 5\r\nvalue\r\n", 1)
+	if resp := send("gets key\r\n", 3); resp == first {
+		t.Error("Expected the cas value to change after an update", resp)
+	}
+	if resp := send("touch key 1\r\n", 1); resp != "TOUCHED\r\n" {
+		t.Error("Unexpected touch response", resp)
+	}
+	if ttl, _ := table.TTL("key"); ttl <= 0 || ttl > time.Second {
+		t.Error("Error applying touch exptime", ttl)
+	}
+	if resp := send("delete key\r\n", 1); resp != "DELETED\r\n" {
+		t.Error("Unexpected delete response", resp)
+	}
+	if resp := send("delete key\r\n", 1); resp != "NOT_FOUND\r\n" {
+		t.Error("Unexpected delete response", resp)
+	}
+	// get、Value及两次gets各命中一次
+	if resp := send("stats\r\n", 7); !strings.Contains(resp, "STAT get_hits 4\r\n") || !strings.HasSuffix(resp, "END\r\n") {
+		t.Error("Unexpected stats response", resp)
+	}
+	if resp := send("bogus\r\n", 1); resp != "ERROR\r\n" {
+		t.Error("Unexpected response to unknown command", resp)
+	}
+}
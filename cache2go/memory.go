@@ -0,0 +1,101 @@
+package cache2go
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// Sizer 数据实现该接口时MemoryUsage直接使用Size的返回值作为其占用的字节数
+type Sizer interface {
+	Size() int
+}
+
+// 每个缓存项除键和数据以外的固定开销，包括CacheItem本身以及map中的一个条目
+var itemOverhead = int64(unsafe.Sizeof(CacheItem{})) + 2*int64(unsafe.Sizeof(uintptr(0)))
+
+// MemoryUsage 估算缓存表中所有缓存项占用的字节数，包括键、数据以及每个缓存项的固定开销。
+// 数据实现了Sizer时使用其返回值，否则通过反射递归计算，结果只是近似值，适合用于监控和告警
+func (ct *CacheTable) MemoryUsage() int64 {
+	var total int64
+	ct.rangeItems(func(key interface{}, item *CacheItem) {
+		item.RLock()
+		data := item.data
+		item.RUnlock()
+		total += itemOverhead + sizeOf(key) + sizeOf(data)
+	})
+	return total
+}
+
+// 估算一个值占用的字节数
+func sizeOf(v interface{}) int64 {
+	switch d := v.(type) {
+	case nil:
+		return 0
+	case Sizer:
+		return int64(d.Size())
+	case string:
+		return int64(len(d))
+	case []byte:
+		return int64(cap(d))
+	case *encodedValue:
+		return int64(cap(d.data))
+	}
+	rv := reflect.ValueOf(v)
+	return int64(rv.Type().Size()) + deepSize(rv, make(map[uintptr]bool))
+}
+
+// 计算值引用的额外内存，不包括值本身的大小，seen用于避免重复计算同一个指针和循环引用
+func deepSize(v reflect.Value, seen map[uintptr]bool) int64 {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		elem := v.Elem()
+		return int64(elem.Type().Size()) + deepSize(elem, seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		elem := v.Elem()
+		return int64(elem.Type().Size()) + deepSize(elem, seen)
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		n := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			n += deepSize(v.Index(i), seen)
+		}
+		return n
+	case reflect.Array:
+		var n int64
+		for i := 0; i < v.Len(); i++ {
+			n += deepSize(v.Index(i), seen)
+		}
+		return n
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		entry := int64(v.Type().Key().Size() + v.Type().Elem().Size())
+		var n int64
+		iter := v.MapRange()
+		for iter.Next() {
+			n += entry + deepSize(iter.Key(), seen) + deepSize(iter.Value(), seen)
+		}
+		return n
+	case reflect.Struct:
+		var n int64
+		for i := 0; i < v.NumField(); i++ {
+			n += deepSize(v.Field(i), seen)
+		}
+		return n
+	}
+	return 0
+}
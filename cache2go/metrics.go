@@ -0,0 +1,63 @@
+package cache2go
+
+import "time"
+
+// MetricsHook 指标上报的接口，可以对接statsd、Datadog等任意监控系统，cache2go本身不依赖具体的实现。
+// 方法在访问缓存表的goroutine中同步调用，OnEvict和OnExpire调用时缓存表处于加锁状态，
+// 实现需要足够快并且不能调用同一个缓存表的方法
+type MetricsHook interface {
+	// OnHit 命中缓存项
+	OnHit(table string, key interface{})
+	// OnMiss 未命中缓存项
+	OnMiss(table string, key interface{})
+	// OnLoad 执行一次loadData或GetOrCompute的compute，d为执行耗时，err不为nil时表示加载失败，
+	// loadData返回nil时err为ErrCacheNotFoundOrLoadable
+	OnLoad(table string, key interface{}, d time.Duration, err error)
+	// OnEvict 缓存项因超出容量限制被淘汰，age为缓存项从创建到被淘汰经过的时间
+	OnEvict(table string, key interface{}, age time.Duration)
+	// OnExpire 缓存项过期被删除，age为缓存项从创建到过期经过的时间
+	OnExpire(table string, key interface{}, age time.Duration)
+}
+
+// SetMetricsHook 设置缓存表的指标上报实现，传入nil关闭上报
+func (ct *CacheTable) SetMetricsHook(hook MetricsHook) {
+	ct.updateReadConfig(func(c *readConfig) { c.metrics = hook })
+}
+
+// 记录一次命中
+func (ct *CacheTable) recordHit(key interface{}) {
+	ct.stats.add(&ct.stats.hits, 1)
+	if hook := ct.readConfig().metrics; hook != nil {
+		hook.OnHit(ct.Name(), key)
+	}
+}
+
+// 记录一次未命中
+func (ct *CacheTable) recordMiss(key interface{}) {
+	ct.stats.add(&ct.stats.misses, 1)
+	if hook := ct.readConfig().metrics; hook != nil {
+		hook.OnMiss(ct.Name(), key)
+	}
+}
+
+// 记录一次加载的耗时和结果
+func (ct *CacheTable) recordLoad(key interface{}, d time.Duration, err error) {
+	ct.stats.observeLoad(d)
+	if hook := ct.readConfig().metrics; hook != nil {
+		hook.OnLoad(ct.Name(), key, d, err)
+	}
+}
+
+// 记录缓存项因过期或淘汰被删除，调用者需要持有缓存项的读锁
+func (ct *CacheTable) recordRemovalLocked(key interface{}, item *CacheItem, reason DeleteReason) {
+	hook := ct.readConfig().metrics
+	if hook == nil {
+		return
+	}
+	switch reason {
+	case ReasonExpired:
+		hook.OnExpire(ct.Name(), key, ct.now().Sub(item.createTime))
+	case ReasonEvicted:
+		hook.OnEvict(ct.Name(), key, ct.now().Sub(item.createTime))
+	}
+}
@@ -0,0 +1,117 @@
+package cache2go
+
+import (
+	"strings"
+	"time"
+)
+
+// Namespace 缓存表上的命名空间视图，所有操作都会在键前加上前缀，Keys、Foreach、Count和Flush只作用于该前缀下的缓存项，
+// 多个组件可以通过不同的命名空间共享同一个缓存表，缓存项的Key返回加上前缀之后的键
+type Namespace struct {
+	table  *CacheTable
+	prefix string
+}
+
+// NamespaceSeparator 命名空间前缀与键之间的分隔符，避免"user"和"users"这样相互重叠的前缀看到彼此的缓存项
+const NamespaceSeparator = ":"
+
+// Namespace 创建以prefix为前缀的命名空间视图，prefix不以NamespaceSeparator结尾时会自动加上，视图本身不保存数据
+func (ct *CacheTable) Namespace(prefix string) *Namespace {
+	return &Namespace{table: ct, prefix: namespacePrefix(prefix)}
+}
+
+// Namespace 创建嵌套的命名空间，前缀为当前前缀加上prefix和分隔符
+func (ns *Namespace) Namespace(prefix string) *Namespace {
+	return &Namespace{table: ns.table, prefix: ns.prefix + namespacePrefix(prefix)}
+}
+
+// 确保前缀以分隔符结尾
+func namespacePrefix(prefix string) string {
+	if strings.HasSuffix(prefix, NamespaceSeparator) {
+		return prefix
+	}
+	return prefix + NamespaceSeparator
+}
+
+// Table 获取命名空间所在的缓存表
+func (ns *Namespace) Table() *CacheTable {
+	return ns.table
+}
+
+// Prefix 获取命名空间的前缀，包含结尾的分隔符
+func (ns *Namespace) Prefix() string {
+	return ns.prefix
+}
+
+// 判断缓存表中的键是否属于当前命名空间，返回去掉前缀之后的键
+func (ns *Namespace) own(key interface{}) (string, bool) {
+	k, ok := key.(string)
+	if !ok || !strings.HasPrefix(k, ns.prefix) {
+		return "", false
+	}
+	return k[len(ns.prefix):], true
+}
+
+// Add 新增缓存项，与CacheTable.Add相同
+func (ns *Namespace) Add(key string, data interface{}, lifeSpan time.Duration) *CacheItem {
+	return ns.table.Add(ns.prefix+key, data, lifeSpan)
+}
+
+// NotFoundAdd 缓存项不存在时新增，与CacheTable.NotFoundAdd相同
+func (ns *Namespace) NotFoundAdd(key string, lifeSpan time.Duration, data interface{}) bool {
+	return ns.table.NotFoundAdd(ns.prefix+key, lifeSpan, data)
+}
+
+// Value 获取缓存项，与CacheTable.Value相同，loadData收到的是加上前缀之后的键
+func (ns *Namespace) Value(key string, args ...interface{}) (*CacheItem, error) {
+	return ns.table.Value(ns.prefix+key, args...)
+}
+
+// Exists 判断缓存项是否存在
+func (ns *Namespace) Exists(key string) bool {
+	return ns.table.Exists(ns.prefix + key)
+}
+
+// Delete 删除缓存项，与CacheTable.Delete相同
+func (ns *Namespace) Delete(key string) (*CacheItem, error) {
+	return ns.table.Delete(ns.prefix + key)
+}
+
+// Keys 获取命名空间中所有的键，返回的键不包含前缀
+func (ns *Namespace) Keys() []string {
+	var keys []string
+	ns.table.rangeItems(func(key interface{}, _ *CacheItem) {
+		if k, ok := ns.own(key); ok {
+			keys = append(keys, k)
+		}
+	})
+	return keys
+}
+
+// Foreach 遍历命名空间中的缓存项，传入的键不包含前缀
+func (ns *Namespace) Foreach(op func(key string, item *CacheItem)) {
+	ns.table.rangeItems(func(key interface{}, item *CacheItem) {
+		if k, ok := ns.own(key); ok {
+			op(k, item)
+		}
+	})
+}
+
+// Count 获取命名空间中缓存项的个数
+func (ns *Namespace) Count() int {
+	n := 0
+	ns.table.rangeItems(func(key interface{}, _ *CacheItem) {
+		if _, ok := ns.own(key); ok {
+			n++
+		}
+	})
+	return n
+}
+
+// Flush 删除命名空间中的所有缓存项，与CacheTable.Flush不同，会以ReasonFlushed执行删除回调函数，返回删除的个数
+func (ns *Namespace) Flush() int {
+	return len(ns.table.deleteWhere(func(key interface{}, _ *CacheItem) bool {
+		_, ok := ns.own(key)
+		return ok
+	}, ReasonFlushed))
+}
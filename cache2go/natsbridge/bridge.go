@@ -0,0 +1,206 @@
+// Package natsbridge 通过NATS在多个进程之间同步缓存表的失效，
+// 订阅主题中的失效消息并对同名的缓存表执行Delete或Flush，也可以把本地的删除发布出去，
+// 只依赖标准库，自行实现了所需的NATS客户端协议
+package natsbridge
+
+import (
+	"bufio"
+	"cache2go/invalidation"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 单条消息的最大长度
+const maxPayloadSize = 64 << 20
+
+// ErrNotConnected 尚未连接到NATS服务器时发布失败
+var ErrNotConnected = errors.New("nats: not connected")
+
+// Message 在主题中传递的失效消息
+type Message = invalidation.Message
+
+// Options 桥接的配置
+type Options struct {
+	// NATS服务器的地址
+	Addr string
+	// 用户名和密码，为空时不进行认证
+	User     string
+	Password string
+	// 认证使用的token，为空时不使用
+	Token string
+	// 发布和订阅使用的主题
+	Subject string
+	// 需要同步的缓存表，为空时处理所有已注册的缓存表。
+	// 发布本地删除时只会订阅Run开始时已经存在的缓存表
+	Tables []string
+	// 是否把本地通过Delete删除的键发布出去，过期和淘汰不会发布
+	Publish bool
+	// 实例的标识，为空时随机生成
+	Origin string
+	// 连接断开后重连的间隔，默认为1秒
+	ReconnectDelay time.Duration
+}
+
+// Bridge NATS失效消息与缓存表之间的桥接，订阅和发布共用一个连接
+type Bridge struct {
+	opts  Options
+	relay *invalidation.Relay
+
+	// 当前连接的写入端，未连接时为nil
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// New 创建桥接，调用Run之后开始工作
+func New(opts Options) *Bridge {
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = time.Second
+	}
+	return &Bridge{opts: opts, relay: invalidation.NewRelay(opts.Origin, opts.Tables)}
+}
+
+// Origin 获取实例的标识
+func (b *Bridge) Origin() string {
+	return b.relay.Origin()
+}
+
+// Run 连接服务器、订阅主题并处理失效消息，连接断开时自动重连，直到ctx取消后返回ctx的错误
+func (b *Bridge) Run(ctx context.Context) error {
+	if b.opts.Publish {
+		b.relay.Watch(ctx, b.publish)
+	}
+	for {
+		b.subscribe(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(b.opts.ReconnectDelay):
+		}
+	}
+}
+
+// PublishDelete 通知其他实例删除缓存表中的键，只能在Run连接成功之后调用
+func (b *Bridge) PublishDelete(table, key string) error {
+	return b.publish(b.relay.Delete(table, key))
+}
+
+// PublishFlush 通知其他实例清空缓存表，只能在Run连接成功之后调用
+func (b *Bridge) PublishFlush(table string) error {
+	return b.publish(b.relay.Flush(table))
+}
+
+// 连接时发送的CONNECT参数
+type connectOptions struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Protocol int    `json:"protocol"`
+	Echo     bool   `json:"echo"`
+	Name     string `json:"name"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+}
+
+// 建立连接并处理服务器发来的消息，直到连接出错或ctx取消
+func (b *Bridge) subscribe(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", b.opts.Addr)
+	if err != nil {
+		return err
+	}
+	// ctx取消时关闭连接，使阻塞的读取返回
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("nats: unexpected greeting %q", line)
+	}
+	connect, _ := json.Marshal(connectOptions{
+		Protocol: 1,
+		Name:     "cache2go-" + b.Origin(),
+		User:     b.opts.User,
+		Pass:     b.opts.Password,
+		Token:    b.opts.Token,
+	})
+	fmt.Fprintf(w, "CONNECT %s\r\nSUB %s 1\r\n", connect, b.opts.Subject)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.w = w
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.w = nil
+		b.mu.Unlock()
+	}()
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			n, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || n < 0 || n > maxPayloadSize {
+				return fmt.Errorf("nats: malformed message %q", line)
+			}
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return err
+			}
+			b.relay.Apply(payload[:n])
+		case line == "PING":
+			if err := b.write("PONG\r\n", nil); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("nats: " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (b *Bridge) publish(payload []byte) error {
+	return b.write(fmt.Sprintf("PUB %s %d\r\n", b.opts.Subject, len(payload)), payload)
+}
+
+// 在当前连接上写入一条命令，payload不为nil时在命令之后写入数据块
+func (b *Bridge) write(cmd string, payload []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.w == nil {
+		return ErrNotConnected
+	}
+	b.w.WriteString(cmd)
+	if payload != nil {
+		b.w.Write(payload)
+		b.w.WriteString("\r\n")
+	}
+	return b.w.Flush()
+}
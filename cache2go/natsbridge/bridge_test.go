@@ -0,0 +1,145 @@
+package natsbridge
+
+import (
+	"bufio"
+	"cache2go"
+	"cache2go/invalidation"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNats implements just enough of the NATS client protocol for the bridge.
+type fakeNats struct {
+	l          net.Listener
+	mu         sync.Mutex
+	subs       map[string][]*bufio.Writer
+	subscribed chan string
+	published  chan Message
+}
+
+func newFakeNats(t *testing.T) *fakeNats {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeNats{
+		l:          l,
+		subs:       make(map[string][]*bufio.Writer),
+		subscribed: make(chan string, 8),
+		published:  make(chan Message, 8),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeNats) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	w.WriteString("INFO {\"server_id\":\"fake\"}\r\n")
+	// the bridge must answer pings from the server
+	w.WriteString("PING\r\n")
+	w.Flush()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		s.mu.Lock()
+		switch fields[0] {
+		case "SUB":
+			s.subs[fields[1]] = append(s.subs[fields[1]], w)
+			s.subscribed <- fields[1]
+		case "PUB":
+			n, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, n+2)
+			io.ReadFull(r, payload)
+			var m Message
+			json.Unmarshal(payload[:n], &m)
+			s.published <- m
+			for _, sub := range s.subs[fields[1]] {
+				fmt.Fprintf(sub, "MSG %s 1 %d\r\n%s\r\n", fields[1], n, payload[:n])
+				sub.Flush()
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestBridge(t *testing.T) {
+	srv := newFakeNats(t)
+	defer srv.l.Close()
+	table := cache2go.Cache("testNatsBridge")
+	table.Add("remote", 1, 0)
+	table.Add("local", 2, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := New(Options{Addr: srv.l.Addr().String(), Subject: "inval", Tables: []string{"testNatsBridge"}, Publish: true})
+	go b.Run(ctx)
+	other := New(Options{Addr: srv.l.Addr().String(), Subject: "inval", Tables: []string{"unused"}})
+	if err := other.PublishFlush("testNatsBridge"); err != ErrNotConnected {
+		t.Error("Publishing before connecting should fail", err)
+	}
+	go other.Run(ctx)
+	<-srv.subscribed
+	<-srv.subscribed
+
+	next := func() Message {
+		select {
+		case m := <-srv.published:
+			return m
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for a published message")
+		}
+		return Message{}
+	}
+	waitFor := func(cond func() bool) bool {
+		deadline := time.Now().Add(time.Second)
+		for !cond() && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		return cond()
+	}
+
+	if err := other.PublishDelete("testNatsBridge", "remote"); err != nil {
+		t.Fatal(err)
+	}
+	next()
+	if !waitFor(func() bool { return !table.Exists("remote") }) {
+		t.Error("Remote invalidation should delete the key")
+	}
+
+	// the remote delete must not be published again, so the next message is the local delete
+	table.Delete("local")
+	if m := next(); m.Origin != b.Origin() || m.Op != invalidation.OpDelete || m.Key != "local" {
+		t.Error("Local delete should be published", m)
+	}
+
+	table.Add("flushed", 3, 0)
+	other.PublishFlush("testNatsBridge")
+	next()
+	if !waitFor(func() bool { return table.Count() == 0 }) {
+		t.Error("Remote flush should clear the table")
+	}
+}
@@ -0,0 +1,72 @@
+package cache2go
+
+import "time"
+
+// Option 创建缓存表时的配置项，在缓存表接收请求之前生效，避免创建之后再调用Set*方法产生竞争
+type Option func(*CacheTable)
+
+// Clock 时钟接口，用于计算缓存项的创建时间、访问时间和是否过期，测试中可以替换为可控的时钟，
+// 定时器仍然使用真实时间，使用自定义时钟时可以调用DeleteExpired手动清理
+type Clock interface {
+	Now() time.Time
+}
+
+// WithDefaultLifeSpan 设置默认存活时间，与SetDefaultLifeSpan相同
+func WithDefaultLifeSpan(d time.Duration) Option {
+	return func(ct *CacheTable) {
+		ct.updateReadConfig(func(c *readConfig) { c.defaultLifeSpan = d })
+	}
+}
+
+// WithMaxLifeSpan 设置存活时间的上限，与SetMaxLifeSpan相同
+func WithMaxLifeSpan(d time.Duration) Option {
+	return func(ct *CacheTable) {
+		ct.updateReadConfig(func(c *readConfig) { c.maxLifeSpan = d })
+	}
+}
+
+// WithMaxItems 设置缓存项的最大个数，超出时淘汰最久未被访问的缓存项，被固定的缓存项不会被淘汰，0表示不限制
+func WithMaxItems(n int) Option {
+	return func(ct *CacheTable) {
+		ct.maxItems = n
+	}
+}
+
+// WithLogger 设置结构化日志，与SetStructuredLogger相同
+func WithLogger(logger Logger) Option {
+	return func(ct *CacheTable) {
+		ct.updateReadConfig(func(c *readConfig) { c.logger = logger })
+	}
+}
+
+// WithClock 设置缓存表使用的时钟
+func WithClock(clock Clock) Option {
+	return func(ct *CacheTable) {
+		ct.clock = clock
+	}
+}
+
+// WithStats 设置是否开启统计信息，默认开启，关闭后Stats返回的计数都为0
+func WithStats(enabled bool) Option {
+	return func(ct *CacheTable) {
+		ct.stats.disabled = !enabled
+	}
+}
+
+// 获取缓存表的当前时间
+func (ct *CacheTable) now() time.Time {
+	if ct.clock != nil {
+		return ct.clock.Now()
+	}
+	return time.Now()
+}
+
+// 使用缓存表的时钟创建缓存项
+func (ct *CacheTable) newItem(key, data interface{}, lifeSpan time.Duration) *CacheItem {
+	item := NewCacheItem(key, data, lifeSpan)
+	if ct.clock != nil {
+		item.createTime = ct.clock.Now()
+		item.accessedTime = item.createTime
+	}
+	return item
+}
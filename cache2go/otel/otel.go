@@ -0,0 +1,58 @@
+// Package otel 为cache2go提供基于OpenTelemetry的链路追踪实现
+package otel
+
+import (
+	"cache2go"
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 创建Tracer时使用的instrumentation名字
+const instrumentationName = "cache2go"
+
+// tracer 将cache2go.Tracer适配到OpenTelemetry
+type tracer struct {
+	tracer trace.Tracer
+}
+
+// span 将cache2go.Span适配到OpenTelemetry
+type span struct {
+	span trace.Span
+}
+
+// SetTracerProvider 使用tp为缓存表开启链路追踪，loadData的执行以及Value的命中情况会出现在链路中
+func SetTracerProvider(table *cache2go.CacheTable, tp trace.TracerProvider) {
+	table.SetTracer(NewTracer(tp))
+}
+
+// NewTracer 使用tp创建cache2go.Tracer
+func NewTracer(tp trace.TracerProvider) cache2go.Tracer {
+	return &tracer{tracer: tp.Tracer(instrumentationName)}
+}
+
+// Start 实现cache2go.Tracer
+func (t *tracer) Start(ctx context.Context, name string, table string, key interface{}) (context.Context, cache2go.Span) {
+	ctx, s := t.tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("cache2go.table", table),
+		attribute.String("cache2go.key", fmt.Sprint(key)),
+	))
+	return ctx, &span{span: s}
+}
+
+// Event 实现cache2go.Span
+func (s *span) Event(name string) {
+	s.span.AddEvent(name)
+}
+
+// End 实现cache2go.Span
+func (s *span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,36 @@
+package otel
+
+import (
+	"cache2go"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetTracerProvider(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	table := cache2go.Cache("testSetTracerProvider")
+	SetTracerProvider(table, tp)
+	table.SetDataLoader(func(key interface{}, args ...interface{}) *cache2go.CacheItem {
+		return cache2go.NewCacheItem(key, "value", 0)
+	})
+	table.Value("key")
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatal("Expected Value and Load spans", len(spans))
+	}
+	load, value := spans[0], spans[1]
+	if load.Name() != cache2go.SpanLoad || value.Name() != cache2go.SpanValue {
+		t.Error("Unexpected span names", load.Name(), value.Name())
+	}
+	if load.Parent().SpanID() != value.SpanContext().SpanID() {
+		t.Error("Load span should be a child of the Value span")
+	}
+	if len(value.Events()) != 1 || value.Events()[0].Name != cache2go.EventMiss {
+		t.Error("Expected a cache miss event", value.Events())
+	}
+}
@@ -0,0 +1,267 @@
+package cache2go
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+// 持久化时每一个缓存项的结构，gob要求字段必须导出
+type persistedItem struct {
+	Key         interface{}
+	Data        interface{}
+	LifeSpan    time.Duration
+	Remaining   time.Duration
+	CreateTime  time.Time
+	AccessCount int64
+	// 设置了Serializer时数据序列化后保存在Encoded中，此时Data为nil
+	Encoded []byte
+	// 缓存表开启加密时[]byte和string类型的数据以及Encoded以密文保存在Sealed中，此时Data和Encoded为nil
+	Sealed        []byte
+	SealedString  bool
+	SealedEncoded bool
+}
+
+// Save 使用gob将缓存表中的缓存项写入w，会保存存活时间、剩余存活时间、创建时间和访问次数，
+// 自定义类型的键和值需要先通过gob.Register注册，设置了WithSerializer时值使用Serializer编码
+func (ct *CacheTable) Save(w io.Writer) error {
+	now := ct.now()
+	items := make([]persistedItem, 0, ct.count())
+	ct.rangeItems(func(k interface{}, v *CacheItem) {
+		v.RLock()
+		items = append(items, persistedItem{
+			Key:         k,
+			Data:        v.dataLocked(),
+			LifeSpan:    v.lifeSpan,
+			Remaining:   v.lifeSpan - now.Sub(v.expireBaseLocked()),
+			CreateTime:  v.createTime,
+			AccessCount: v.accessCountLocked(),
+		})
+		v.RUnlock()
+	})
+	for i := range items {
+		if ct.serializer != nil {
+			b, err := ct.serializer.Encode(items[i].Data)
+			if err != nil {
+				return err
+			}
+			items[i].Data, items[i].Encoded = nil, b
+		}
+		if ct.cipher != nil {
+			if err := ct.seal(&items[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return gob.NewEncoder(w).Encode(items)
+}
+
+// SaveFile 将缓存表保存到文件中
+func (ct *CacheTable) SaveFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := ct.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load 从r中读取Save保存的缓存项并加入缓存表，已存在的键会被覆盖，
+// 保存时已经过期的缓存项会被忽略，其余缓存项按照保存时的剩余存活时间继续倒计时
+func (ct *CacheTable) Load(r io.Reader) error {
+	var saved []persistedItem
+	if err := gob.NewDecoder(r).Decode(&saved); err != nil {
+		return err
+	}
+
+	now := ct.now()
+	items := make([]*CacheItem, 0, len(saved))
+	for _, p := range saved {
+		if p.LifeSpan > 0 && p.Remaining <= 0 {
+			continue
+		}
+		if p.Sealed != nil {
+			if err := ct.unseal(&p); err != nil {
+				return err
+			}
+		}
+		if p.Encoded != nil {
+			if ct.serializer == nil {
+				return ErrNoSerializer
+			}
+			data, err := ct.serializer.Decode(p.Encoded)
+			if err != nil {
+				return err
+			}
+			p.Data, p.Encoded = data, nil
+		}
+		lifeSpan, remaining := ct.clampRemaining(p.LifeSpan, p.Remaining)
+		item := NewCacheItem(p.Key, p.Data, lifeSpan)
+		item.createTime = p.CreateTime
+		item.accessCount = p.AccessCount
+		if lifeSpan > 0 {
+			// 通过调整最后访问时间还原剩余存活时间
+			item.accessedTime = now.Add(remaining - lifeSpan)
+		}
+		items = append(items, item)
+	}
+	ct.addItems(items)
+	return nil
+}
+
+// 使用缓存表的加密算法加密需要保存的数据
+func (ct *CacheTable) seal(p *persistedItem) error {
+	var raw []byte
+	switch d := p.Data.(type) {
+	case []byte:
+		raw = d
+	case string:
+		raw, p.SealedString = []byte(d), true
+	default:
+		if p.Encoded == nil {
+			return nil
+		}
+		raw, p.SealedEncoded = p.Encoded, true
+	}
+	sealed, err := ct.cipher.Encode(raw)
+	if err != nil {
+		return err
+	}
+	p.Data, p.Encoded, p.Sealed = nil, nil, sealed
+	return nil
+}
+
+// 解密Save保存的密文
+func (ct *CacheTable) unseal(p *persistedItem) error {
+	if ct.cipher == nil {
+		return ErrNotEncrypted
+	}
+	raw, err := ct.cipher.Decode(p.Sealed)
+	if err != nil {
+		return err
+	}
+	switch {
+	case p.SealedEncoded:
+		p.Encoded = raw
+	case p.SealedString:
+		p.Data = string(raw)
+	default:
+		p.Data = raw
+	}
+	return nil
+}
+
+// WithPersistFile 设置Shutdown时保存缓存表的文件，启动时可以通过LoadFile恢复
+func WithPersistFile(path string) Option {
+	return func(ct *CacheTable) {
+		ct.persistPath = path
+	}
+}
+
+// LoadFile 从文件中加载缓存表
+func (ct *CacheTable) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return ct.Load(f)
+}
+
+// JSON导出的格式：
+//
+//	{
+//	  "table": "users",
+//	  "items": [
+//	    {
+//	      "key": "user:1",
+//	      "value": {"name": "..."},
+//	      "lifeSpanMs": 60000,
+//	      "ttlMs": 42000,
+//	      "createTime": "2023-01-01T00:00:00Z",
+//	      "accessedTime": "2023-01-01T00:00:18Z",
+//	      "accessCount": 3
+//	    }
+//	  ]
+//	}
+//
+// lifeSpanMs为0表示永不过期，此时ttlMs为-1
+type jsonTable struct {
+	Table string     `json:"table"`
+	Items []jsonItem `json:"items"`
+}
+
+type jsonItem struct {
+	Key          interface{} `json:"key"`
+	Value        interface{} `json:"value"`
+	LifeSpanMs   int64       `json:"lifeSpanMs"`
+	TTLMs        int64       `json:"ttlMs"`
+	CreateTime   time.Time   `json:"createTime"`
+	AccessedTime time.Time   `json:"accessedTime"`
+	AccessCount  int64       `json:"accessCount"`
+}
+
+// MarshalJSON 将缓存表导出为JSON，格式见jsonTable的说明
+func (ct *CacheTable) MarshalJSON() ([]byte, error) {
+	n := ct.count()
+	t := jsonTable{Table: ct.Name(), Items: make([]jsonItem, 0, n)}
+	items := make([]*CacheItem, 0, n)
+	ct.rangeItems(func(_ interface{}, v *CacheItem) {
+		items = append(items, v)
+	})
+
+	for _, v := range items {
+		ttl := v.TTL()
+		if ttl > 0 {
+			ttl /= time.Millisecond
+		}
+		v.RLock()
+		t.Items = append(t.Items, jsonItem{
+			Key:          v.key,
+			Value:        v.dataLocked(),
+			LifeSpanMs:   int64(v.lifeSpan / time.Millisecond),
+			TTLMs:        int64(ttl),
+			CreateTime:   v.createTime,
+			AccessedTime: v.accessedTime,
+			AccessCount:  v.accessCountLocked(),
+		})
+		v.RUnlock()
+	}
+	return json.Marshal(t)
+}
+
+// UnmarshalJSON 将MarshalJSON导出的缓存项加入缓存表，已存在的键会被覆盖，table字段会被忽略，
+// 键和值会被解析为JSON的通用类型，例如数字为float64，对象为map[string]interface{}
+func (ct *CacheTable) UnmarshalJSON(b []byte) error {
+	var t jsonTable
+	if err := json.Unmarshal(b, &t); err != nil {
+		return err
+	}
+
+	now := ct.now()
+	items := make([]*CacheItem, 0, len(t.Items))
+	for _, j := range t.Items {
+		lifeSpan := time.Duration(j.LifeSpanMs) * time.Millisecond
+		if lifeSpan > 0 && j.TTLMs <= 0 {
+			continue
+		}
+		lifeSpan, ttl := ct.clampRemaining(lifeSpan, time.Duration(j.TTLMs)*time.Millisecond)
+		item := NewCacheItem(j.Key, j.Value, lifeSpan)
+		item.createTime = j.CreateTime
+		item.accessCount = j.AccessCount
+		item.accessedTime = j.AccessedTime
+		if lifeSpan > 0 {
+			// 以导出时的剩余存活时间继续倒计时
+			item.accessedTime = now.Add(ttl - lifeSpan)
+		}
+		items = append(items, item)
+	}
+	ct.addItems(items)
+	return nil
+}
@@ -0,0 +1,81 @@
+// Package prometheus 将cache2go缓存表的统计信息导出为Prometheus指标
+package prometheus
+
+import (
+	"cache2go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	itemsDesc = prometheus.NewDesc("cache2go_items", "缓存表中缓存项的个数", []string{"table"}, nil)
+	hitsDesc  = prometheus.NewDesc("cache2go_hits_total", "缓存命中次数", []string{"table"}, nil)
+	missDesc  = prometheus.NewDesc("cache2go_misses_total", "缓存未命中次数", []string{"table"}, nil)
+	ratioDesc = prometheus.NewDesc("cache2go_hit_ratio", "缓存命中率", []string{"table"}, nil)
+	loadDesc  = prometheus.NewDesc("cache2go_loads_total", "成功加载的次数", []string{"table"}, nil)
+	failDesc  = prometheus.NewDesc("cache2go_load_failures_total", "加载失败的次数", []string{"table"}, nil)
+	addDesc   = prometheus.NewDesc("cache2go_adds_total", "新增缓存项的次数", []string{"table"}, nil)
+	delDesc   = prometheus.NewDesc("cache2go_deletes_total", "手动删除缓存项的次数", []string{"table"}, nil)
+	evictDesc = prometheus.NewDesc("cache2go_evictions_total", "超出容量被淘汰的次数", []string{"table"}, nil)
+	expDesc   = prometheus.NewDesc("cache2go_expirations_total", "缓存项过期的次数", []string{"table"}, nil)
+	latDesc   = prometheus.NewDesc("cache2go_load_duration_seconds", "加载耗时", []string{"table"}, nil)
+)
+
+// Collector 实现了prometheus.Collector，导出一个或多个缓存表的指标
+type Collector struct {
+	// 返回需要导出的缓存表，在每次采集时调用
+	tables func() []*cache2go.CacheTable
+}
+
+// NewCollector 创建导出指定缓存表指标的Collector
+func NewCollector(tables ...*cache2go.CacheTable) *Collector {
+	return &Collector{tables: func() []*cache2go.CacheTable { return tables }}
+}
+
+// NewRegistryCollector 创建导出所有已创建缓存表指标的Collector，之后创建的缓存表也会被导出
+func NewRegistryCollector() *Collector {
+	return &Collector{tables: cache2go.RegisteredTables}
+}
+
+// Describe 实现prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- itemsDesc
+	ch <- hitsDesc
+	ch <- missDesc
+	ch <- ratioDesc
+	ch <- loadDesc
+	ch <- failDesc
+	ch <- addDesc
+	ch <- delDesc
+	ch <- evictDesc
+	ch <- expDesc
+	ch <- latDesc
+}
+
+// Collect 实现prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, t := range c.tables() {
+		name := t.Name()
+		s := t.Stats()
+		ch <- prometheus.MustNewConstMetric(itemsDesc, prometheus.GaugeValue, float64(t.Count()), name)
+		ch <- prometheus.MustNewConstMetric(hitsDesc, prometheus.CounterValue, float64(s.Hits), name)
+		ch <- prometheus.MustNewConstMetric(missDesc, prometheus.CounterValue, float64(s.Misses), name)
+		ch <- prometheus.MustNewConstMetric(ratioDesc, prometheus.GaugeValue, s.HitRatio(), name)
+		ch <- prometheus.MustNewConstMetric(loadDesc, prometheus.CounterValue, float64(s.Loads), name)
+		ch <- prometheus.MustNewConstMetric(failDesc, prometheus.CounterValue, float64(s.LoadFailures), name)
+		ch <- prometheus.MustNewConstMetric(addDesc, prometheus.CounterValue, float64(s.Adds), name)
+		ch <- prometheus.MustNewConstMetric(delDesc, prometheus.CounterValue, float64(s.Deletes), name)
+		ch <- prometheus.MustNewConstMetric(evictDesc, prometheus.CounterValue, float64(s.Evictions), name)
+		ch <- prometheus.MustNewConstMetric(expDesc, prometheus.CounterValue, float64(s.Expirations), name)
+
+		// Prometheus的直方图使用累计计数
+		h := t.LoadLatency()
+		buckets := make(map[float64]uint64, len(h.Bounds))
+		var cumulative uint64
+		for i, bound := range h.Bounds {
+			cumulative += uint64(h.Counts[i])
+			buckets[bound.Seconds()] = cumulative
+		}
+		ch <- prometheus.MustNewConstHistogram(latDesc, uint64(h.Count), h.Sum.Seconds(), buckets, name)
+	}
+}
@@ -0,0 +1,42 @@
+package prometheus
+
+import (
+	"cache2go"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	table := cache2go.Cache("testCollector")
+	table.Add("key", "value", 0)
+	table.Value("key")
+	table.Value("missing")
+
+	c := NewCollector(table)
+	if n := testutil.CollectAndCount(c); n != 11 {
+		t.Error("Unexpected number of metrics", n)
+	}
+	expected := `
+# HELP cache2go_hits_total 缓存命中次数
+# TYPE cache2go_hits_total counter
+cache2go_hits_total{table="testCollector"} 1
+# HELP cache2go_misses_total 缓存未命中次数
+# TYPE cache2go_misses_total counter
+cache2go_misses_total{table="testCollector"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "cache2go_hits_total", "cache2go_misses_total"); err != nil {
+		t.Error("Error exporting table metrics", err)
+	}
+
+	// the registry collector picks up every table
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(NewRegistryCollector()); err != nil {
+		t.Fatal("Error registering collector", err)
+	}
+	if _, err := reg.Gather(); err != nil {
+		t.Error("Error gathering metrics", err)
+	}
+}
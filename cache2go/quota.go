@@ -0,0 +1,144 @@
+package cache2go
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// QuotaPolicy 注册中心配额不足时的处理方式
+type QuotaPolicy int
+
+const (
+	// QuotaReject 拒绝创建新的缓存表
+	QuotaReject QuotaPolicy = iota
+	// QuotaEvictLRU 关闭并移除最久未被使用的缓存表，直到配额足够
+	QuotaEvictLRU
+)
+
+// RegistryQuota 注册中心的配额，适用于为每个租户创建一个缓存表的场景，字段为0表示不限制
+type RegistryQuota struct {
+	// 缓存表的最大个数
+	MaxTables int
+	// 每个缓存表缓存项的最大个数，创建缓存表时作为WithMaxItems的上限
+	MaxItemsPerTable int
+	// 所有缓存表MemoryUsage之和的上限，只在创建缓存表和调用EnforceRegistryQuota时检查
+	MaxMemory int64
+	// 配额不足时的处理方式
+	Policy QuotaPolicy
+}
+
+var quota atomic.Value
+
+// SetRegistryQuota 设置注册中心的配额，只影响之后创建的缓存表以及之后的检查，已存在的缓存表不会被立即移除
+func SetRegistryQuota(q RegistryQuota) {
+	quota.Store(q)
+}
+
+func registryQuota() RegistryQuota {
+	q, _ := quota.Load().(RegistryQuota)
+	return q
+}
+
+// TryCache 与Cache相同，配额不足并且策略为QuotaReject时返回ErrTooManyTables或ErrMemoryQuota，
+// 策略为QuotaEvictLRU时先关闭最久未被使用的缓存表再创建
+func TryCache(table string, opts ...Option) (*CacheTable, error) {
+	return cacheTable(table, opts, true)
+}
+
+// 获取或创建缓存表，reject为false时即使策略为QuotaReject也会创建
+func cacheTable(table string, opts []Option, reject bool) (*CacheTable, error) {
+	for {
+		if t, ok := lookupTable(table); ok {
+			t.markUsed()
+			return t, nil
+		}
+		victim, err := quotaVictim(len(RegisteredTables()) + 1)
+		if err != nil && reject {
+			return nil, err
+		}
+		if victim != nil {
+			victim.Close()
+			continue
+		}
+
+		mutex.Lock()
+		if t, ok := cache[table]; ok {
+			mutex.Unlock()
+			t.markUsed()
+			return t, nil
+		}
+		// 检查之后其他协程可能已经创建了缓存表，重新检查个数
+		if q := registryQuota(); reject && q.MaxTables > 0 && len(cache) >= q.MaxTables {
+			mutex.Unlock()
+			continue
+		}
+		t := newTable(table, opts)
+		cache[table] = t
+		mutex.Unlock()
+		if err != nil {
+			t.log(LevelWarn, "缓存表配额不足", "event", "quota", "error", err)
+		}
+		if t.ctx != nil {
+			// 即使没有需要定时清理的缓存项，也要在ctx结束时关闭缓存表
+			t.Lock()
+			t.startJanitor()
+			t.Unlock()
+		}
+		return t, nil
+	}
+}
+
+// EnforceRegistryQuota 检查所有缓存表是否超出配额，策略为QuotaEvictLRU时关闭最久未被使用的缓存表直到满足配额，
+// 返回关闭的个数。缓存项占用的内存会随写入增长，可以定期调用
+func EnforceRegistryQuota() int {
+	n := 0
+	for {
+		victim, err := quotaVictim(len(RegisteredTables()))
+		if err != nil || victim == nil {
+			return n
+		}
+		victim.Close()
+		n++
+	}
+}
+
+// 判断注册中心有tables个缓存表时是否超出配额，超出时根据策略返回需要关闭的缓存表或错误
+func quotaVictim(tables int) (*CacheTable, error) {
+	q := registryQuota()
+	var err error
+	if q.MaxTables > 0 && tables > q.MaxTables {
+		err = ErrTooManyTables
+	} else if q.MaxMemory > 0 && registryMemory() > q.MaxMemory {
+		err = ErrMemoryQuota
+	}
+	if err == nil {
+		return nil, nil
+	}
+	if q.Policy != QuotaEvictLRU {
+		return nil, err
+	}
+	var victim *CacheTable
+	for _, t := range RegisteredTables() {
+		if victim == nil || t.lastUsed.Load() < victim.lastUsed.Load() {
+			victim = t
+		}
+	}
+	if victim == nil {
+		return nil, err
+	}
+	return victim, nil
+}
+
+// 所有已注册缓存表占用的内存
+func registryMemory() int64 {
+	var total int64
+	for _, t := range RegisteredTables() {
+		total += t.MemoryUsage()
+	}
+	return total
+}
+
+// 记录缓存表最近一次被使用的时间，用于QuotaEvictLRU选择需要关闭的缓存表
+func (ct *CacheTable) markUsed() {
+	ct.lastUsed.Store(time.Now().UnixNano())
+}
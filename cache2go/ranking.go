@@ -0,0 +1,87 @@
+package cache2go
+
+import (
+	"container/heap"
+	"time"
+)
+
+// LeastAccessed 返回访问次数最少的缓存项，传入限制个数，按访问次数从低到高排列，
+// 可以用于找出适合手动淘汰或缩短存活时间的缓存项
+func (ct *CacheTable) LeastAccessed(count int64) []*CacheItem {
+	return ct.topItems(count, func(item *CacheItem) int64 {
+		return -item.AccessedCount()
+	})
+}
+
+// LeastRecentlyAccessed 返回最久未被访问的缓存项，传入限制个数，按最后访问时间从早到晚排列
+func (ct *CacheTable) LeastRecentlyAccessed(count int64) []*CacheItem {
+	return ct.topItems(count, func(item *CacheItem) int64 {
+		return -item.AccessedTime().UnixNano()
+	})
+}
+
+// OldestItems 返回创建时间最早的缓存项，传入限制个数，按创建时间从早到晚排列
+func (ct *CacheTable) OldestItems(count int64) []*CacheItem {
+	return ct.topItems(count, func(item *CacheItem) int64 {
+		return -item.CreateTime().UnixNano()
+	})
+}
+
+// ItemsOlderThan 返回创建时间距今超过d的所有缓存项，不保证顺序，
+// 可以配合DeleteAll按照存在时长进行清理
+func (ct *CacheTable) ItemsOlderThan(d time.Duration) []*CacheItem {
+	deadline := ct.now().Add(-d)
+	var items []*CacheItem
+	ct.rangeItems(func(_ interface{}, v *CacheItem) {
+		if v.CreateTime().Before(deadline) {
+			items = append(items, v)
+		}
+	})
+	return items
+}
+
+// 选出score最大的count个缓存项，按score从高到低排列，
+// 遍历时维护大小为count的最小堆，复杂度为O(n log count)
+func (ct *CacheTable) topItems(count int64, score func(*CacheItem) int64) []*CacheItem {
+	if count <= 0 {
+		return nil
+	}
+
+	h := make(rankHeap, 0)
+	ct.rangeItems(func(_ interface{}, v *CacheItem) {
+		s := score(v)
+		if int64(len(h)) < count {
+			heap.Push(&h, rankedItem{v, s})
+		} else if s > h[0].score {
+			// 替换堆中score最小的缓存项
+			h[0] = rankedItem{v, s}
+			heap.Fix(&h, 0)
+		}
+	})
+
+	r := make([]*CacheItem, len(h))
+	for i := len(r) - 1; i >= 0; i-- {
+		r[i] = heap.Pop(&h).(rankedItem).item
+	}
+	return r
+}
+
+// 记录选择时的score，避免堆调整期间访问信息发生变化
+type rankedItem struct {
+	item  *CacheItem
+	score int64
+}
+
+// 按score排列的最小堆，实现了container/heap包下的interface
+type rankHeap []rankedItem
+
+func (h rankHeap) Len() int            { return len(h) }
+func (h rankHeap) Less(i, j int) bool  { return h[i].score < h[j].score }
+func (h rankHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *rankHeap) Push(x interface{}) { *h = append(*h, x.(rankedItem)) }
+func (h *rankHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,79 @@
+package cache2go
+
+import "time"
+
+// 滑动窗口被划分的桶数，窗口越大每个桶覆盖的时间越长
+const rateBuckets = 60
+
+// WithAccessRateWindow 开启缓存项访问频率的统计，记录最近window时间内每个缓存项的访问次数，
+// 窗口被划分为60个桶，统计的精度为window/60，开启后可以使用MostAccessedSince和AccessCountSince
+func WithAccessRateWindow(window time.Duration) Option {
+	return func(ct *CacheTable) {
+		ct.rateResolution = window / rateBuckets
+		if ct.rateResolution <= 0 {
+			ct.rateResolution = 1
+		}
+	}
+}
+
+// MostAccessedSince 返回最近window时间内访问次数最多的缓存项，传入限制个数，按访问次数从高到低排列，
+// window超过WithAccessRateWindow设置的窗口时按窗口计算，未开启访问频率统计时返回nil
+func (ct *CacheTable) MostAccessedSince(window time.Duration, count int64) []*CacheItem {
+	if ct.rateResolution == 0 {
+		return nil
+	}
+	now := ct.now()
+	return ct.topItems(count, func(item *CacheItem) int64 {
+		item.RLock()
+		defer item.RUnlock()
+		return item.accessesSinceLocked(now, window)
+	})
+}
+
+// AccessCountSince 获取最近window时间内的访问次数，需要缓存表开启访问频率统计，否则返回0
+func (ci *CacheItem) AccessCountSince(window time.Duration) int64 {
+	ci.RLock()
+	defer ci.RUnlock()
+	return ci.accessesSinceLocked(ci.now(), window)
+}
+
+// 在对应的桶中记录一次访问，调用者需要持有缓存项的写锁
+func (ci *CacheItem) recordAccessLocked(now time.Time) {
+	if ci.table == nil || ci.table.rateResolution == 0 {
+		return
+	}
+	epoch := now.UnixNano() / int64(ci.table.rateResolution)
+	if ci.rateHits == nil {
+		ci.rateHits = make([]int64, rateBuckets)
+		ci.rateEpoch = epoch
+	}
+	if epoch > ci.rateEpoch {
+		// 清空上次访问之后经过的桶
+		for e := ci.rateEpoch + 1; e <= epoch && e <= ci.rateEpoch+rateBuckets; e++ {
+			ci.rateHits[e%rateBuckets] = 0
+		}
+		ci.rateEpoch = epoch
+	}
+	ci.rateHits[ci.rateEpoch%rateBuckets]++
+}
+
+// 统计最近window时间内的访问次数，调用者需要持有缓存项的锁
+func (ci *CacheItem) accessesSinceLocked(now time.Time, window time.Duration) int64 {
+	if ci.rateHits == nil {
+		return 0
+	}
+	res := ci.table.rateResolution
+	epoch := now.UnixNano() / int64(res)
+	n := int64((window + res - 1) / res)
+	if n > rateBuckets {
+		n = rateBuckets
+	}
+	var sum int64
+	for e := epoch - n + 1; e <= epoch; e++ {
+		// 只有最近一次访问之前rateBuckets个桶内的数据是有效的
+		if e <= ci.rateEpoch && e > ci.rateEpoch-rateBuckets {
+			sum += ci.rateHits[e%rateBuckets]
+		}
+	}
+	return sum
+}
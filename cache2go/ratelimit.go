@@ -0,0 +1,117 @@
+package cache2go
+
+import (
+	"sync"
+	"time"
+)
+
+// 按键限流时最多保留的令牌桶个数，超过后清理已经装满的令牌桶，仍然超过时删除最久未被访问的令牌桶
+const maxRateLimitBuckets = 10000
+
+// WithRateLimit 限制Value的访问频率，使用令牌桶算法，每秒产生rate个令牌，最多积攒burst个令牌，
+// perKey为true时每个键使用独立的令牌桶，否则整个缓存表共用一个令牌桶；
+// 令牌不足时Value返回ErrRateLimited，不会访问缓存项也不会调用加载函数。rate不大于0时不限流
+func WithRateLimit(rate float64, burst int, perKey bool) Option {
+	return func(ct *CacheTable) {
+		if rate <= 0 {
+			ct.limiter = nil
+			return
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		ct.limiter = &rateLimiter{
+			rate:    rate,
+			burst:   float64(burst),
+			perKey:  perKey,
+			buckets: make(map[interface{}]*tokenBucket),
+		}
+	}
+}
+
+// 令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// 从令牌桶中取出一个令牌，返回是否成功
+func (b *tokenBucket) take(now time.Time, rate, burst float64) bool {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// 限流器，持有自己的锁，不会再获取其他锁
+type rateLimiter struct {
+	sync.Mutex
+	rate    float64
+	burst   float64
+	perKey  bool
+	table   tokenBucket
+	buckets map[interface{}]*tokenBucket
+}
+
+func (l *rateLimiter) allow(key interface{}, now time.Time) bool {
+	l.Lock()
+	defer l.Unlock()
+	if !l.perKey {
+		if l.table.last.IsZero() {
+			l.table = tokenBucket{tokens: l.burst, last: now}
+		}
+		return l.table.take(now, l.rate, l.burst)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.prune(now)
+		}
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.evictOldest()
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	return b.take(now, l.rate, l.burst)
+}
+
+// 删除已经重新装满的令牌桶，这些键再次访问时新建的令牌桶与原来的状态相同
+func (l *rateLimiter) prune(now time.Time) {
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// 删除最久未被访问的令牌桶，避免大量不同的键在令牌装满之前不断访问时令牌桶无限增长
+func (l *rateLimiter) evictOldest() {
+	var oldest interface{}
+	var oldestLast time.Time
+	found := false
+	for k, b := range l.buckets {
+		if !found || b.last.Before(oldestLast) {
+			oldest, oldestLast, found = k, b.last, true
+		}
+	}
+	if found {
+		delete(l.buckets, oldest)
+	}
+}
+
+// 判断是否允许访问键，未开启限流时总是允许
+func (ct *CacheTable) allow(key interface{}) bool {
+	if ct.limiter == nil {
+		return true
+	}
+	return ct.limiter.allow(key, ct.now())
+}
@@ -0,0 +1,48 @@
+package cache2go
+
+import "time"
+
+// 缓存表的配置，修改时在configMu内复制一份再原子替换，读取时不需要加锁，
+// 使命中缓存项的读取不会因为超时检查、Flush等持有缓存表写锁的操作而阻塞，
+// 设置回调函数、loadData和日志也不会与缓存项的读写竞争
+type readConfig struct {
+	loadData func(key interface{}, args ...interface{}) *CacheItem
+	tracer   Tracer
+	metrics  MetricsHook
+	closed   bool
+	// 增加缓存项、删除缓存项以及带有删除原因的回调函数
+	addedItem         callbackList[func(item *CacheItem)]
+	deletedItem       callbackList[func(item *CacheItem)]
+	deletedItemReason callbackList[func(item *CacheItem, reason DeleteReason)]
+	// 日志
+	logger Logger
+	// 默认存活时间，在传入DefaultLifeSpan时使用
+	defaultLifeSpan time.Duration
+	// 存活时间的上限，0表示不限制
+	maxLifeSpan time.Duration
+	// 存活时间的随机抖动比例，范围为[0, 1]
+	jitter float64
+}
+
+var emptyReadConfig readConfig
+
+// 获取当前的配置，返回的值不能修改
+func (ct *CacheTable) readConfig() *readConfig {
+	if c := ct.rcu.Load(); c != nil {
+		return c
+	}
+	return &emptyReadConfig
+}
+
+// 复制当前的配置，由f修改之后原子替换，configMu只保护配置的修改，可以在持有缓存表的锁时调用
+func (ct *CacheTable) updateReadConfig(f func(c *readConfig)) {
+	ct.configMu.Lock()
+	defer ct.configMu.Unlock()
+	c := *ct.readConfig()
+	f(&c)
+	ct.rcu.Store(&c)
+}
+
+func (ct *CacheTable) isClosed() bool {
+	return ct.readConfig().closed
+}
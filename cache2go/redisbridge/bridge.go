@@ -0,0 +1,173 @@
+// Package redisbridge 通过redis的发布订阅在多个进程之间同步缓存表的失效，
+// 订阅频道中的失效消息并对同名的缓存表执行Delete或Flush，也可以把本地的删除发布出去，
+// 只依赖标准库，自行实现了所需的RESP协议
+package redisbridge
+
+import (
+	"bufio"
+	"cache2go/invalidation"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Message 在频道中传递的失效消息
+type Message = invalidation.Message
+
+// Options 桥接的配置
+type Options struct {
+	// redis的地址
+	Addr string
+	// 密码，为空时不进行认证
+	Password string
+	// 发布订阅使用的频道
+	Channel string
+	// 需要同步的缓存表，为空时处理所有已注册的缓存表。
+	// 发布本地删除时只会订阅Run开始时已经存在的缓存表
+	Tables []string
+	// 是否把本地通过Delete删除的键发布出去，过期和淘汰不会发布
+	Publish bool
+	// 实例的标识，为空时随机生成
+	Origin string
+	// 连接断开后重连的间隔，默认为1秒
+	ReconnectDelay time.Duration
+}
+
+// Bridge redis失效消息与缓存表之间的桥接
+type Bridge struct {
+	opts  Options
+	relay *invalidation.Relay
+
+	// 发布使用的连接，订阅状态的连接不能再执行PUBLISH
+	mu   sync.Mutex
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+// New 创建桥接，调用Run之后开始工作
+func New(opts Options) *Bridge {
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = time.Second
+	}
+	return &Bridge{opts: opts, relay: invalidation.NewRelay(opts.Origin, opts.Tables)}
+}
+
+// Origin 获取实例的标识
+func (b *Bridge) Origin() string {
+	return b.relay.Origin()
+}
+
+// Run 订阅频道并处理失效消息，连接断开时自动重连，直到ctx取消后返回ctx的错误
+func (b *Bridge) Run(ctx context.Context) error {
+	if b.opts.Publish {
+		b.relay.Watch(ctx, b.publish)
+	}
+	defer b.closePublisher()
+	for {
+		b.subscribe(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(b.opts.ReconnectDelay):
+		}
+	}
+}
+
+// PublishDelete 通知其他实例删除缓存表中的键
+func (b *Bridge) PublishDelete(table, key string) error {
+	return b.publish(b.relay.Delete(table, key))
+}
+
+// PublishFlush 通知其他实例清空缓存表
+func (b *Bridge) PublishFlush(table string) error {
+	return b.publish(b.relay.Flush(table))
+}
+
+func (b *Bridge) dial(ctx context.Context) (net.Conn, *bufio.ReadWriter, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", b.opts.Addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	if b.opts.Password != "" {
+		if err := writeCommand(rw.Writer, "AUTH", b.opts.Password); err == nil {
+			_, err = readReply(rw.Reader)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, rw, nil
+}
+
+// 建立订阅连接并处理消息，直到连接出错或ctx取消
+func (b *Bridge) subscribe(ctx context.Context) error {
+	conn, rw, err := b.dial(ctx)
+	if err != nil {
+		return err
+	}
+	// ctx取消时关闭连接，使阻塞的读取返回
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	if err := writeCommand(rw.Writer, "SUBSCRIBE", b.opts.Channel); err != nil {
+		return err
+	}
+	for {
+		reply, err := readReply(rw.Reader)
+		if err != nil {
+			return err
+		}
+		// 推送的消息格式为 ["message", channel, payload]
+		arr, ok := reply.([]interface{})
+		if !ok || len(arr) != 3 || arr[0] != "message" {
+			continue
+		}
+		if payload, ok := arr[2].(string); ok {
+			b.relay.Apply([]byte(payload))
+		}
+	}
+}
+
+func (b *Bridge) publish(payload []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn == nil {
+		conn, rw, err := b.dial(context.Background())
+		if err != nil {
+			return err
+		}
+		b.conn, b.rw = conn, rw
+	}
+	err := writeCommand(b.rw.Writer, "PUBLISH", b.opts.Channel, string(payload))
+	if err == nil {
+		_, err = readReply(b.rw.Reader)
+	}
+	var re redisError
+	if err != nil && !errors.As(err, &re) {
+		// 连接出错，下次发布时重新连接
+		b.conn.Close()
+		b.conn, b.rw = nil, nil
+	}
+	return err
+}
+
+func (b *Bridge) closePublisher() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn != nil {
+		b.conn.Close()
+		b.conn, b.rw = nil, nil
+	}
+}
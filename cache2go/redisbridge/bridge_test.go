@@ -0,0 +1,154 @@
+package redisbridge
+
+import (
+	"bufio"
+	"cache2go"
+	"cache2go/invalidation"
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis implements just enough of AUTH, SUBSCRIBE and PUBLISH for the bridge.
+type fakeRedis struct {
+	l          net.Listener
+	mu         sync.Mutex
+	subs       map[string][]*bufio.Writer
+	subscribed chan string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{l: l, subs: make(map[string][]*bufio.Writer), subscribed: make(chan string, 8)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		args, _ := reply.([]interface{})
+		if len(args) == 0 {
+			return
+		}
+		s.mu.Lock()
+		switch args[0] {
+		case "AUTH":
+			w.WriteString("+OK\r\n")
+		case "SUBSCRIBE":
+			ch := args[1].(string)
+			s.subs[ch] = append(s.subs[ch], w)
+			w.WriteString("*3\r\n$9\r\nsubscribe\r\n")
+			writeBulk(w, ch)
+			w.WriteString(":1\r\n")
+			s.subscribed <- ch
+		case "PUBLISH":
+			ch, payload := args[1].(string), args[2].(string)
+			for _, sub := range s.subs[ch] {
+				sub.WriteString("*3\r\n$7\r\nmessage\r\n")
+				writeBulk(sub, ch)
+				writeBulk(sub, payload)
+				sub.Flush()
+			}
+			w.WriteString(":1\r\n")
+		}
+		w.Flush()
+		s.mu.Unlock()
+	}
+}
+
+func writeBulk(w *bufio.Writer, s string) {
+	w.WriteString("$")
+	w.WriteString(strconv.Itoa(len(s)))
+	w.WriteString("\r\n" + s + "\r\n")
+}
+
+func TestBridge(t *testing.T) {
+	srv := newFakeRedis(t)
+	defer srv.l.Close()
+	table := cache2go.Cache("testRedisBridge")
+	table.Add("remote", 1, 0)
+	table.Add("local", 2, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := New(Options{Addr: srv.l.Addr().String(), Password: "secret", Channel: "inval", Tables: []string{"testRedisBridge"}, Publish: true})
+	go b.Run(ctx)
+	<-srv.subscribed
+
+	// a second subscriber observes what the bridge publishes
+	conn, err := net.Dial("tcp", srv.l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	writeCommand(w, "SUBSCRIBE", "inval")
+	readReply(r)
+	<-srv.subscribed
+	next := func() Message {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		reply, err := readReply(r)
+		if err != nil {
+			t.Fatal("Error reading published message", err)
+		}
+		var m Message
+		json.Unmarshal([]byte(reply.([]interface{})[2].(string)), &m)
+		return m
+	}
+
+	other := New(Options{Addr: srv.l.Addr().String(), Channel: "inval"})
+	if err := other.PublishDelete("testRedisBridge", "remote"); err != nil {
+		t.Fatal(err)
+	}
+	if m := next(); m.Origin != other.Origin() || m.Key != "remote" {
+		t.Error("Unexpected message", m)
+	}
+	deadline := time.Now().Add(time.Second)
+	for table.Exists("remote") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if table.Exists("remote") {
+		t.Error("Remote invalidation should delete the key")
+	}
+
+	// the remote delete must not be published again, so the next message is the local delete
+	table.Delete("local")
+	if m := next(); m.Origin != b.Origin() || m.Op != invalidation.OpDelete || m.Key != "local" || m.Table != "testRedisBridge" {
+		t.Error("Local delete should be published", m)
+	}
+
+	table.Add("flushed", 3, 0)
+	other.PublishFlush("testRedisBridge")
+	next()
+	deadline = time.Now().Add(time.Second)
+	for table.Count() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if table.Count() != 0 {
+		t.Error("Remote flush should clear the table")
+	}
+	other.closePublisher()
+}
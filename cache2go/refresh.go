@@ -0,0 +1,95 @@
+package cache2go
+
+import (
+	"context"
+	"time"
+)
+
+// WithRefreshAhead 开启提前刷新，当缓存项的剩余存活时间不超过window时被访问，
+// 会在后台协程中调用loadData重新加载数据，替换缓存项的数据并重置存活时间，调用者直接得到当前的数据，
+// 同一个缓存项同时只会进行一次刷新，加载失败时保留原有的数据
+func WithRefreshAhead(window time.Duration) Option {
+	return func(ct *CacheTable) {
+		ct.refreshAhead = window
+	}
+}
+
+// 判断缓存项是否进入提前刷新的窗口，需要在KeepAlive之前调用
+func (ct *CacheTable) shouldRefresh(item *CacheItem) bool {
+	if ct.refreshAhead <= 0 {
+		return false
+	}
+	ttl := item.TTL()
+	return ttl >= 0 && ttl <= ct.refreshAhead
+}
+
+// 在后台调用loadData刷新缓存项
+func (ct *CacheTable) refresh(item *CacheItem, loadData func(interface{}, ...interface{}) *CacheItem, args ...interface{}) {
+	if !item.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+	key := item.Key()
+	go func() {
+		defer item.refreshing.Store(false)
+
+		loaded, _ := ct.callLoader(context.Background(), key, loadData, args...)
+		if loaded == nil {
+			ct.stats.add(&ct.stats.loadFailures, 1)
+			ct.log(LevelWarn, "提前刷新缓存项失败", "event", "refresh", "key", key)
+			return
+		}
+		ct.stats.add(&ct.stats.loads, 1)
+		// 刷新期间缓存项可能已被删除或替换
+		if cur, ok := ct.lookup(key); !ok || cur != item {
+			return
+		}
+
+		// 加密失败时保留原来的数据
+		encoded, err := ct.encode(key, loaded.data)
+		if err != nil {
+			return
+		}
+		item.Lock()
+		old := item.dataLocked()
+		item.data = encoded
+		item.version = ct.nextVersion()
+		item.Unlock()
+		ct.reindex(key, item)
+		if ct.watched() {
+			ct.emit(Event{Type: WatchUpdate, Key: key, OldData: old, NewData: loaded.data, Time: ct.now()})
+		}
+		item.Touch(ct.effectiveLifeSpan(loaded.lifeSpan))
+		if ct.logEnabled(LevelDebug) {
+			ct.log(LevelDebug, "提前刷新缓存项", "event", "refresh", "key", key)
+		}
+	}()
+}
+
+// WithStaleWhileRevalidate 开启过期数据的后台刷新，设置了loadData时缓存项过期之后maxStale时间内不会被删除，
+// 此时Value直接返回过期的数据并在后台调用loadData刷新；超过maxStale之后缓存项会被删除，调用者同步等待加载
+func WithStaleWhileRevalidate(maxStale time.Duration) Option {
+	return func(ct *CacheTable) {
+		ct.staleWhileRevalidate = maxStale
+	}
+}
+
+// 过期之后允许保留的时长，只有设置了loadData时才生效，调用者需要持有缓存表的锁
+func (ct *CacheTable) staleGrace() time.Duration {
+	if ct.readConfig().loadData == nil {
+		return 0
+	}
+	return ct.staleWhileRevalidate
+}
+
+// 获取缓存项已经过期的时长，未过期、永不过期或被固定的缓存项返回0
+func (ci *CacheItem) expiredFor(now time.Time) time.Duration {
+	ci.RLock()
+	defer ci.RUnlock()
+	if ci.lifeSpan == 0 || ci.pinned {
+		return 0
+	}
+	if over := now.Sub(ci.expireBaseLocked()) - ci.lifeSpan; over > 0 {
+		return over
+	}
+	return 0
+}
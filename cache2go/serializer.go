@@ -0,0 +1,97 @@
+package cache2go
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"reflect"
+)
+
+// Serializer 缓存项数据的序列化方式，通过WithSerializer设置后Save和Load使用它保存数据，
+// 不再依赖gob对interface{}的编码，自定义类型不需要调用gob.Register
+type Serializer interface {
+	Encode(data interface{}) ([]byte, error)
+	Decode(b []byte) (interface{}, error)
+}
+
+// WithSerializer 设置持久化时数据使用的序列化方式，键仍然使用gob保存
+func WithSerializer(s Serializer) Option {
+	return func(ct *CacheTable) {
+		ct.serializer = s
+	}
+}
+
+// GobSerializer 使用gob序列化类型为T的数据，T为具体类型时不需要注册
+func GobSerializer[T any]() Serializer {
+	return gobSerializer[T]{}
+}
+
+type gobSerializer[T any] struct{}
+
+func (gobSerializer[T]) Encode(data interface{}) ([]byte, error) {
+	v, ok := data.(T)
+	if !ok {
+		return nil, &TypeError{Want: reflect.TypeOf((*T)(nil)).Elem(), Got: reflect.TypeOf(data)}
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobSerializer[T]) Decode(b []byte) (interface{}, error) {
+	var v T
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// JSONSerializer 使用JSON序列化数据，解析时得到类型为T的值，T为interface{}时得到JSON的通用类型
+func JSONSerializer[T any]() Serializer {
+	return jsonSerializer[T]{}
+}
+
+type jsonSerializer[T any] struct{}
+
+func (jsonSerializer[T]) Encode(data interface{}) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+func (jsonSerializer[T]) Decode(b []byte) (interface{}, error) {
+	var v T
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// MsgpackSerializer 使用MessagePack序列化数据，结构体按照导出字段的名字编码为map，
+// 解析时得到通用类型：整数为int64或uint64，浮点数为float64，数组为[]interface{}，
+// 键都是字符串的map为map[string]interface{}，其余map为map[interface{}]interface{}
+func MsgpackSerializer() Serializer {
+	return msgpackSerializer{}
+}
+
+type msgpackSerializer struct{}
+
+func (msgpackSerializer) Encode(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := msgpackEncode(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackSerializer) Decode(b []byte) (interface{}, error) {
+	d := &msgpackDecoder{b: b}
+	v, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(b) {
+		return nil, errMsgpackTrailing
+	}
+	return v, nil
+}
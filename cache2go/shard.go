@@ -0,0 +1,231 @@
+package cache2go
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultShards 缓存表默认的分片个数
+const DefaultShards = 16
+
+// 缓存表的一个分片，每个分片使用独立的锁，不同分片上的读写不会互相阻塞。
+// items只能在持有分片的锁时访问，修改必须通过set、remove和reset进行，同时更新无锁的只读索引read，
+// lookup只读取read，命中时不需要获取任何锁
+type shard struct {
+	sync.RWMutex
+	items map[interface{}]*CacheItem
+	read  atomic.Pointer[sync.Map]
+}
+
+func newShards(n int) []*shard {
+	if n < 1 {
+		n = 1
+	}
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{}
+		shards[i].reset()
+	}
+	return shards
+}
+
+// 写入缓存项，调用者需要持有分片的写锁
+func (sh *shard) set(key interface{}, item *CacheItem) {
+	sh.items[key] = item
+	sh.read.Load().Store(key, item)
+}
+
+// 删除缓存项，调用者需要持有分片的写锁
+func (sh *shard) remove(key interface{}) {
+	delete(sh.items, key)
+	sh.read.Load().Delete(key)
+}
+
+// 清空分片，调用者需要持有分片的写锁
+func (sh *shard) reset() {
+	sh.items = make(map[interface{}]*CacheItem)
+	sh.read.Store(new(sync.Map))
+}
+
+// WithShards 设置缓存表的分片个数，并发写入较多时增加分片可以减少锁竞争，小于1时按1处理
+func WithShards(n int) Option {
+	return func(ct *CacheTable) {
+		ct.shards = newShards(n)
+	}
+}
+
+// 获取键所在的分片
+func (ct *CacheTable) shardFor(key interface{}) *shard {
+	return ct.shards[ct.shardIndex(key)]
+}
+
+// 获取键所在分片的下标，需要同时锁住多个分片时按下标顺序加锁
+func (ct *CacheTable) shardIndex(key interface{}) int {
+	if len(ct.shards) == 1 {
+		return 0
+	}
+	return int(hashKey(key) % uint64(len(ct.shards)))
+}
+
+// 通过分片的只读索引查找缓存项，不需要获取锁，与并发的写入相比可能读到稍旧的结果
+func (ct *CacheTable) lookup(key interface{}) (*CacheItem, bool) {
+	v, ok := ct.shardFor(key).read.Load().Load(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(*CacheItem), true
+}
+
+// 依次获取每个分片的读锁遍历其中的缓存项
+func (ct *CacheTable) rangeItems(f func(key interface{}, item *CacheItem)) {
+	ct.rangeItemsUntil(func(k interface{}, v *CacheItem) bool {
+		f(k, v)
+		return true
+	})
+}
+
+// 与rangeItems相同，f返回false时停止遍历
+func (ct *CacheTable) rangeItemsUntil(f func(key interface{}, item *CacheItem) bool) {
+	for _, sh := range ct.shards {
+		sh.RLock()
+		for k, v := range sh.items {
+			if !f(k, v) {
+				sh.RUnlock()
+				return
+			}
+		}
+		sh.RUnlock()
+	}
+}
+
+// 获取所有分片中缓存项的个数
+func (ct *CacheTable) count() int {
+	n := 0
+	for _, sh := range ct.shards {
+		sh.RLock()
+		n += len(sh.items)
+		sh.RUnlock()
+	}
+	return n
+}
+
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+// 计算键的哈希值，相等的键必须得到相同的哈希值，常见类型直接计算，其余类型使用反射计算
+func hashKey(key interface{}) uint64 {
+	switch k := key.(type) {
+	case string:
+		return hashString(k)
+	case int:
+		return hashUint64(uint64(k))
+	case int8:
+		return hashUint64(uint64(k))
+	case int16:
+		return hashUint64(uint64(k))
+	case int32:
+		return hashUint64(uint64(k))
+	case int64:
+		return hashUint64(uint64(k))
+	case uint:
+		return hashUint64(uint64(k))
+	case uint8:
+		return hashUint64(uint64(k))
+	case uint16:
+		return hashUint64(uint64(k))
+	case uint32:
+		return hashUint64(uint64(k))
+	case uint64:
+		return hashUint64(k)
+	case uintptr:
+		return hashUint64(uint64(k))
+	case float32:
+		return hashFloat(float64(k))
+	case float64:
+		return hashFloat(k)
+	case bool:
+		if k {
+			return 1
+		}
+		return 0
+	}
+	return hashValue(reflect.ValueOf(key))
+}
+
+// 使用反射计算其余类型的哈希值，与==的语义保持一致：指针、chan按地址计算，数组和结构体组合每个元素的哈希值，
+// 不能作为map键的类型返回0。不能使用格式化之后的内容，否则String方法依赖的状态改变后键会落到其他分片
+func hashValue(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return 0
+	case reflect.String:
+		return hashString(v.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return hashUint64(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return hashUint64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return hashFloat(v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return combineHash(hashFloat(real(c)), hashFloat(imag(c)))
+	case reflect.Bool:
+		if v.Bool() {
+			return 1
+		}
+		return 0
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		return hashUint64(uint64(v.Pointer()))
+	case reflect.Interface:
+		return hashValue(v.Elem())
+	case reflect.Array:
+		h := uint64(fnvOffset)
+		for i := 0; i < v.Len(); i++ {
+			h = combineHash(h, hashValue(v.Index(i)))
+		}
+		return h
+	case reflect.Struct:
+		h := uint64(fnvOffset)
+		for i := 0; i < v.NumField(); i++ {
+			h = combineHash(h, hashValue(v.Field(i)))
+		}
+		return h
+	}
+	return 0
+}
+
+func combineHash(h, x uint64) uint64 {
+	return (h ^ x) * fnvPrime
+}
+
+// 使用FNV-1a计算字符串的哈希值，避免转换为[]byte产生内存分配
+func hashString(s string) uint64 {
+	h := uint64(fnvOffset)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime
+	}
+	return h
+}
+
+func hashUint64(x uint64) uint64 {
+	h := uint64(fnvOffset)
+	for i := 0; i < 8; i++ {
+		h ^= x & 0xff
+		h *= fnvPrime
+		x >>= 8
+	}
+	return h
+}
+
+func hashFloat(f float64) uint64 {
+	// +0和-0作为map的键是相等的
+	if f == 0 {
+		return 0
+	}
+	return hashUint64(math.Float64bits(f))
+}
@@ -0,0 +1,83 @@
+package cache2go
+
+import "time"
+
+// SnapshotItem 快照中的缓存项，保存创建快照时的数据和元信息
+type SnapshotItem struct {
+	Key          interface{}
+	Data         interface{}
+	LifeSpan     time.Duration
+	CreateTime   time.Time
+	AccessedTime time.Time
+	AccessCount  int64
+	Version      uint64
+	Tags         []string
+}
+
+// Snapshot 缓存表在某一时刻的只读视图，创建之后不受缓存表修改的影响，
+// 数据只做浅拷贝，指针类型的数据仍然与缓存表共享
+type Snapshot struct {
+	time  time.Time
+	items map[interface{}]SnapshotItem
+}
+
+// Snapshot 逐个分片复制缓存项创建快照，复制一个分片时只持有该分片的读锁，不会在处理快照期间阻塞写入，
+// 因此不同分片的复制时间可能略有不同
+func (ct *CacheTable) Snapshot() *Snapshot {
+	s := &Snapshot{time: ct.now(), items: make(map[interface{}]SnapshotItem, ct.count())}
+	ct.rangeItems(func(k interface{}, v *CacheItem) {
+		v.RLock()
+		s.items[k] = v.snapshotLocked(k)
+		v.RUnlock()
+	})
+	return s
+}
+
+// 复制缓存项当前的数据和元信息，调用者需要持有缓存项的读锁
+func (ci *CacheItem) snapshotLocked(key interface{}) SnapshotItem {
+	item := SnapshotItem{
+		Key:          key,
+		Data:         ci.dataLocked(),
+		LifeSpan:     ci.lifeSpan,
+		CreateTime:   ci.createTime,
+		AccessedTime: ci.accessedTime,
+		AccessCount:  ci.accessCountLocked(),
+		Version:      ci.version,
+	}
+	if len(ci.tags) > 0 {
+		item.Tags = append([]string(nil), ci.tags...)
+	}
+	return item
+}
+
+// Time 获取创建快照的时间
+func (s *Snapshot) Time() time.Time {
+	return s.time
+}
+
+// Len 获取快照中缓存项的个数
+func (s *Snapshot) Len() int {
+	return len(s.items)
+}
+
+// Get 获取快照中的缓存项
+func (s *Snapshot) Get(key interface{}) (SnapshotItem, bool) {
+	item, ok := s.items[key]
+	return item, ok
+}
+
+// Keys 获取快照中所有的键
+func (s *Snapshot) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(s.items))
+	for k := range s.items {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Foreach 遍历快照中的缓存项，不持有任何锁
+func (s *Snapshot) Foreach(op func(item SnapshotItem)) {
+	for _, item := range s.items {
+		op(item)
+	}
+}
@@ -0,0 +1,146 @@
+package cache2go
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats 缓存表的统计信息快照
+type Stats struct {
+	// 命中次数
+	Hits int64 `json:"hits"`
+	// 未命中次数
+	Misses int64 `json:"misses"`
+	// 通过loadData或GetOrCompute成功加载的次数
+	Loads int64 `json:"loads"`
+	// 加载失败的次数
+	LoadFailures int64 `json:"loadFailures"`
+	// 新增缓存项的次数
+	Adds int64 `json:"adds"`
+	// 手动删除缓存项的次数
+	Deletes int64 `json:"deletes"`
+	// 缓存项过期的次数
+	Expirations int64 `json:"expirations"`
+	// 超出容量限制被淘汰的次数
+	Evictions int64 `json:"evictions"`
+	// 被准入策略拒绝的次数
+	Rejections int64 `json:"rejections"`
+}
+
+// HitRatio 计算命中率，没有任何访问时返回0
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// 加载耗时直方图的桶上界
+var loadLatencyBuckets = [...]time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// LatencyHistogram 加载耗时的直方图
+type LatencyHistogram struct {
+	// 每个桶的上界，从小到大排列
+	Bounds []time.Duration
+	// 每个桶中的次数，比Bounds多一个元素，最后一个表示超过所有上界的次数
+	Counts []int64
+	// 总耗时
+	Sum time.Duration
+	// 总次数
+	Count int64
+}
+
+// 缓存表内部使用原子操作维护的计数器
+type tableStats struct {
+	// 是否关闭统计，只在创建缓存表时设置
+	disabled bool
+
+	hits         atomic.Int64
+	misses       atomic.Int64
+	loads        atomic.Int64
+	loadFailures atomic.Int64
+	adds         atomic.Int64
+	deletes      atomic.Int64
+	expirations  atomic.Int64
+	evictions    atomic.Int64
+	rejections   atomic.Int64
+	// 加载耗时直方图，最后一个桶记录超过所有上界的次数
+	loadBuckets [len(loadLatencyBuckets) + 1]atomic.Int64
+	loadSum     atomic.Int64
+}
+
+// 增加计数器，关闭统计时不做任何操作
+func (s *tableStats) add(c *atomic.Int64, n int64) {
+	if !s.disabled {
+		c.Add(n)
+	}
+}
+
+// 记录一次加载的耗时
+func (s *tableStats) observeLoad(d time.Duration) {
+	if s.disabled {
+		return
+	}
+	i := 0
+	for i < len(loadLatencyBuckets) && d > loadLatencyBuckets[i] {
+		i++
+	}
+	s.loadBuckets[i].Add(1)
+	s.loadSum.Add(int64(d))
+}
+
+// Stats 获取缓存表的统计信息
+func (ct *CacheTable) Stats() Stats {
+	return Stats{
+		Hits:         ct.stats.hits.Load(),
+		Misses:       ct.stats.misses.Load(),
+		Loads:        ct.stats.loads.Load(),
+		LoadFailures: ct.stats.loadFailures.Load(),
+		Adds:         ct.stats.adds.Load(),
+		Deletes:      ct.stats.deletes.Load(),
+		Expirations:  ct.stats.expirations.Load(),
+		Evictions:    ct.stats.evictions.Load(),
+		Rejections:   ct.stats.rejections.Load(),
+	}
+}
+
+// LoadLatency 获取loadData和GetOrCompute加载耗时的直方图
+func (ct *CacheTable) LoadLatency() LatencyHistogram {
+	h := LatencyHistogram{
+		Bounds: append([]time.Duration(nil), loadLatencyBuckets[:]...),
+		Counts: make([]int64, len(ct.stats.loadBuckets)),
+		Sum:    time.Duration(ct.stats.loadSum.Load()),
+	}
+	for i := range ct.stats.loadBuckets {
+		h.Counts[i] = ct.stats.loadBuckets[i].Load()
+		h.Count += h.Counts[i]
+	}
+	return h
+}
+
+// ResetStats 将缓存表的统计信息清零
+func (ct *CacheTable) ResetStats() {
+	ct.stats.hits.Store(0)
+	ct.stats.misses.Store(0)
+	ct.stats.loads.Store(0)
+	ct.stats.loadFailures.Store(0)
+	ct.stats.adds.Store(0)
+	ct.stats.deletes.Store(0)
+	ct.stats.expirations.Store(0)
+	ct.stats.evictions.Store(0)
+	ct.stats.rejections.Store(0)
+	for i := range ct.stats.loadBuckets {
+		ct.stats.loadBuckets[i].Store(0)
+	}
+	ct.stats.loadSum.Store(0)
+}
@@ -0,0 +1,146 @@
+package cache2go
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Store 二级存储，例如Redis或DynamoDB，缓存表作为它前面的一级缓存
+type Store interface {
+	// Get 获取数据，键不存在时返回ErrCacheNotFound
+	Get(key interface{}) (interface{}, error)
+	// Set 写入数据，lifeSpan为缓存表中使用的存活时间，0表示永不过期
+	Set(key, data interface{}, lifeSpan time.Duration) error
+	// Delete 删除数据，键不存在时不返回错误
+	Delete(key interface{}) error
+}
+
+// StorePolicy 缓存表与二级存储之间的同步策略
+type StorePolicy struct {
+	// ReadThrough Value未命中并且没有设置SetDataLoader时从store读取，读取到的数据使用默认存活时间加入缓存表
+	ReadThrough bool
+	// WriteThrough 通过Add、AddAll、AddWithTags、AddIfVersion、NotFoundAdd、Replace、Update以及事务进行的修改同步写入store
+	WriteThrough bool
+	// PropagateDeletes 通过Delete、DeleteAll、DeleteFunc、DeleteByTag、Pop、Update以及事务删除的键同时从store中删除，
+	// 此时Delete缓存表中不存在的键也不返回错误
+	PropagateDeletes bool
+	// 各个操作失败时的处理函数，为nil时使用WithErrorHandler设置的错误处理函数，
+	// 读取失败时Value仍然会返回*LoaderError
+	OnReadError   func(key interface{}, err error)
+	OnWriteError  func(key interface{}, err error)
+	OnDeleteError func(key interface{}, err error)
+}
+
+// WithStore 设置二级存储并开启读穿透、写穿透和删除同步，过期、淘汰和清空只影响缓存表，
+// 写入store失败时交给错误处理函数，不影响缓存表
+func WithStore(store Store) Option {
+	return WithStorePolicy(store, StorePolicy{ReadThrough: true, WriteThrough: true, PropagateDeletes: true})
+}
+
+// WithStorePolicy 设置二级存储以及同步策略
+func WithStorePolicy(store Store, policy StorePolicy) Option {
+	return func(ct *CacheTable) {
+		ct.store = store
+		ct.storePolicy = policy
+	}
+}
+
+// 是否从二级存储读取未命中的键
+func (ct *CacheTable) readThrough() bool {
+	return ct.store != nil && ct.storePolicy.ReadThrough
+}
+
+// 是否将删除同步到二级存储
+func (ct *CacheTable) propagateDeletes() bool {
+	return ct.store != nil && ct.storePolicy.PropagateDeletes
+}
+
+// 处理二级存储的错误，hook为nil时交给错误处理函数
+func (ct *CacheTable) storeError(hook func(interface{}, error), key interface{}, err error) {
+	if hook != nil {
+		ct.safeCall(CallbackStoreError, key, func() { hook(key, err) })
+		return
+	}
+	ct.reportError(err, key)
+}
+
+// 从二级存储加载数据并加入缓存表
+func (ct *CacheTable) loadFromStore(ctx context.Context, key interface{}) (*CacheItem, error) {
+	tracer := ct.readConfig().tracer
+	var span Span
+	if tracer != nil {
+		_, span = tracer.Start(ctx, SpanLoad, ct.Name(), key)
+	}
+
+	var data interface{}
+	var err error
+	if op, ok := ct.pendingWrite(key); ok {
+		// 写回队列中尚未写入的操作比二级存储中的数据更新
+		if op.Delete {
+			err = ErrCacheNotFound
+		} else {
+			data = op.Data
+		}
+	} else {
+		ct.loading.add()
+		data, err = ct.store.Get(key)
+		ct.loading.done()
+	}
+	if err == nil {
+		ct.stats.add(&ct.stats.loads, 1)
+		if span != nil {
+			span.End(nil)
+		}
+		item := ct.newItem(key, data, ct.effectiveLifeSpan(DefaultLifeSpan))
+		ct.addInternal(item)
+		return item, nil
+	}
+	if errors.Is(err, ErrCacheNotFound) {
+		err = ct.keyError(key, ErrCacheNotFound)
+	} else {
+		ct.stats.add(&ct.stats.loadFailures, 1)
+		if ct.storePolicy.OnReadError != nil {
+			ct.storeError(ct.storePolicy.OnReadError, key, err)
+		}
+		err = ct.loaderError(key, err)
+	}
+	if span != nil {
+		span.End(err)
+	}
+	return nil, err
+}
+
+// 查找写回队列中尚未写入的操作
+func (ct *CacheTable) pendingWrite(key interface{}) (StoreOp, bool) {
+	if ct.writeBehind == nil {
+		return StoreOp{}, false
+	}
+	return ct.writeBehind.lookup(key)
+}
+
+// 把写入同步到二级存储
+func (ct *CacheTable) storeSet(key, data interface{}, lifeSpan time.Duration) {
+	if ct.store == nil || !ct.storePolicy.WriteThrough {
+		return
+	}
+	if ct.writeBehind != nil && ct.writeBehind.enqueue(StoreOp{Key: key, Data: data, LifeSpan: lifeSpan}) {
+		return
+	}
+	if err := ct.store.Set(key, data, lifeSpan); err != nil {
+		ct.storeError(ct.storePolicy.OnWriteError, key, err)
+	}
+}
+
+// 把删除同步到二级存储
+func (ct *CacheTable) storeDelete(key interface{}) {
+	if !ct.propagateDeletes() {
+		return
+	}
+	if ct.writeBehind != nil && ct.writeBehind.enqueue(StoreOp{Key: key, Delete: true}) {
+		return
+	}
+	if err := ct.store.Delete(key); err != nil {
+		ct.storeError(ct.storePolicy.OnDeleteError, key, err)
+	}
+}
@@ -0,0 +1,45 @@
+package cache2go
+
+import "time"
+
+// AddWithTags 新增缓存项并附加标签，标签在创建之后不能修改，可以通过DeleteByTag批量删除同一标签的缓存项
+func (ct *CacheTable) AddWithTags(key, data interface{}, lifeSpan time.Duration, tags ...string) *CacheItem {
+	item := ct.newItem(key, data, ct.effectiveLifeSpan(lifeSpan))
+	item.tags = append([]string(nil), tags...)
+	ct.addInternal(item)
+	ct.storeSet(key, data, item.lifeSpan)
+	return item
+}
+
+// Tags 获取缓存项的标签
+func (ci *CacheItem) Tags() []string {
+	return append([]string(nil), ci.tags...)
+}
+
+// HasTag 判断缓存项是否带有标签tag
+func (ci *CacheItem) HasTag(tag string) bool {
+	for _, t := range ci.tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ItemsByTag 获取所有带有标签tag的缓存项，不保证顺序
+func (ct *CacheTable) ItemsByTag(tag string) []*CacheItem {
+	var items []*CacheItem
+	ct.rangeItems(func(_ interface{}, item *CacheItem) {
+		if item.HasTag(tag) {
+			items = append(items, item)
+		}
+	})
+	return items
+}
+
+// DeleteByTag 删除所有带有标签tag的缓存项并执行删除回调函数，返回删除的个数
+func (ct *CacheTable) DeleteByTag(tag string) int {
+	return ct.DeleteFunc(func(_ interface{}, item *CacheItem) bool {
+		return item.HasTag(tag)
+	})
+}
@@ -0,0 +1,32 @@
+package cache2go
+
+import "context"
+
+// Tracer 链路追踪的接口，cache2go本身不依赖具体的实现，OpenTelemetry的适配见cache2go/otel
+type Tracer interface {
+	// Start 开始一个span，传入span的名字、缓存表的名字以及键，返回携带该span的context
+	Start(ctx context.Context, name string, table string, key interface{}) (context.Context, Span)
+}
+
+// Span 一次被追踪的操作
+type Span interface {
+	// Event 记录一个事件，例如缓存命中或未命中
+	Event(name string)
+	// End 结束span，err不为nil时表示操作失败
+	End(err error)
+}
+
+// span的名字以及事件的名字
+const (
+	SpanValue = "cache2go.Value"
+	SpanLoad  = "cache2go.Load"
+
+	EventHit   = "cache.hit"
+	EventMiss  = "cache.miss"
+	EventStale = "cache.stale"
+)
+
+// SetTracer 设置缓存表的链路追踪实现，传入nil关闭追踪
+func (ct *CacheTable) SetTracer(tracer Tracer) {
+	ct.updateReadConfig(func(c *readConfig) { c.tracer = tracer })
+}
@@ -0,0 +1,159 @@
+package cache2go
+
+import "time"
+
+// Txn 缓存表上的事务，写入和删除会先缓存在事务中，只有Tx的回调函数返回nil时才会一次性应用到缓存表
+type Txn struct {
+	table *CacheTable
+	// 事务中修改过的键，值为nil表示删除
+	writes map[interface{}]*CacheItem
+	// 键第一次被修改的顺序，提交时按照该顺序应用
+	order []interface{}
+	// Set时第一次加密失败的错误，不为nil时丢弃事务
+	err error
+}
+
+// Tx 在事务中执行f，f返回nil时原子地提交所有的修改，返回错误或panic时丢弃所有的修改。
+// 事务执行期间持有缓存表的写锁，其他写操作会等待事务结束，但命中缓存项的读取不会等待，提交期间可能读到部分修改，
+// f中不能调用同一个缓存表的方法；
+// 提交之后才会执行新增回调函数、发送变更事件以及调度超时检查
+func (ct *CacheTable) Tx(f func(tx *Txn) error) error {
+	tx := &Txn{table: ct, writes: make(map[interface{}]*CacheItem)}
+	ct.Lock()
+	if ct.isClosed() {
+		ct.Unlock()
+		return ErrTableClosed
+	}
+	if err := tx.run(f); err != nil {
+		ct.Unlock()
+		return err
+	}
+	if tx.err != nil {
+		ct.Unlock()
+		return tx.err
+	}
+	if len(tx.order) == 0 {
+		ct.Unlock()
+		return nil
+	}
+
+	watched := ct.watched()
+	var added, existed []*CacheItem
+	smallest := time.Duration(0)
+	for _, key := range tx.order {
+		item := tx.writes[key]
+		sh := ct.shardFor(key)
+		sh.Lock()
+		old, ok := sh.items[key]
+		if item == nil {
+			if ok {
+				ct.deleteLocked(sh, key, old, ReasonDeleted)
+			}
+			sh.Unlock()
+			continue
+		}
+		if ok {
+			ct.untrack(old)
+		}
+		sh.set(key, item)
+		ct.track(key, item)
+		ct.indexPut(key, item)
+		sh.Unlock()
+		added = append(added, item)
+		if watched {
+			existed = append(existed, old)
+		}
+		if item.lifeSpan > 0 && (smallest == 0 || item.lifeSpan < smallest) {
+			smallest = item.lifeSpan
+		}
+	}
+	ct.evictLocked()
+	addedItem := ct.readConfig().addedItem.fns
+	ct.Unlock()
+
+	for _, key := range tx.order {
+		if item := tx.writes[key]; item != nil {
+			ct.storeSet(key, item.Data(), item.lifeSpan)
+		} else {
+			ct.storeDelete(key)
+		}
+	}
+	ct.stats.add(&ct.stats.adds, int64(len(added)))
+	for i := range existed {
+		ct.emitAdd(added[i], existed[i])
+	}
+	for _, item := range added {
+		item := item
+		for _, callback := range addedItem {
+			callback := callback
+			ct.runCallback(CallbackAddedItem, item.key, func() { callback(item) })
+		}
+	}
+	if ct.logEnabled(LevelDebug) {
+		ct.log(LevelDebug, "提交事务", "event", "tx", "writes", len(tx.order))
+	}
+	ct.reschedule(smallest)
+	return nil
+}
+
+// 执行f，panic时释放缓存表的锁后继续panic
+func (tx *Txn) run(f func(tx *Txn) error) error {
+	defer func() {
+		if r := recover(); r != nil {
+			tx.table.Unlock()
+			panic(r)
+		}
+	}()
+	return f(tx)
+}
+
+// Get 获取键对应的数据，会读取到事务中尚未提交的修改，不会更新访问次数和存活时间
+func (tx *Txn) Get(key interface{}) (interface{}, bool) {
+	if item, ok := tx.writes[key]; ok {
+		if item == nil {
+			return nil, false
+		}
+		return item.Data(), true
+	}
+	item, ok := tx.table.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	return item.Data(), true
+}
+
+// Exists 判断键在事务中是否存在
+func (tx *Txn) Exists(key interface{}) bool {
+	_, ok := tx.Get(key)
+	return ok
+}
+
+// Set 在事务中写入缓存项，提交时会替换已存在的缓存项，数据加密失败时整个事务会被丢弃，Tx返回该错误
+func (tx *Txn) Set(key, data interface{}, lifeSpan time.Duration) {
+	ct := tx.table
+	encoded, err := ct.encode(key, data)
+	if err != nil {
+		if tx.err == nil {
+			tx.err = ct.keyError(key, err)
+		}
+		return
+	}
+	item := ct.newItem(key, encoded, ct.effectiveLifeSpan(lifeSpan))
+	item.table = ct
+	item.version = ct.nextVersion()
+	tx.record(key, item)
+}
+
+// Delete 在事务中删除缓存项，返回该键在事务中是否存在
+func (tx *Txn) Delete(key interface{}) bool {
+	ok := tx.Exists(key)
+	tx.record(key, nil)
+	return ok
+}
+
+func (tx *Txn) record(key interface{}, item *CacheItem) {
+	if _, ok := tx.writes[key]; !ok {
+		tx.order = append(tx.order, key)
+	}
+	tx.writes[key] = item
+}
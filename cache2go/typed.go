@@ -0,0 +1,53 @@
+package cache2go
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// TypeError 缓存项的数据类型与期望的类型不一致
+type TypeError struct {
+	Key  interface{}
+	Want reflect.Type
+	// Got 数据的实际类型，数据为nil时Got也为nil
+	Got reflect.Type
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf(localize("缓存项%v的数据类型为%v，期望的类型为%v", "cache item %v has type %v, want %v"), e.Key, e.Got, e.Want)
+}
+
+// DataAs 获取缓存项的数据并转换为T，类型不一致时返回*TypeError
+func DataAs[T any](item *CacheItem) (T, error) {
+	data := item.Data()
+	v, ok := data.(T)
+	if !ok {
+		return v, &TypeError{Key: item.Key(), Want: reflect.TypeOf((*T)(nil)).Elem(), Got: reflect.TypeOf(data)}
+	}
+	return v, nil
+}
+
+// 与Value相同，获取缓存项后将数据转换为T
+func valueAs[T any](ct *CacheTable, key interface{}, args ...interface{}) (T, error) {
+	item, err := ct.Value(key, args...)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return DataAs[T](item)
+}
+
+// GetString 获取缓存项的字符串数据，数据不是string时返回*TypeError
+func (ct *CacheTable) GetString(key interface{}, args ...interface{}) (string, error) {
+	return valueAs[string](ct, key, args...)
+}
+
+// GetInt 获取缓存项的整数数据，数据不是int时返回*TypeError
+func (ct *CacheTable) GetInt(key interface{}, args ...interface{}) (int, error) {
+	return valueAs[int](ct, key, args...)
+}
+
+// GetBytes 获取缓存项的[]byte数据，数据不是[]byte时返回*TypeError
+func (ct *CacheTable) GetBytes(key interface{}, args ...interface{}) ([]byte, error) {
+	return valueAs[[]byte](ct, key, args...)
+}
@@ -0,0 +1,58 @@
+package cache2go
+
+// 分配新的版本号，同一个缓存表内的版本号单调递增
+func (ct *CacheTable) nextVersion() uint64 {
+	return ct.version.Add(1)
+}
+
+// AddIfVersion 当缓存项的版本号等于version时写入数据并返回更新后的缓存项，版本号不一致时返回ErrVersionMismatch，
+// 保留已存在缓存项的存活时间、创建时间和访问次数；version为0表示缓存项不存在，此时以默认存活时间新增缓存项
+func (ct *CacheTable) AddIfVersion(key, data interface{}, version uint64) (*CacheItem, error) {
+	encoded, err := ct.encode(key, data)
+	if err != nil {
+		return nil, ct.keyError(key, err)
+	}
+	ct.RLock()
+	if ct.isClosed() {
+		ct.RUnlock()
+		return nil, ErrTableClosed
+	}
+	sh := ct.shardFor(key)
+	sh.Lock()
+	cur, ok := sh.items[key]
+	var old interface{}
+	matched := false
+	if ok {
+		cur.Lock()
+		if cur.version == version {
+			matched = true
+			old = cur.dataLocked()
+			cur.data = encoded
+			cur.version = ct.nextVersion()
+		}
+		cur.Unlock()
+	}
+	sh.Unlock()
+	ct.RUnlock()
+
+	if ok {
+		if !matched {
+			return nil, ct.keyError(key, ErrVersionMismatch)
+		}
+		ct.reindex(key, cur)
+		ct.storeSet(key, data, cur.LifeSpan())
+		if ct.watched() {
+			ct.emit(Event{Type: WatchUpdate, Key: key, OldData: old, NewData: data, Time: ct.now()})
+		}
+		return cur, nil
+	}
+	if version != 0 {
+		return nil, ct.keyError(key, ErrVersionMismatch)
+	}
+	item := ct.newItem(key, data, ct.effectiveLifeSpan(DefaultLifeSpan))
+	if !ct.insert(item, func(existing *CacheItem) bool { return existing == nil }) {
+		return nil, ct.keyError(key, ErrVersionMismatch)
+	}
+	ct.storeSet(key, data, item.lifeSpan)
+	return item, nil
+}
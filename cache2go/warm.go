@@ -0,0 +1,99 @@
+package cache2go
+
+import (
+	"context"
+	"sync"
+)
+
+// WarmProgress 预热的进度，每处理完一个键通知一次
+type WarmProgress struct {
+	// 已经处理的键的个数以及键的总数
+	Done, Total int
+	// 刚处理完的键，以及加载失败时的错误
+	Key interface{}
+	Err error
+}
+
+// WarmResult 预热的结果
+type WarmResult struct {
+	// 成功加载的个数
+	Loaded int
+	// 已经存在而跳过的个数
+	Skipped int
+	// 加载失败的键
+	Failed []interface{}
+}
+
+// Warm 使用SetDataLoader设置的loadData或二级存储加载keys中的所有键，同时最多执行concurrency个加载，
+// 已经存在的键会被跳过，适合在服务启动后、接收流量之前预先填充缓存表。ctx结束时不再开始新的加载，
+// 返回已经完成的部分结果以及ctx的错误
+func (ct *CacheTable) Warm(ctx context.Context, keys []interface{}, concurrency int) (WarmResult, error) {
+	return ct.WarmWithProgress(ctx, keys, concurrency, nil)
+}
+
+// WarmWithProgress 与Warm相同，progress不为nil时每处理完一个键调用一次，调用是串行的
+func (ct *CacheTable) WarmWithProgress(ctx context.Context, keys []interface{}, concurrency int, progress func(WarmProgress)) (WarmResult, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if ct.Closed() {
+		return WarmResult{}, ErrTableClosed
+	}
+	loadData := ct.readConfig().loadData
+
+	var (
+		mu  sync.Mutex
+		res WarmResult
+		n   int
+		wg  sync.WaitGroup
+	)
+	report := func(key interface{}, loaded bool, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case err != nil:
+			res.Failed = append(res.Failed, key)
+		case loaded:
+			res.Loaded++
+		default:
+			res.Skipped++
+		}
+		n++
+		if progress != nil {
+			progress(WarmProgress{Done: n, Total: len(keys), Key: key, Err: err})
+		}
+	}
+
+	queue := make(chan interface{})
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range queue {
+				if _, ok := ct.lookup(key); ok {
+					report(key, false, nil)
+					continue
+				}
+				_, err := ct.load(ctx, key, loadData)
+				report(key, true, err)
+			}
+		}()
+	}
+	var err error
+feed:
+	for _, key := range keys {
+		// select在两个分支都就绪时随机选择，先检查ctx保证结束之后不再开始新的加载
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		select {
+		case queue <- key:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return res, err
+}
@@ -0,0 +1,161 @@
+package cache2go
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// EventType 缓存表变更事件的类型
+type EventType int
+
+const (
+	// WatchAdd 新增缓存项
+	WatchAdd EventType = iota
+	// WatchUpdate 修改已存在缓存项的数据
+	WatchUpdate
+	// WatchDelete 删除缓存项，包括手动删除、清空和淘汰，具体原因见Event.Reason
+	WatchDelete
+	// WatchExpire 缓存项过期
+	WatchExpire
+)
+
+func (t EventType) String() string {
+	switch t {
+	case WatchAdd:
+		return "add"
+	case WatchUpdate:
+		return "update"
+	case WatchDelete:
+		return "delete"
+	case WatchExpire:
+		return "expire"
+	}
+	return "unknown"
+}
+
+// Event 缓存表的变更事件
+type Event struct {
+	Type EventType
+	Key  interface{}
+	// 变更前的数据，新增时为nil
+	OldData interface{}
+	// 变更后的数据，删除和过期时为nil
+	NewData interface{}
+	// 删除的原因，只在WatchDelete和WatchExpire时有意义
+	Reason DeleteReason
+	// 事件发生的时间
+	Time time.Time
+}
+
+// SlowConsumerPolicy 当订阅者来不及消费、缓冲区已满时的处理策略
+type SlowConsumerPolicy int
+
+const (
+	// DropEvent 丢弃新的事件，不会阻塞缓存表的操作，默认策略
+	DropEvent SlowConsumerPolicy = iota
+	// BlockProducer 阻塞缓存表的操作直到事件被消费或订阅被取消，
+	// 此时订阅者不能在消费事件的协程中写入同一个缓存表，否则会死锁
+	BlockProducer
+)
+
+// WatchOptions 订阅的配置
+type WatchOptions struct {
+	// 事件通道的缓冲区大小
+	Buffer int
+	// 缓冲区已满时的处理策略
+	Policy SlowConsumerPolicy
+}
+
+// 一个订阅者
+type watcher struct {
+	ctx    context.Context
+	ch     chan Event
+	policy SlowConsumerPolicy
+}
+
+// 缓存表的订阅者列表
+type watchers struct {
+	sync.RWMutex
+	list []*watcher
+}
+
+// Watch 订阅缓存表的变更事件，使用64的缓冲区并在缓冲区满时丢弃事件，ctx取消后通道会被关闭
+func (ct *CacheTable) Watch(ctx context.Context) <-chan Event {
+	return ct.WatchWithOptions(ctx, WatchOptions{Buffer: 64})
+}
+
+// WatchWithOptions 使用指定的配置订阅缓存表的变更事件，ctx取消后通道会被关闭
+func (ct *CacheTable) WatchWithOptions(ctx context.Context, opts WatchOptions) <-chan Event {
+	w := &watcher{
+		ctx:    ctx,
+		ch:     make(chan Event, opts.Buffer),
+		policy: opts.Policy,
+	}
+	ct.watchers.Lock()
+	ct.watchers.list = append(ct.watchers.list, w)
+	ct.watchers.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		ct.watchers.Lock()
+		for i, cur := range ct.watchers.list {
+			if cur == w {
+				ct.watchers.list = append(ct.watchers.list[:i], ct.watchers.list[i+1:]...)
+				break
+			}
+		}
+		// 持有写锁保证没有正在进行的发送
+		close(w.ch)
+		ct.watchers.Unlock()
+	}()
+	return w.ch
+}
+
+// 判断是否有订阅者，没有订阅者时不需要构造事件
+func (ct *CacheTable) watched() bool {
+	ct.watchers.RLock()
+	defer ct.watchers.RUnlock()
+	return len(ct.watchers.list) > 0
+}
+
+// 向所有订阅者发送事件
+func (ct *CacheTable) emit(e Event) {
+	ct.watchers.RLock()
+	defer ct.watchers.RUnlock()
+	for _, w := range ct.watchers.list {
+		if w.ctx.Err() != nil {
+			continue
+		}
+		if w.policy == BlockProducer {
+			select {
+			case w.ch <- e:
+			case <-w.ctx.Done():
+			}
+			continue
+		}
+		select {
+		case w.ch <- e:
+		default:
+		}
+	}
+}
+
+// 发送删除或过期事件
+func (ct *CacheTable) emitDelete(key, data interface{}, reason DeleteReason) {
+	t := WatchDelete
+	if reason == ReasonExpired {
+		t = WatchExpire
+	}
+	ct.emit(Event{Type: t, Key: key, OldData: data, Reason: reason, Time: ct.now()})
+}
+
+// 发送新增或修改事件，existed为nil时表示新增
+func (ct *CacheTable) emitAdd(item, existed *CacheItem) {
+	e := Event{Type: WatchAdd, Key: item.Key(), NewData: item.Data(), Time: ct.now()}
+	if existed != nil {
+		e.Type = WatchUpdate
+		e.OldData = existed.Data()
+	}
+	ct.emit(e)
+}
@@ -0,0 +1,240 @@
+package cache2go
+
+import (
+	"sync"
+	"time"
+)
+
+// StoreOp 写入二级存储的一个操作
+type StoreOp struct {
+	Key      interface{}
+	Data     interface{}
+	LifeSpan time.Duration
+	// 为true时表示删除，此时Data和LifeSpan没有意义
+	Delete bool
+}
+
+// BatchStore 支持批量写入的二级存储，开启写回时会使用WriteBatch一次写入一批操作，
+// 返回错误时整批操作都会重试
+type BatchStore interface {
+	Store
+	WriteBatch(ops []StoreOp) error
+}
+
+// WriteBehindConfig 写回模式的配置
+type WriteBehindConfig struct {
+	// 定时写入的间隔，默认为1秒
+	Interval time.Duration
+	// 每批最多写入的操作个数，等待写入的操作达到该数量时立即写入，默认为100
+	BatchSize int
+	// 写入失败后的重试次数以及重试间隔，默认不重试，间隔默认为100毫秒，
+	// 重试之后仍然失败的操作交给StorePolicy中对应的错误处理函数
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// WithWriteBehind 开启写回模式，需要同时通过WithStore或WithStorePolicy设置二级存储，
+// 写穿透和删除同步不再同步执行，而是放入队列由后台协程批量写入，同一个键只保留最后一次操作；
+// 读穿透时优先使用队列中尚未写入的数据。缓存表关闭时会写入队列中剩余的全部操作
+func WithWriteBehind(cfg WriteBehindConfig) Option {
+	return func(ct *CacheTable) {
+		if cfg.Interval <= 0 {
+			cfg.Interval = time.Second
+		}
+		if cfg.BatchSize < 1 {
+			cfg.BatchSize = 100
+		}
+		if cfg.RetryDelay <= 0 {
+			cfg.RetryDelay = 100 * time.Millisecond
+		}
+		ct.writeBehind = newWriteBehind(ct, cfg)
+	}
+}
+
+// FlushStore 立即写入写回队列中的全部操作，未开启写回模式时直接返回
+func (ct *CacheTable) FlushStore() {
+	if ct.writeBehind != nil {
+		ct.writeBehind.flush()
+	}
+}
+
+// 写回队列
+type writeBehind struct {
+	ct  *CacheTable
+	cfg WriteBehindConfig
+
+	mu      sync.Mutex
+	pending map[interface{}]StoreOp
+	order   []interface{}
+	stopped bool
+	// 已经从队列中取出、正在写入或重试的操作，写入完成或交给错误处理函数之后删除，
+	// 保证写入期间读穿透不会读到二级存储中的旧数据
+	inflight map[interface{}]StoreOp
+
+	// 保证同一时间只有一次写入，写入的顺序与入队的顺序一致
+	flushMu sync.Mutex
+	kick    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newWriteBehind(ct *CacheTable, cfg WriteBehindConfig) *writeBehind {
+	w := &writeBehind{
+		ct:       ct,
+		cfg:      cfg,
+		pending:  make(map[interface{}]StoreOp),
+		inflight: make(map[interface{}]StoreOp),
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// 将操作放入队列，队列已经停止时返回false，由调用者同步写入
+func (w *writeBehind) enqueue(op StoreOp) bool {
+	w.mu.Lock()
+	if w.stopped {
+		w.mu.Unlock()
+		return false
+	}
+	if _, ok := w.pending[op.Key]; !ok {
+		w.order = append(w.order, op.Key)
+	}
+	w.pending[op.Key] = op
+	full := len(w.order) >= w.cfg.BatchSize
+	w.mu.Unlock()
+	if full {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// 查找队列中尚未写入的操作，包括正在写入的操作，队列中的操作更新
+func (w *writeBehind) lookup(key interface{}) (StoreOp, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if op, ok := w.pending[key]; ok {
+		return op, true
+	}
+	op, ok := w.inflight[key]
+	return op, ok
+}
+
+func (w *writeBehind) run() {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.kick:
+		case <-w.stop:
+			w.flush()
+			close(w.done)
+			return
+		}
+		w.flush()
+	}
+}
+
+// 停止接收新的操作，写入剩余的操作并等待后台协程退出
+func (w *writeBehind) close() {
+	w.mu.Lock()
+	if w.stopped {
+		w.mu.Unlock()
+		<-w.done
+		return
+	}
+	w.stopped = true
+	w.mu.Unlock()
+	close(w.stop)
+	<-w.done
+}
+
+// 写入队列中的全部操作
+func (w *writeBehind) flush() {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	ops := make([]StoreOp, 0, len(w.order))
+	for _, key := range w.order {
+		op := w.pending[key]
+		ops = append(ops, op)
+		w.inflight[key] = op
+	}
+	w.pending = make(map[interface{}]StoreOp)
+	w.order = nil
+	w.mu.Unlock()
+
+	for len(ops) > 0 {
+		n := len(ops)
+		if n > w.cfg.BatchSize {
+			n = w.cfg.BatchSize
+		}
+		w.write(ops[:n])
+		w.mu.Lock()
+		for _, op := range ops[:n] {
+			delete(w.inflight, op.Key)
+		}
+		w.mu.Unlock()
+		ops = ops[n:]
+	}
+}
+
+// 写入一批操作，失败的操作按照配置重试
+func (w *writeBehind) write(batch []StoreOp) {
+	ct := w.ct
+	var errs []error
+	for attempt := 0; ; attempt++ {
+		batch, errs = w.apply(batch)
+		if len(batch) == 0 {
+			return
+		}
+		if attempt >= w.cfg.Retries {
+			break
+		}
+		time.Sleep(w.cfg.RetryDelay)
+	}
+	for i, op := range batch {
+		if op.Delete {
+			ct.storeError(ct.storePolicy.OnDeleteError, op.Key, errs[i])
+		} else {
+			ct.storeError(ct.storePolicy.OnWriteError, op.Key, errs[i])
+		}
+	}
+}
+
+// 执行一批操作，返回失败的操作以及对应的错误
+func (w *writeBehind) apply(batch []StoreOp) ([]StoreOp, []error) {
+	store := w.ct.store
+	if bs, ok := store.(BatchStore); ok {
+		if err := bs.WriteBatch(batch); err != nil {
+			errs := make([]error, len(batch))
+			for i := range errs {
+				errs[i] = err
+			}
+			return batch, errs
+		}
+		return nil, nil
+	}
+	var failed []StoreOp
+	var errs []error
+	for _, op := range batch {
+		var err error
+		if op.Delete {
+			err = store.Delete(op.Key)
+		} else {
+			err = store.Set(op.Key, op.Data, op.LifeSpan)
+		}
+		if err != nil {
+			failed = append(failed, op)
+			errs = append(errs, err)
+		}
+	}
+	return failed, errs
+}
@@ -17,11 +17,11 @@ func (view ByteView) String() string {
 
 // ByteSlice 返回缓存项的副本
 func (view ByteView) ByteSlice() []byte {
-	return view.cloneBytes(view.b)
+	return cloneBytes(view.b)
 }
 
 // 创建缓存项的副本，防止缓存被改变
-func (view ByteView) cloneBytes(b []byte) []byte {
+func cloneBytes(b []byte) []byte {
 	res := make([]byte, len(b))
 	copy(res, b)
 	return res
@@ -6,7 +6,7 @@ import (
 )
 
 type cache struct {
-	sync.RWMutex
+	sync.Mutex
 	lru        *lru.Cache
 	cacheBytes int64
 }
@@ -22,10 +22,10 @@ func (c *cache) add(key string, value ByteView) {
 	c.lru.Add(key, value)
 }
 
-// 获取缓存项，传入key，返回ByteView和是否存在
+// 获取缓存项，传入key，返回ByteView和是否存在，命中时lru会移动链表节点，需要持有写锁
 func (c *cache) get(key string) (ByteView, bool) {
-	c.RLock()
-	defer c.RUnlock()
+	c.Lock()
+	defer c.Unlock()
 	if c.lru == nil {
 		return ByteView{}, false
 	}
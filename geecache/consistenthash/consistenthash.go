@@ -0,0 +1,68 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// Hash 将数据映射为uint32的哈希函数，可以替换为xxhash、murmur等实现
+type Hash func(data []byte) uint32
+
+// Map 一致性哈希环，每个真实节点对应多个虚拟节点，使key分布更加均匀
+type Map struct {
+	// 哈希函数
+	hash Hash
+	// 每个真实节点对应的虚拟节点个数
+	replicas int
+	// 排好序的虚拟节点哈希值，即哈希环
+	keys []int
+	// 虚拟节点哈希值与真实节点名字的映射
+	hashMap map[int]string
+}
+
+// New 创建一个哈希环，传入每个真实节点对应的虚拟节点个数以及哈希函数，
+// replicas小于1时按1处理，fn为nil时使用crc32.ChecksumIEEE
+func New(replicas int, fn Hash) *Map {
+	if replicas < 1 {
+		replicas = 1
+	}
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Map{
+		hash:     fn,
+		replicas: replicas,
+		hashMap:  make(map[int]string),
+	}
+}
+
+// Add 增加真实节点，每个节点会生成replicas个虚拟节点
+func (m *Map) Add(keys ...string) {
+	for _, key := range keys {
+		for i := 0; i < m.replicas; i++ {
+			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+			m.keys = append(m.keys, hash)
+			m.hashMap[hash] = key
+		}
+	}
+	sort.Ints(m.keys)
+}
+
+// Get 获取key所属的真实节点，哈希环为空时返回空字符串
+func (m *Map) Get(key string) string {
+	if len(m.keys) == 0 {
+		return ""
+	}
+	hash := int(m.hash([]byte(key)))
+	// 顺时针找到第一个不小于hash的虚拟节点，超过最后一个时回到环的起点
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	return m.hashMap[m.keys[idx%len(m.keys)]]
+}
+
+// IsEmpty 判断哈希环中是否没有节点
+func (m *Map) IsEmpty() bool {
+	return len(m.keys) == 0
+}
@@ -0,0 +1,100 @@
+package consistenthash
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"testing"
+)
+
+func TestHashing(t *testing.T) {
+	// 使用可预测的哈希函数，虚拟节点的哈希值就是节点名字前加上编号
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+
+	// 虚拟节点为 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+
+	testCases := map[string]string{
+		"2":  "2",
+		"11": "2",
+		"23": "4",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+
+	// 增加节点8，虚拟节点 8, 18, 28
+	hash.Add("8")
+	// 27现在应该属于8
+	testCases["27"] = "8"
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	hash := New(3, nil)
+	if !hash.IsEmpty() || hash.Get("key") != "" {
+		t.Errorf("empty ring should not own any key")
+	}
+}
+
+func TestConsistency(t *testing.T) {
+	hash1 := New(50, nil)
+	hash2 := New(50, nil)
+	hash1.Add("Bill", "Bob", "Bonny")
+	hash2.Add("Bob", "Bonny", "Bill")
+	// 节点加入的顺序不影响key的分配
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if hash1.Get(key) != hash2.Get(key) {
+			t.Errorf("Fetching %s from both hashes should be the same", key)
+		}
+	}
+
+	// 增加节点只会移动一部分key
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		before[key] = hash1.Get(key)
+	}
+	hash1.Add("Becky")
+	moved := 0
+	for key, owner := range before {
+		if now := hash1.Get(key); now != owner {
+			if now != "Becky" {
+				t.Errorf("%s moved from %s to %s instead of the new peer", key, owner, now)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 500 {
+		t.Errorf("unexpected number of moved keys %d", moved)
+	}
+}
+
+func TestDefaultHash(t *testing.T) {
+	var calls int
+	custom := New(2, func(data []byte) uint32 {
+		calls++
+		return crc32.ChecksumIEEE(data)
+	})
+	builtin := New(0, nil)
+	custom.Add("a", "b")
+	builtin.Add("a", "b")
+	if calls != 4 {
+		t.Errorf("custom hash should be used for every virtual node, got %d calls", calls)
+	}
+	// replicas小于1时按1处理
+	if len(builtin.keys) != 2 {
+		t.Errorf("expected one virtual node per peer, got %d", len(builtin.keys))
+	}
+}
@@ -1,24 +1,133 @@
 package geecache
 
-import "sync"
+import (
+	"fmt"
+	pb "geecache/geecachepb"
+	"geecache/singleflight"
+	"log"
+	"sync"
+)
 
+// Getter 缓存未命中时从数据源获取数据
 type Getter interface {
 	Get(key string) ([]byte, error)
 }
 
+// GetterFunc 函数类型实现Getter接口，可以直接传入函数作为数据源
 type GetterFunc func(key string) ([]byte, error)
 
+// Get 实现Getter接口
 func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// Group 缓存的命名空间，每个Group拥有独立的缓存和数据源
 type Group struct {
 	name      string
 	getter    Getter
 	mainCache cache
+	// 选择远程节点，未注册时只从本地数据源获取
+	peers PeerPicker
+	// 保证同一个key并发未命中时只加载一次
+	loader *singleflight.Group
 }
 
 var (
 	mutex sync.RWMutex
 	group = make(map[string]*Group)
 )
+
+// NewGroup 创建一个Group并注册到全局，传入名字、最大内存以及缓存未命中时使用的数据源
+func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+	if getter == nil {
+		panic("geecache: nil Getter")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	g := &Group{
+		name:      name,
+		getter:    getter,
+		mainCache: cache{cacheBytes: cacheBytes},
+		loader:    &singleflight.Group{},
+	}
+	group[name] = g
+	return g
+}
+
+// GetGroup 根据名字获取Group，不存在时返回nil
+func GetGroup(name string) *Group {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return group[name]
+}
+
+// Name 获取Group的名字
+func (g *Group) Name() string {
+	return g.name
+}
+
+// Get 获取缓存项，未命中时从数据源获取并加入缓存
+func (g *Group) Get(key string) (ByteView, error) {
+	if key == "" {
+		return ByteView{}, fmt.Errorf("geecache: key is required")
+	}
+	if v, ok := g.mainCache.get(key); ok {
+		return v, nil
+	}
+	return g.load(key)
+}
+
+// RegisterPeers 注册选择远程节点的PeerPicker，只能注册一次
+func (g *Group) RegisterPeers(peers PeerPicker) {
+	if g.peers != nil {
+		panic("geecache: RegisterPeers called more than once")
+	}
+	g.peers = peers
+}
+
+// 缓存未命中时加载数据，优先从key所属的远程节点获取，失败时回退到本地数据源，
+// 同一个key并发调用时只有一个调用者访问远程节点或数据源，其余调用者共享结果
+func (g *Group) load(key string) (ByteView, error) {
+	view, err := g.loader.Do(key, func() (interface{}, error) {
+		if g.peers != nil {
+			if peer, ok := g.peers.PickPeer(key); ok {
+				value, err := g.getFromPeer(peer, key)
+				if err == nil {
+					return value, nil
+				}
+				log.Println("[GeeCache] Failed to get from peer", err)
+			}
+		}
+		return g.getLocally(key)
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return view.(ByteView), nil
+}
+
+// 从远程节点获取数据，远程节点的数据不加入本地缓存，避免同一份数据在多个节点重复缓存
+func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+	req := &pb.Request{Group: g.name, Key: key}
+	res := &pb.Response{}
+	if err := peer.Get(req, res); err != nil {
+		return ByteView{}, err
+	}
+	return ByteView{b: res.Value}, nil
+}
+
+// 调用数据源获取数据，复制之后加入缓存，防止数据源之后修改返回的切片
+func (g *Group) getLocally(key string) (ByteView, error) {
+	bytes, err := g.getter.Get(key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	value := ByteView{b: cloneBytes(bytes)}
+	g.populateCache(key, value)
+	return value, nil
+}
+
+// 将数据加入缓存
+func (g *Group) populateCache(key string, value ByteView) {
+	g.mainCache.add(key, value)
+}
@@ -0,0 +1,192 @@
+package geecache
+
+import (
+	"errors"
+	pb "geecache/geecachepb"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var db = map[string]string{
+	"Tom":  "630",
+	"Jack": "589",
+	"Sam":  "567",
+}
+
+func TestGetter(t *testing.T) {
+	var f Getter = GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	expect := []byte("key")
+	if v, _ := f.Get("key"); !reflect.DeepEqual(v, expect) {
+		t.Errorf("callback failed")
+	}
+}
+
+func TestGet(t *testing.T) {
+	loadCounts := make(map[string]int, len(db))
+	gee := NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			loadCounts[key]++
+			return []byte(v), nil
+		}
+		return nil, errors.New(key + " not exist")
+	}))
+
+	for k, v := range db {
+		// 第一次从数据源加载
+		if view, err := gee.Get(k); err != nil || view.String() != v {
+			t.Fatalf("failed to get value of %s", k)
+		}
+		// 第二次应该命中缓存，不再调用数据源
+		if _, err := gee.Get(k); err != nil || loadCounts[k] > 1 {
+			t.Fatalf("cache %s miss", k)
+		}
+	}
+
+	if view, err := gee.Get("unknown"); err == nil {
+		t.Fatalf("the value of unknown should be empty, but %s got", view)
+	}
+	if _, err := gee.Get(""); err == nil {
+		t.Fatalf("empty key should be rejected")
+	}
+}
+
+func TestGetGroup(t *testing.T) {
+	groupName := "scores_registry"
+	NewGroup(groupName, 2<<10, GetterFunc(func(key string) ([]byte, error) { return nil, nil }))
+	if g := GetGroup(groupName); g == nil || g.Name() != groupName {
+		t.Fatalf("group %s not exist", groupName)
+	}
+	if g := GetGroup(groupName + "111"); g != nil {
+		t.Fatalf("expect nil, but %s got", g.Name())
+	}
+}
+
+func TestGetCopiesGetterResult(t *testing.T) {
+	src := []byte("value")
+	gee := NewGroup("scores_copy", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return src, nil
+	}))
+	if _, err := gee.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+	// 修改数据源返回的切片不应该影响缓存
+	src[0] = 'V'
+	if view, _ := gee.Get("key"); view.String() != "value" {
+		t.Fatalf("cached value changed to %s", view)
+	}
+}
+
+type fakePeer struct {
+	calls int
+	err   error
+}
+
+func (p *fakePeer) Get(in *pb.Request, out *pb.Response) error {
+	p.calls++
+	if p.err != nil {
+		return p.err
+	}
+	out.Value = []byte(in.Group + ":" + in.Key)
+	return nil
+}
+
+type fakePicker struct {
+	peer *fakePeer
+}
+
+// 以remote开头的key属于远程节点
+func (p *fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	if strings.HasPrefix(key, "remote") {
+		return p.peer, true
+	}
+	return nil, false
+}
+
+func TestRegisterPeers(t *testing.T) {
+	localCalls := 0
+	gee := NewGroup("scores_peers", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		localCalls++
+		return []byte("local:" + key), nil
+	}))
+	peer := &fakePeer{}
+	gee.RegisterPeers(&fakePicker{peer: peer})
+
+	if view, err := gee.Get("remote1"); err != nil || view.String() != "scores_peers:remote1" || localCalls != 0 {
+		t.Fatalf("expected remote1 from peer, got %s %v", view, err)
+	}
+	if view, err := gee.Get("local1"); err != nil || view.String() != "local:local1" || peer.calls != 1 {
+		t.Fatalf("expected local1 from getter, got %s %v", view, err)
+	}
+	// 远程节点失败时回退到本地数据源
+	peer.err = errors.New("peer down")
+	if view, err := gee.Get("remote2"); err != nil || view.String() != "local:remote2" || localCalls != 2 {
+		t.Fatalf("expected fallback to getter, got %s %v", view, err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic when registering peers twice")
+		}
+	}()
+	gee.RegisterPeers(&fakePicker{})
+}
+
+func TestGetSuppressesDuplicateLoads(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	gee := NewGroup("scores_singleflight", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return []byte("value"), nil
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if view, err := gee.Get("key"); err != nil || view.String() != "value" {
+				t.Errorf("unexpected result %s %v", view, err)
+			}
+		}()
+	}
+	// 等待其他调用者进入等待状态
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("getter called %d times, want 1", got)
+	}
+}
+
+func TestConcurrentHits(t *testing.T) {
+	gee := NewGroup("scores_concurrent", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	for k := range db {
+		gee.Get(k)
+	}
+
+	// 并发命中会同时移动lru的链表节点，需要在-race下运行
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for k, v := range db {
+					if view, err := gee.Get(k); err != nil || view.String() != v {
+						t.Errorf("unexpected value of %s: %s %v", k, view, err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,4 @@
+// Package geecachepb 定义节点之间通信使用的protobuf消息，geecachepb.pb.go由geecachepb.proto生成
+package geecachepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative geecachepb.proto
@@ -1,3 +1,5 @@
 module geecache
 
 go 1.19
+
+require google.golang.org/protobuf v1.28.1
@@ -0,0 +1,191 @@
+package geecache
+
+import (
+	"bytes"
+	"fmt"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// 节点之间通信的默认路径前缀
+	defaultBasePath = "/_geecache/"
+	// 每个节点默认的虚拟节点个数
+	defaultReplicas = 50
+	// 节点之间通信使用的Content-Type
+	protobufContentType = "application/x-protobuf"
+)
+
+// HTTPPool 通过HTTP对外提供本节点的缓存，节点之间使用protobuf编码的请求和响应通信
+type HTTPPool struct {
+	// 本节点的地址，例如 http://localhost:8001
+	self string
+	// 节点之间通信的路径前缀
+	basePath string
+	// 创建时传入的配置
+	opts HTTPPoolOptions
+	// 保护peers和httpGetters
+	mu sync.Mutex
+	// 根据key选择节点的一致性哈希环
+	peers *consistenthash.Map
+	// 每个远程节点对应的HTTP客户端，key为节点地址
+	httpGetters map[string]*httpGetter
+}
+
+// HTTPPoolOptions HTTPPool的配置，零值字段使用默认值
+type HTTPPoolOptions struct {
+	// 节点之间通信的路径前缀，默认为/_geecache/
+	BasePath string
+	// 每个节点的虚拟节点个数，默认为50
+	Replicas int
+	// 一致性哈希使用的哈希函数，默认为crc32.ChecksumIEEE，集群中所有节点需要使用相同的哈希函数
+	HashFn consistenthash.Hash
+}
+
+// NewHTTPPool 创建一个HTTPPool，传入本节点的地址
+func NewHTTPPool(self string) *HTTPPool {
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// NewHTTPPoolOpts 与NewHTTPPool相同，可以通过opts设置路径前缀、虚拟节点个数和哈希函数
+func NewHTTPPoolOpts(self string, opts *HTTPPoolOptions) *HTTPPool {
+	p := &HTTPPool{self: self}
+	if opts != nil {
+		p.opts = *opts
+	}
+	if p.opts.BasePath == "" {
+		p.opts.BasePath = defaultBasePath
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	p.basePath = p.opts.BasePath
+	return p
+}
+
+// Log 打印带有节点地址的日志
+func (p *HTTPPool) Log(format string, v ...interface{}) {
+	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// ServeHTTP 实现http.Handler接口，请求为POST到basePath的protobuf编码的pb.Request，响应为protobuf编码的pb.Response。
+// 请求不合法时返回400，Group不存在时返回404，获取失败时返回500，失败时Response.Error中带有错误信息
+func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != p.basePath {
+		writeResponse(w, http.StatusNotFound, &pb.Response{Error: "unexpected path: " + r.URL.Path})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeResponse(w, http.StatusMethodNotAllowed, &pb.Response{Error: "method not allowed"})
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, &pb.Response{Error: "reading request body: " + err.Error()})
+		return
+	}
+	req := &pb.Request{}
+	if err := proto.Unmarshal(body, req); err != nil || req.Group == "" || req.Key == "" {
+		writeResponse(w, http.StatusBadRequest, &pb.Response{Error: "bad request"})
+		return
+	}
+	p.Log("%s %s/%s", r.Method, req.Group, req.Key)
+
+	g := GetGroup(req.Group)
+	if g == nil {
+		writeResponse(w, http.StatusNotFound, &pb.Response{Error: "no such group: " + req.Group})
+		return
+	}
+	view, err := g.Get(req.Key)
+	if err != nil {
+		writeResponse(w, http.StatusInternalServerError, &pb.Response{Error: err.Error()})
+		return
+	}
+	writeResponse(w, http.StatusOK, &pb.Response{Value: view.ByteSlice()})
+}
+
+// 将pb.Response编码之后写入响应
+func writeResponse(w http.ResponseWriter, status int, res *pb.Response) {
+	body, err := proto.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", protobufContentType)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Set 设置集群中的所有节点，包括本节点，会替换之前设置的节点
+func (p *HTTPPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	p.peers.Add(peers...)
+	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	for _, peer := range peers {
+		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+	}
+}
+
+// PickPeer 实现PeerPicker接口，key属于本节点或未设置节点时ok为false
+func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		p.Log("Pick peer %s", peer)
+		return p.httpGetters[peer], true
+	}
+	return nil, false
+}
+
+var _ PeerPicker = (*HTTPPool)(nil)
+
+// HTTP客户端，访问远程节点的HTTPPool
+type httpGetter struct {
+	// 远程节点的地址加上路径前缀，例如 http://localhost:8001/_geecache/
+	baseURL string
+}
+
+// Get 实现PeerGetter接口，远程节点返回的错误信息会作为错误返回
+func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encoding request: %v", err)
+	}
+	res, err := http.Post(h.baseURL, protobufContentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err = io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("reading response body: %v", err)
+	}
+	if err := proto.Unmarshal(body, out); err != nil {
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("server returned: %v", res.Status)
+		}
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+	if out.Error != "" {
+		return fmt.Errorf("server returned: %v: %s", res.Status, out.Error)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
+
+var _ PeerGetter = (*httpGetter)(nil)
@@ -0,0 +1,184 @@
+package geecache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 发送protobuf编码的请求，返回状态码和解码之后的响应
+func serve(t *testing.T, h http.Handler, method, path string, body []byte) (int, *pb.Response) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(body)))
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Errorf("%s %s: unexpected content type %s", method, path, ct)
+	}
+	res := &pb.Response{}
+	if err := proto.Unmarshal(w.Body.Bytes(), res); err != nil {
+		t.Fatalf("%s %s: failed to decode response: %v", method, path, err)
+	}
+	return w.Code, res
+}
+
+func encodeRequest(t *testing.T, group, key string) []byte {
+	body, err := proto.Marshal(&pb.Request{Group: group, Key: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestHTTPPoolServeHTTP(t *testing.T) {
+	NewGroup("http_scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, errors.New(key + " not exist")
+	}))
+	pool := NewHTTPPool("http://localhost:8001")
+
+	tests := []struct {
+		method string
+		path   string
+		body   []byte
+		status int
+		value  string
+		err    string
+	}{
+		{http.MethodPost, "/_geecache/", encodeRequest(t, "http_scores", "Tom"), http.StatusOK, "630", ""},
+		{http.MethodPost, "/_geecache/", encodeRequest(t, "http_scores", "unknown"), http.StatusInternalServerError, "", "unknown not exist"},
+		{http.MethodPost, "/_geecache/", encodeRequest(t, "no_such_group", "Tom"), http.StatusNotFound, "", "no such group"},
+		{http.MethodPost, "/_geecache/", encodeRequest(t, "http_scores", ""), http.StatusBadRequest, "", "bad request"},
+		{http.MethodPost, "/_geecache/", []byte("not protobuf"), http.StatusBadRequest, "", "bad request"},
+		{http.MethodPost, "/other/", encodeRequest(t, "http_scores", "Tom"), http.StatusNotFound, "", "unexpected path"},
+		{http.MethodGet, "/_geecache/", nil, http.StatusMethodNotAllowed, "", "method not allowed"},
+	}
+	for _, tt := range tests {
+		status, res := serve(t, pool, tt.method, tt.path, tt.body)
+		if status != tt.status || string(res.Value) != tt.value || !strings.Contains(res.Error, tt.err) {
+			t.Errorf("%s %s: got %d %q %q, want %d %q %q", tt.method, tt.path, status, res.Value, res.Error, tt.status, tt.value, tt.err)
+		}
+	}
+}
+
+func TestHTTPGetter(t *testing.T) {
+	NewGroup("http_remote", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "a/b c" {
+			return []byte("escaped"), nil
+		}
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, errors.New(key + " not exist")
+	}))
+	srv := httptest.NewServer(NewHTTPPool("remote"))
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	res := &pb.Response{}
+	if err := getter.Get(&pb.Request{Group: "http_remote", Key: "Sam"}, res); err != nil || string(res.Value) != "567" {
+		t.Fatalf("failed to get Sam from peer: %q %v", res.Value, err)
+	}
+	// key中的特殊字符不需要转义
+	res = &pb.Response{}
+	if err := getter.Get(&pb.Request{Group: "http_remote", Key: "a/b c"}, res); err != nil || string(res.Value) != "escaped" {
+		t.Fatalf("failed to get key with special characters from peer: %q %v", res.Value, err)
+	}
+	// 远程节点的错误信息会返回给调用者
+	err := getter.Get(&pb.Request{Group: "http_remote", Key: "unknown"}, &pb.Response{})
+	if err == nil || !strings.Contains(err.Error(), "unknown not exist") {
+		t.Fatalf("expected remote error for unknown key, got %v", err)
+	}
+	err = getter.Get(&pb.Request{Group: "no_such_group", Key: "Sam"}, &pb.Response{})
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "no such group") {
+		t.Fatalf("expected not found error for unknown group, got %v", err)
+	}
+	// Group从远程节点获取失败时得到远程节点返回的错误
+	if _, err := (&Group{name: "no_such_group"}).getFromPeer(getter, "Sam"); err == nil {
+		t.Fatalf("expected getFromPeer to return the remote error")
+	}
+	srv.Close()
+	if err := getter.Get(&pb.Request{Group: "http_remote", Key: "Sam"}, &pb.Response{}); err == nil {
+		t.Fatalf("expected error when peer is down")
+	}
+}
+
+func TestHTTPPoolPickPeer(t *testing.T) {
+	self, other := "http://localhost:8001", "http://localhost:8002"
+	pool := NewHTTPPool(self)
+	if _, ok := pool.PickPeer("Tom"); ok {
+		t.Fatalf("pool without peers should not pick any peer")
+	}
+	pool.Set(self, other)
+
+	var local, remote int
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		peer, ok := pool.PickPeer(key)
+		if !ok {
+			local++
+			continue
+		}
+		remote++
+		// 远程节点使用对应地址的客户端
+		if g := peer.(*httpGetter); g.baseURL != other+defaultBasePath {
+			t.Fatalf("unexpected peer %s for %s", g.baseURL, key)
+		}
+		// 同一个key总是选择同一个节点
+		if again, _ := pool.PickPeer(key); again != peer {
+			t.Fatalf("key %s picked different peers", key)
+		}
+	}
+	if local == 0 || remote == 0 {
+		t.Fatalf("keys should be spread across peers, local=%d remote=%d", local, remote)
+	}
+
+	// 只剩本节点时所有key都在本地获取
+	pool.Set(self)
+	if _, ok := pool.PickPeer("key1"); ok {
+		t.Fatalf("single node pool should not pick a remote peer")
+	}
+}
+
+func TestNewHTTPPoolOpts(t *testing.T) {
+	self, other := "http://localhost:8001", "http://localhost:8002"
+	// 所有key都映射到哈希值0，环上第一个虚拟节点的拥有者获得全部key
+	pool := NewHTTPPoolOpts(self, &HTTPPoolOptions{
+		BasePath: "/_custom/",
+		Replicas: 1,
+		HashFn: func(data []byte) uint32 {
+			if string(data) == "0"+other {
+				return 1
+			}
+			if string(data) == "0"+self {
+				return 2
+			}
+			return 0
+		},
+	})
+	pool.Set(self, other)
+	peer, ok := pool.PickPeer("anything")
+	if !ok || peer.(*httpGetter).baseURL != other+"/_custom/" {
+		t.Fatalf("custom hash and base path should route to %s", other)
+	}
+
+	if status, _ := serve(t, pool, http.MethodPost, "/_geecache/", encodeRequest(t, "http_scores", "Tom")); status != http.StatusNotFound {
+		t.Fatalf("default base path should not be served, got %d", status)
+	}
+}
+
+func TestResponseIgnoresReservedFields(t *testing.T) {
+	// 旧版本节点可能在2和3号字段中写入数据，解码时会被忽略
+	old := []byte{0x0a, 0x01, 'v', 0x10, 0x05, 0x18, 0x01}
+	res := &pb.Response{}
+	if err := proto.Unmarshal(old, res); err != nil || string(res.Value) != "v" {
+		t.Fatalf("failed to decode response with reserved fields: %q %v", res.Value, err)
+	}
+}
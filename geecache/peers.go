@@ -0,0 +1,14 @@
+package geecache
+
+import pb "geecache/geecachepb"
+
+// PeerPicker 根据key选择拥有该key的远程节点
+type PeerPicker interface {
+	// PickPeer 返回key所属的远程节点，key属于本节点时ok为false
+	PickPeer(key string) (peer PeerGetter, ok bool)
+}
+
+// PeerGetter 从远程节点的Group中获取缓存项，请求和响应使用protobuf定义，见geecachepb
+type PeerGetter interface {
+	Get(in *pb.Request, out *pb.Response) error
+}
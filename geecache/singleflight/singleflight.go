@@ -0,0 +1,54 @@
+package singleflight
+
+import (
+	"errors"
+	"sync"
+)
+
+// errPanicked fn发生panic时等待中的调用者收到的错误
+var errPanicked = errors.New("singleflight: fn panicked")
+
+// 正在进行或已经结束的请求
+type call struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// Group 管理不同key的请求，同一个key同时只会执行一次fn
+type Group struct {
+	mu sync.Mutex
+	m  map[string]*call
+}
+
+// Do 执行fn并返回结果，同一个key并发调用时只有第一个调用者执行fn，其余调用者等待并共享结果，
+// fn返回之后key的下一次调用会重新执行；fn发生panic时panic会传递给执行fn的调用者，其余调用者收到错误
+func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.m == nil {
+		// 延迟初始化
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		g.mu.Unlock()
+		// 等待正在进行的请求
+		c.wg.Wait()
+		return c.val, c.err
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	// fn正常返回时会被覆盖
+	c.err = errPanicked
+	defer func() {
+		c.wg.Done()
+		g.mu.Lock()
+		delete(g.m, key)
+		g.mu.Unlock()
+	}()
+
+	c.val, c.err = fn()
+	return c.val, c.err
+}